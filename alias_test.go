@@ -0,0 +1,32 @@
+package configmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliases(t *testing.T) {
+	c := NewTestClient(WithAliases(map[string]string{
+		"old.name": "new.name",
+	})).
+		SetString("old.name", "old").
+		SetString("old.timeout", "1s")
+
+	// old keys resolve to themselves until the new key exists
+	assert.Equal(t, "old", c.GetString("old.name", ""))
+	c.SetString("new.name", "new")
+	assert.Equal(t, "new", c.GetString("old.name", ""))
+	assert.Equal(t, "new", c.WithPrefix("old.").GetString("name", ""))
+
+	c.setValue("configmanager.aliases", map[string]string{
+		"old.timeout": "timeout",
+	})
+	assert.Equal(t, "1s", c.GetString("old.timeout", ""))
+	c.SetString("timeout", "2s")
+	assert.Equal(t, "2s", c.GetString("old.timeout", ""))
+	assert.Equal(t, "2s", c.Snapshot().GetString("old.timeout", ""))
+
+	c.SetString("configmanager.aliases", "invalid")
+	assert.Equal(t, "1s", c.GetString("old.timeout", ""))
+}
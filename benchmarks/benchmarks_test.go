@@ -0,0 +1,193 @@
+package benchmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mixpanel/configmanager"
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	scope = "benchmarks"
+	// whitelistSize is the number of projects of the large whitelist
+	whitelistSize = 100000
+)
+
+// writeConfigs writes configs as the configs.json of scope in dir
+func writeConfigs(tb testing.TB, dir string, configs map[string]interface{}) {
+	type config struct {
+		Key   string      `json:"key"`
+		Value interface{} `json:"value"`
+	}
+	var persist []config
+	for key, val := range configs {
+		persist = append(persist, config{Key: key, Value: val})
+	}
+	data, err := json.Marshal(persist)
+	require.NoError(tb, err)
+	tmp := path.Join(dir, scope, "configs.json.tmp")
+	require.NoError(tb, ioutil.WriteFile(tmp, data, 0644))
+	require.NoError(tb, os.Rename(tmp, path.Join(dir, scope, "configs.json")))
+}
+
+// whitelist returns a whitelist of the projects 0 to n-1
+func whitelist(n int) map[string]struct{} {
+	projects := make(map[string]struct{}, n)
+	for i := 0; i < n; i++ {
+		projects[fmt.Sprint(i)] = struct{}{}
+	}
+	return projects
+}
+
+// configs returns the configs of the workloads,
+// with version as the value of the version key
+func configs(version int64) map[string]interface{} {
+	return map[string]interface{}{
+		"version":   version,
+		"hot":       int64(1),
+		"hot_flag":  0.5,
+		"whitelist": whitelist(whitelistSize),
+	}
+}
+
+// newClient returns a client reading the configs of the workloads
+// from a file, like the services do
+func newClient(tb testing.TB) configmanager.Client {
+	dir := tb.TempDir()
+	require.NoError(tb, os.Mkdir(path.Join(dir, scope), 0755))
+	writeConfigs(tb, dir, configs(0))
+	c, err := configmanager.NewClient(dir, scope, obs.NullFR, configmanager.WithoutExpvar())
+	require.NoError(tb, err)
+	tb.Cleanup(c.Close)
+	return c
+}
+
+// BenchmarkHotKey reads the same key from every goroutine
+func BenchmarkHotKey(b *testing.B) {
+	c := newClient(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.GetInt64("hot", 0)
+		}
+	})
+}
+
+// BenchmarkWhitelistMembership checks random projects
+// against a whitelist of 100k projects
+func BenchmarkWhitelistMembership(b *testing.B) {
+	c := newClient(b)
+	// the first read parses the whitelist
+	c.IsProjectWhitelisted("whitelist", 0, false)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			c.IsProjectWhitelisted("whitelist", rnd.Int63n(2*whitelistSize), false)
+		}
+	})
+}
+
+// BenchmarkReloadUnderReadLoad reads the hot key and the whitelist
+// while the configs are rewritten and reloaded in a loop, so that the
+// whitelist is parsed again after every reload
+func BenchmarkReloadUnderReadLoad(b *testing.B) {
+	dir := b.TempDir()
+	require.NoError(b, os.Mkdir(path.Join(dir, scope), 0755))
+	writeConfigs(b, dir, configs(0))
+	c, err := configmanager.NewClient(dir, scope, obs.NullFR, configmanager.WithoutExpvar())
+	require.NoError(b, err)
+	defer c.Close()
+
+	var reloads int64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for version := int64(1); ; version++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			writeConfigs(b, dir, configs(version))
+			if c.Reload() == nil {
+				atomic.AddInt64(&reloads, 1)
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var project int64
+		for pb.Next() {
+			c.GetInt64("hot", 0)
+			c.IsProjectWhitelisted("whitelist", project%whitelistSize, false)
+			project++
+		}
+	})
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+	b.ReportMetric(float64(atomic.LoadInt64(&reloads)), "reloads")
+}
+
+// BenchmarkIsFeatureEnabled64 evaluates a rollout
+// from 64 goroutines, whatever GOMAXPROCS is
+func BenchmarkIsFeatureEnabled64(b *testing.B) {
+	const goroutines = 64
+	c := newClient(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		n := b.N / goroutines
+		if i < b.N%goroutines {
+			n++
+		}
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				c.IsFeatureEnabled("hot_flag", false)
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+// TestHotPathsDoNotAllocate fails when the reads of the
+// benchmarks above start allocating
+func TestHotPathsDoNotAllocate(t *testing.T) {
+	c := newClient(t)
+	for _, tc := range []struct {
+		name string
+		read func()
+	}{
+		{"hot_key", func() { c.GetInt64("hot", 0) }},
+		{"whitelist_membership", func() { c.IsProjectWhitelisted("whitelist", 42, false) }},
+		{"is_feature_enabled", func() { c.IsFeatureEnabled("hot_flag", false) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// the first read parses the value
+			tc.read()
+			if allocs := testing.AllocsPerRun(100, tc.read); allocs > 0 {
+				t.Errorf("%s allocates %v times per read", tc.name, allocs)
+			}
+		})
+	}
+}
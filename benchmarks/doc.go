@@ -0,0 +1,9 @@
+// Package benchmarks holds the benchmarks of configmanager on realistic
+// workloads, so that the performance changes of the client, the model and
+// configmap are measured end to end:
+//
+//	go test -run xxx -bench . -benchmem -cpu 1,8 ./benchmarks
+//
+// The tests of the package fail when the reads of the hot paths start
+// allocating, so that such regressions are caught by go test ./...
+package benchmarks
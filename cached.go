@@ -0,0 +1,42 @@
+package configmanager
+
+import (
+	"github.com/mixpanel/obs/obserr"
+)
+
+// ParseFunc parses the raw value of a config. decode is
+// the DecodeFunc registered for the key, nil if none.
+type ParseFunc func(raw []byte, decode DecodeFunc) (interface{}, error)
+
+// cachedValues are the values parsed from
+// a config by GetCached, by id
+type cachedValues map[interface{}]interface{}
+
+// GetCached returns the value of key parsed by parse. The value is
+// cached per id until the value of key changes, e.g. per type of
+// message for the getters of the types the client does not know,
+// like the ones of protoconfig. The cached value is shared by the
+// callers and must not be modified.
+func (c *client) GetCached(key string, id interface{}, parse ParseFunc) (interface{}, error) {
+	config, err := c.sm.GetKey(key)
+	if err != nil {
+		return nil, obserr.Annotate(err, "GetCached: error getting the key").Set("key", key)
+	}
+	cached, _ := c.sm.GetParsedValue(config).(cachedValues)
+	if val, ok := cached[id]; ok {
+		return val, nil
+	}
+	val, err := parse(config.RawValue, c.decoders.get(c.prefix+key))
+	if err != nil {
+		return nil, obserr.Annotate(err, "GetCached: error parsing the key").Set("key", key)
+	}
+	// the cached values are shared so they are
+	// copied instead of being modified in place
+	values := make(cachedValues, len(cached)+1)
+	for i, v := range cached {
+		values[i] = v
+	}
+	values[id] = val
+	c.sm.SetParsedValue(config, values)
+	return val, nil
+}
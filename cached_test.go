@@ -0,0 +1,51 @@
+package configmanager
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCached(t *testing.T) {
+	c := NewTestClient().SetRaw("limit", []byte(`"10"`))
+
+	var parses int
+	parseInt := func(raw []byte, decode DecodeFunc) (interface{}, error) {
+		parses++
+		var s string
+		if err := decode(raw, &s); err != nil {
+			return nil, err
+		}
+		return strconv.Atoi(s)
+	}
+	c.RegisterDecoder("limit", func(raw []byte, val interface{}) error {
+		*val.(*string) = string(raw[1 : len(raw)-1])
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		val, err := c.GetCached("limit", "int", parseInt)
+		require.NoError(t, err)
+		assert.Equal(t, 10, val)
+	}
+	assert.Equal(t, 1, parses)
+
+	// the values are cached per id until the value changes
+	val, err := c.GetCached("limit", "len", func(raw []byte, _ DecodeFunc) (interface{}, error) {
+		return len(raw), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, val)
+	c.SetRaw("limit", []byte(`"20"`))
+	val, err = c.GetCached("limit", "int", parseInt)
+	require.NoError(t, err)
+	assert.Equal(t, 20, val)
+	assert.Equal(t, 2, parses)
+
+	c.SetRaw("limit", []byte(`"x"`))
+	_, err = c.GetCached("limit", "int", parseInt)
+	assert.Error(t, err)
+	_, err = c.GetCached("missing", "int", parseInt)
+	assert.True(t, IsNotFound(err))
+}
@@ -3,7 +3,9 @@ package configmanager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"sync"
 	"time"
@@ -18,21 +20,189 @@ import (
 // It has helper methods for different data types so the user
 // does not have to care about the structure of configs.
 type Client interface {
+	Reader
+	// BindScope is UnmarshalScope that re-binds dst on every reload
+	BindScope(dst interface{}, mu sync.Locker) (cancel func(), err error)
+	// Subscribe calls fn with the old and new raw values every
+	// time a reload changes key. A missing value is nil.
+	Subscribe(key string, fn func(old, new []byte)) (cancel func())
+	// The typed Subscribe methods only call fn when the
+	// parsed value changes
+	SubscribeInt64(key string, fn func(old, new int64)) (cancel func())
+	SubscribeBool(key string, fn func(old, new bool)) (cancel func())
+	SubscribeFloat64(key string, fn func(old, new float64)) (cancel func())
+	SubscribeString(key string, fn func(old, new string)) (cancel func())
+	// SubscribeDiff calls fn with the keys added, removed
+	// and changed by every reload that changed anything
+	SubscribeDiff(fn func(model.Diff)) (cancel func())
+	// The Watch methods return a channel receiving the current
+	// value of key and every new value after it changes
+	WatchRaw(key string) (<-chan []byte, func())
+	WatchString(key string) (<-chan string, func())
+	WatchInt64(key string) (<-chan int64, func())
+	// Snapshot returns a Reader pinned to the currently loaded
+	// configs so that multiple reads see consistent values
+	Snapshot() Snapshot
+	// WithPrefix returns a Client whose keys are prepended with
+	// prefix, e.g. GetInt64("batch_size", 0) on WithPrefix("kafka.")
+	// reads kafka.batch_size. Closing it does not close c.
+	WithPrefix(prefix string) Client
+	// SetOverride overrides key with raw in this process until
+	// ttl passes or ClearOverride is called. Overrides are never
+	// persisted and take precedence over every other source.
+	SetOverride(key string, raw []byte, ttl time.Duration)
+	ClearOverride(key string)
+	// Overrides returns the overrides set and not expired
+	Overrides() []model.RuntimeOverride
+	// RegisterDecoder decodes the values of key
+	// with fn instead of JSON
+	RegisterDecoder(key string, fn DecodeFunc)
+	// RegisterDefaults registers the values used for
+	// keys that no source has
+	RegisterDefaults(defaults map[string]interface{}) error
+	// RegisterValidator validates the new values of key with
+	// fn, invalid values are not loaded
+	RegisterValidator(key string, fn func(raw []byte) error)
+	// Reload synchronously reads the configs from their source
+	// again and returns the error of the load, if any. The reload
+	// listeners and the Subscribe callbacks are called once the
+	// load is done, so they may call Reload: their own notifications
+	// are then delivered after they return.
+	Reload() error
+	Close()
+	// Done is closed once Close returned, e.g. to
+	// close what depends on the client after it
+	Done() <-chan struct{}
+	// Version returns the generation, the content hash and
+	// the load time of the configs served
+	Version() (gen uint64, hash string, loadedAt time.Time)
+	// UsageReport returns the keys read, not read and
+	// missing since the client was created
+	UsageReport() UsageReport
+	// Healthy returns an error if the configs served are
+	// not known to match their source
+	Healthy(ctx context.Context) error
+	// Events returns a channel receiving the changes
+	// of the keys made by every reload
+	Events() <-chan ChangeEvent
+	// DebugReport returns all the configs loaded, with
+	// their parsed values, and their version
+	DebugReport() DebugReport
+}
+
+// Reader has the methods for reading configs. Components that only
+// need some of them should take the smaller interface they need, e.g.
+// a FlagEvaluator, so that their mocks stay small.
+type Reader interface {
+	RawReader
+	TypedGetter
+	FlagEvaluator
+	WhitelistChecker
+}
+
+// RawReader has the methods reading the raw
+// values of the configs or unmarshalling them
+type RawReader interface {
 	Unmarshal(key string, val interface{}) error
+	// UnmarshalScope binds the configs to a struct with
+	// `config:"key"` and `default:"value"` field tags
+	UnmarshalScope(dst interface{}) error
+	GetRaw(key string) ([]byte, error)
+	// GetMany reads all the keys from the same loaded configs.
+	// Missing keys are left out of the map and reported as a
+	// not found error.
+	GetMany(keys ...string) (map[string]json.RawMessage, error)
+
+	// Keys returns the sorted keys loaded in the scope
+	Keys() []string
+	HasKey(key string) bool
+
+	// GetProjectOverride unmarshals the entry of projectID in
+	// key, a map keyed by project id, into dst
+	GetProjectOverride(key string, projectID int64, dst interface{}) (bool, error)
+	// GetCached returns the value of key parsed by parse,
+	// cached per id until the value changes
+	GetCached(key string, id interface{}, parse ParseFunc) (interface{}, error)
+}
+
+// TypedGetter has the getters of the scalar values
+type TypedGetter interface {
 	GetBoolean(key string, defaultVal bool) bool
 	GetInt64(key string, defaultVal int64) int64
 	GetByte(key string, defaultVal uint8) uint8
-
 	GetFloat64(key string, defaultVal float64) float64
 	GetString(key string, defaultVal string) string
-	GetRaw(key string) ([]byte, error)
 
+	// The E variants return an error instead of a default value.
+	// Use IsNotFound to tell a missing key from a parse error.
+	GetBooleanE(key string) (bool, error)
+	GetInt64E(key string) (int64, error)
+	GetByteE(key string) (uint8, error)
+	GetFloat64E(key string) (float64, error)
+	GetStringE(key string) (string, error)
+
+	// The Ctx variants apply the overrides set on
+	// the context with WithOverrides
+	GetBooleanCtx(ctx context.Context, key string, defaultVal bool) bool
+	GetInt64Ctx(ctx context.Context, key string, defaultVal int64) int64
+	GetFloat64Ctx(ctx context.Context, key string, defaultVal float64) float64
+	GetStringCtx(ctx context.Context, key string, defaultVal string) string
+}
+
+// FlagEvaluator has the methods evaluating feature flags
+type FlagEvaluator interface {
 	IsFeatureEnabled(key string, enabledByDefault bool) bool
+	// IsFeatureEnabledForProject is IsFeatureEnabled that
+	// always returns the same result for the same project
+	IsFeatureEnabledForProject(key string, projectID int64, enabledByDefault bool) bool
+	// IsFeatureEnabledForID is IsFeatureEnabledForProject for
+	// any id, e.g. a user id, a token or a device id
+	IsFeatureEnabledForID(key string, id string, enabledByDefault bool) bool
+	// IsFeatureEnabledCtx is IsFeatureEnabled that applies
+	// the overrides set on the context with WithOverrides
+	IsFeatureEnabledCtx(ctx context.Context, key string, enabledByDefault bool) bool
+	// IsFeatureActive returns true if the scheduled
+	// flag in key is enabled at now
+	IsFeatureActive(key string, now time.Time, defaultVal bool) bool
+	// GetRolloutFraction returns the rollout fraction of
+	// key at now, which may be ramping up over time
+	GetRolloutFraction(key string, now time.Time, defaultVal float64) float64
+	// EvaluateFlag returns whether the flag in key is
+	// enabled for the project and the reason why
+	EvaluateFlag(key string, projectID int64, enabledByDefault bool) (bool, Reason)
+	// EvaluateFlagForID is EvaluateFlag for any id,
+	// e.g. a token, a user id or a device id
+	EvaluateFlagForID(key string, id string, enabledByDefault bool) (bool, Reason)
+	// IsEnabledForProject evaluates a flag combining a blacklist,
+	// a whitelist and a rollout fraction, in this order
+	IsEnabledForProject(key string, projectID int64, enabledByDefault bool) bool
+}
+
+// WhitelistChecker has the methods reading
+// the whitelists and the blacklists
+type WhitelistChecker interface {
 	// we use project whitelisting quite a lot. This expects
 	// map [int64]struct{}
 	IsProjectWhitelisted(key string, projectID int64, defaultVal bool) bool
 	IsTokenWhitelisted(key string, token string, defaultVal bool) bool
-	Close()
+	// IsMemberWhitelisted is IsTokenWhitelisted for any string member,
+	// e.g. a distinct_id, an org slug or a hostname
+	IsMemberWhitelisted(key string, member string, defaultVal bool) bool
+	// GetProjectWhitelist returns a read-only view of the cached
+	// whitelist in key and GetTokenWhitelist a copy of the one
+	// in key, e.g. to iterate them
+	GetProjectWhitelist(key string) (ProjectWhitelist, error)
+	GetTokenWhitelist(key string) (map[string]struct{}, error)
+	// The blacklist methods read deny lists with the
+	// same format as the whitelists
+	IsProjectBlacklisted(key string, projectID int64, defaultVal bool) bool
+	IsTokenBlacklisted(key string, token string, defaultVal bool) bool
+}
+
+// Snapshot is a point-in-time view of the configs. Reads
+// from a Snapshot are not affected by reloads.
+type Snapshot interface {
+	Reader
 }
 
 type client struct {
@@ -40,13 +210,58 @@ type client struct {
 	sm          model.StateManager
 	unmarshalFn func([]byte, interface{}) error
 	rng         rnd
-	mu          sync.Mutex // Lock for rng since the one we use is not concurrent-safe
+	opts        *options
+	onClose     []func()
+
+	// overrides are the runtime overrides of SetOverride.
+	// prefix is prepended to their keys by WithPrefix views.
+	overrides *model.RuntimeOverrides
+	prefix    string
+	// defaults are the defaults of RegisterDefaults,
+	// below all the other sources
+	defaults *model.RuntimeOverrides
+
+	decoders *decoders
+	// version, usage and health are shared by the views of the client
+	version *versionTracker
+	usage   *usageTracker
+	health  *healthTracker
+	// preparser parses the changed values in the
+	// background, nil without WithPreparse
+	preparser *preparser
+
+	life lifecycle
+
+	// ctx is the context of the Ctx getters, for the
+	// traces of the decodes, nil for other reads
+	ctx context.Context
 }
 
+// rnd is the source of the random numbers of the
+// evaluations, it must be safe for concurrent use
 type rnd interface {
 	Float64() float64
 }
 
+// rndPool holds the sources of pooledRnd. sync.Pool keeps them
+// per P, so that concurrent evaluations do not contend on a lock.
+var rndPool = sync.Pool{
+	New: func() interface{} {
+		return rand.New(rand.NewSource(time.Now().UnixNano() ^ rand.Int63()))
+	},
+}
+
+// pooledRnd draws from a source of rndPool, which is
+// only used by one goroutine at a time
+type pooledRnd struct{}
+
+func (pooledRnd) Float64() float64 {
+	r := rndPool.Get().(*rand.Rand)
+	f := r.Float64()
+	rndPool.Put(r)
+	return f
+}
+
 // NewNullClient returns a client that will just
 // echo back the default value you set in your Gets
 func NewNullClient() Client {
@@ -64,10 +279,10 @@ type TestClient struct {
 }
 
 // NewTestClient returns a TestClient
-func NewTestClient() *TestClient {
+func NewTestClient(opts ...Option) *TestClient {
 	dm := model.NewDummyStateManager()
 	return &TestClient{
-		client: newClientFromStateManager(dm, obs.NullFR),
+		client: newClientFromStateManager(dm, obs.NullFR, opts...),
 		dm:     dm,
 	}
 }
@@ -89,6 +304,16 @@ func (t *TestClient) SetProjectsWhitelist(key string, projects ...int) *TestClie
 	return t.setValue(key, val)
 }
 
+// SetMembersWhitelist sets key to a whitelist of string
+// members, e.g. tokens
+func (t *TestClient) SetMembersWhitelist(key string, members ...string) *TestClient {
+	val := make(map[string]struct{})
+	for _, m := range members {
+		val[m] = struct{}{}
+	}
+	return t.setValue(key, val)
+}
+
 func (t *TestClient) SetBoolean(key string, val bool) *TestClient {
 	return t.setValue(key, val)
 }
@@ -125,25 +350,152 @@ func (t *TestClient) SetByte(key string, val uint8) *TestClient {
 // of your configs into logical scope and create the configmap using the jsonnet helper.
 // With adoption of this client, you will at least every single service having
 // one scope with bunch of configs that are relevant to that service.
-func NewClient(dirPath string, scope string, fr obs.FlightRecorder) (Client, error) {
+func NewClient(dirPath string, scope string, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	o := newOptions(opts)
+	if len(o.fallbackScopes) > 0 {
+		scopes := []string{scope}
+		for _, fallback := range o.fallbackScopes {
+			scopes = append([]string{fallback}, scopes...)
+		}
+		return NewMultiScopeClient(dirPath, scopes, fr, opts...)
+	}
+
 	fr = fr.ScopeName("config_manager")
-	sm, err := model.NewStateManager(dirPath, scope, nil, fr)
+	sm, err := model.NewStateManager(dirPath, scope, nil, fr, o.smOpts...)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating config manager client").Set(
+			"scope", scope,
+			"dir_path", dirPath,
+		)
+	}
+	c, err := newCheckedClient(o.withOverrides(sm, scope), fr, o)
 	if err != nil {
 		return nil, obserr.Annotate(err, "Error creating config manager client").Set(
 			"scope", scope,
 			"dir_path", dirPath,
 		)
 	}
-	return newClientFromStateManager(sm, fr), err
+	return c, nil
 }
 
-func newClientFromStateManager(sm model.StateManager, fr obs.FlightRecorder) *client {
-	return &client{
+// NewClientContext is NewClient but stops waiting for the initial load of
+// the configs when ctx is done, in which case the client is not created.
+// Like NewClient, the wait is also bounded by the startup timeout.
+func NewClientContext(ctx context.Context, dirPath string, scope string, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	return NewClient(dirPath, scope, fr, append(opts[:len(opts):len(opts)], withStartupContext(ctx))...)
+}
+
+// NewClientWithOptions is NewClient with every setting passed as an
+// Option, e.g. the FlightRecorder with WithFlightRecorder:
+//
+//	cm, err := configmanager.NewClientWithOptions("/etc/configs", "my-service",
+//		configmanager.WithFlightRecorder(fr),
+//		configmanager.WithResyncInterval(time.Minute),
+//		configmanager.WithRequiredKeys("ingest.enabled"))
+func NewClientWithOptions(dirPath string, scope string, opts ...Option) (Client, error) {
+	return NewClient(dirPath, scope, newOptions(opts).fr, opts...)
+}
+
+// NewMultiScopeClient returns a client reading from several scopes under
+// dirPath. Keys are resolved in the order of the scopes, a key in a later
+// scope shadows the same key in the earlier ones. For example with
+// []string{"global", "ingest", "ingest-canary"} the canary scope only
+// needs the keys that differ from the ingest and global scopes.
+func NewMultiScopeClient(dirPath string, scopes []string, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	o := newOptions(opts)
+	fr = fr.ScopeName("config_manager")
+	sm, err := model.NewMultiScopeStateManager(dirPath, scopes, fr, o.smOpts...)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating multi scope config manager client").Set(
+			"scopes", scopes,
+			"dir_path", dirPath,
+		)
+	}
+	c, err := newCheckedClient(o.withOverrides(sm, scopes...), fr, o)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating multi scope config manager client").Set(
+			"scopes", scopes,
+			"dir_path", dirPath,
+		)
+	}
+	return c, nil
+}
+
+// NewClientFromStateManager returns a client reading the configs of sm,
+// e.g. a StateManager of a bespoke source, with the same getters, caching,
+// flags and subscriptions as with the other sources. Closing the client
+// closes sm. The options of the StateManager, such as WithMetrics loads,
+// WithResyncInterval or the validators of RegisterValidator, do not
+// apply to sm, which must implement them itself.
+func NewClientFromStateManager(sm model.StateManager, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	o := newOptions(opts)
+	fr = fr.ScopeName("config_manager")
+	c, err := newCheckedClient(o.withOverrides(sm), fr, o)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating config manager client from a StateManager")
+	}
+	return c, nil
+}
+
+// newCheckedClient is newClientFromOptions that also
+// checks the configs loaded by sm. sm is closed on error.
+func newCheckedClient(sm model.StateManager, fr obs.FlightRecorder, o *options) (*client, error) {
+	c := newClientFromOptions(sm, fr, o)
+	if err := c.checkRequiredKeys(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.watchRequiredKeys()
+	return c, nil
+}
+
+func newClientFromStateManager(sm model.StateManager, fr obs.FlightRecorder, opts ...Option) *client {
+	return newClientFromOptions(sm, fr, newOptions(opts))
+}
+
+// newClientFromOptions returns a client reading from sm. o must be the
+// options sm was created with, since they share the validators.
+func newClientFromOptions(sm model.StateManager, fr obs.FlightRecorder, o *options) *client {
+	overrides := model.NewRuntimeOverridesWithClock(o.clock)
+	defaults := model.NewRuntimeOverridesWithClock(o.clock)
+	sm = model.NewLayeredStateManager(defaults, sm, overrides)
+	version, cancelVersion := newVersionTracker(sm, o.now)
+	deprecations := newDeprecations(fr, o.now)
+	usage := &usageTracker{}
+	sm = model.NewAliasStateManager(sm, o.aliases, deprecations.onAlias)
+	sm = model.NewObservedStateManager(sm, observeGet(deprecations, usage, o.metrics))
+	c := &client{
 		fr:          fr,
 		sm:          sm,
-		unmarshalFn: json.Unmarshal,
-		rng:         defaultRng(time.Now().UnixNano()),
+		unmarshalFn: o.unmarshal,
+		rng:         pooledRnd{},
+		opts:        o,
+		overrides:   overrides,
+		defaults:    defaults,
+		decoders:    &decoders{},
+		version:     version,
+		usage:       usage,
+		health:      o.health,
+		onClose:     []func(){cancelVersion},
 	}
+	if o.preparseTypes != nil {
+		// parsed through the layered configs so that
+		// preparsing does not count as reads
+		pc := c.derive(version.sm)
+		preparser, stop := newPreparser(version.sm, o.preparseTypes, pc.preparse)
+		c.preparser = preparser
+		c.onClose = append(c.onClose, stop)
+	}
+	for _, fn := range c.opts.onReload {
+		fn := fn
+		c.onClose = append(c.onClose, sm.OnReload(func() {
+			fn(ReloadSummary{
+				Keys:     sm.Keys(),
+				LoadedAt: o.now(),
+			})
+		}))
+	}
+	return c
 }
 
 func (c *client) Unmarshal(key string, val interface{}) error {
@@ -151,7 +503,7 @@ func (c *client) Unmarshal(key string, val interface{}) error {
 	if err != nil {
 		return obserr.Annotate(err, "Unmarshal: error getting the key").Set("key", key)
 	}
-	if err := c.unmarshalFn(config.RawValue, val); err != nil {
+	if err := c.decode(key, config.RawValue, val); err != nil {
 		return obserr.Annotate(err, "Unmarshal: error unmarshalling the key").Set("key", key)
 	}
 	// we could set the parsed value but because we
@@ -160,36 +512,115 @@ func (c *client) Unmarshal(key string, val interface{}) error {
 	return nil
 }
 
+// IsNotFound returns true if the error returned by
+// the client was caused by a missing key
+func IsNotFound(err error) bool {
+	return obserr.Original(err) == model.ErrNotFound
+}
+
+// checkType returns an error if config declares
+// a type that is not one of types
+func checkType(config *model.Config, types ...model.ConfigType) error {
+	if config.Type == "" {
+		return nil
+	}
+	for _, typ := range types {
+		if config.Type == typ {
+			return nil
+		}
+	}
+	return obserr.Annotate(model.ErrWrongType, "checkType: config declared with another type").Set(
+		"key", config.Key,
+		"type", config.Type,
+	)
+}
+
+// errSensitiveValue is logged in place of errors about
+// sensitive configs since parse errors may quote the value
+var errSensitiveValue = errors.New("error about a sensitive config, redacted")
+
+// fallbackCause returns why a getter
+// returned its default value, for metrics
+func fallbackCause(err error) string {
+	switch obserr.Original(err) {
+	case model.ErrNotFound:
+		return "not_found"
+	case model.ErrWrongType:
+		return "wrong_type"
+	default:
+		return "invalid_value"
+	}
+}
+
 func (c *client) logErrGet(err error, key string, defaultVal interface{}, fs obs.FlightSpan) {
-	if obserr.Original(err) == model.ErrNotFound {
+	// silent fallbacks to the defaults hide config
+	// regressions, they are counted to alert on spikes
+	cause := fallbackCause(err)
+	fs.Incr("default_fallback." + cause)
+	fs.Debug("default_fallback", obs.Vals{
+		"key":   key,
+		"cause": cause,
+	})
+	notFound := IsNotFound(err)
+	if !notFound {
+		if cfg, gerr := c.lookup(key); gerr == nil && cfg.Sensitive {
+			err = errSensitiveValue
+		}
+	}
+	if c.opts.metrics != nil {
+		c.opts.metrics.DefaultUsed(key, cause, err)
+	}
+	if c.opts.onError != nil {
+		c.opts.onError(err, key)
+	}
+	if notFound {
 		// no log
 		return
 	}
+	if c.opts.strictTypes {
+		c.typeMismatch(err, key, defaultVal, fs)
+		return
+	}
 	fs.Warn("config_client_get", "Error while doing get", obs.Vals{
 		"key":           key,
 		"default_value": defaultVal,
 	}.WithError(err))
 }
 
+func (c *client) typeMismatch(err error, key string, defaultVal interface{}, fs obs.FlightSpan) {
+	fs.Incr("type_mismatch")
+	fs.Critical("config_client_type_mismatch", "Config value does not match the requested type", obs.Vals{
+		"key":           key,
+		"default_value": defaultVal,
+	}.WithError(err))
+	if c.opts.onTypeMismatch != nil {
+		c.opts.onTypeMismatch(key, err)
+	}
+}
+
+func (c *client) GetByteE(key string) (uint8, error) {
+	return c.getByte(key, 0)
+}
+
 func (c *client) getByte(key string, defaultVal uint8) (uint8, error) {
 	config, err := c.sm.GetKey(key)
 	if err != nil {
 		return defaultVal, obserr.Annotate(err, "getByte: Error getting key from config")
 	}
-	pv := c.sm.GetParsedValue(config)
-	if pv != nil {
-		val, ok := pv.(uint8)
-		if ok {
-			return val, nil
-		}
+	if err := checkType(config, model.TypeInt64); err != nil {
+		return defaultVal, obserr.Annotate(err, "getByte: wrong type")
+	}
+	// bytes share the cached value of the int64 getters, the
+	// ones out of range are decoded again for their error
+	if val, ok := config.CachedInt64(); ok && val >= 0 && val <= math.MaxUint8 {
+		return uint8(val), nil
 	}
 	var val uint8
-	if err := c.Unmarshal(key, &val); err != nil {
+	if err := c.decode(key, config.RawValue, &val); err != nil {
 		return defaultVal, obserr.Annotate(err, "getByte: error unmarshalling")
 	}
-	c.sm.SetParsedValue(config, val)
+	config.CacheInt64(int64(val))
 	return val, nil
-
 }
 
 func (c *client) GetByte(key string, defaultVal uint8) uint8 {
@@ -214,23 +645,26 @@ func (c *client) GetBoolean(key string, defaultVal bool) bool {
 	return val
 }
 
+func (c *client) GetBooleanE(key string) (bool, error) {
+	return c.getBoolean(key, false)
+}
+
 func (c *client) getBoolean(key string, defaultVal bool) (bool, error) {
 	config, err := c.sm.GetKey(key)
 	if err != nil {
 		return defaultVal, obserr.Annotate(err, "getBoolean: Error getting key from config")
 	}
-	pv := c.sm.GetParsedValue(config)
-	if pv != nil {
-		val, ok := pv.(bool)
-		if ok {
-			return val, nil
-		}
+	if err := checkType(config, model.TypeBool); err != nil {
+		return defaultVal, obserr.Annotate(err, "getBoolean: wrong type")
+	}
+	if val, ok := config.CachedBool(); ok {
+		return val, nil
 	}
 	var val bool
-	if err := c.Unmarshal(key, &val); err != nil {
+	if err := c.decode(key, config.RawValue, &val); err != nil {
 		return defaultVal, obserr.Annotate(err, "getBoolean: error unmarshalling")
 	}
-	c.sm.SetParsedValue(config, val)
+	config.CacheBool(val)
 	return val, nil
 }
 
@@ -245,27 +679,26 @@ func (c *client) GetInt64(key string, defaultVal int64) int64 {
 	return val
 }
 
+func (c *client) GetInt64E(key string) (int64, error) {
+	return c.getInt64(key, 0)
+}
+
 func (c *client) getInt64(key string, defaultVal int64) (int64, error) {
 	config, err := c.sm.GetKey(key)
 	if err != nil {
 		return defaultVal, obserr.Annotate(err, "getInt64: error getting key from config")
 	}
-	pv := c.sm.GetParsedValue(config)
-	if pv != nil {
-		switch val := pv.(type) {
-		case int64:
-			return val, nil
-		case int32:
-			return int64(val), nil
-		case int:
-			return int64(val), nil
-		}
+	if err := checkType(config, model.TypeInt64); err != nil {
+		return defaultVal, obserr.Annotate(err, "getInt64: wrong type")
+	}
+	if val, ok := config.CachedInt64(); ok {
+		return val, nil
 	}
 	var val int64
-	if err := c.Unmarshal(key, &val); err != nil {
+	if err := c.decode(key, config.RawValue, &val); err != nil {
 		return defaultVal, obserr.Annotate(err, "getInt64: error unmarshalling")
 	}
-	c.sm.SetParsedValue(config, val)
+	config.CacheInt64(val)
 	return val, nil
 }
 
@@ -280,25 +713,26 @@ func (c *client) GetFloat64(key string, defaultVal float64) float64 {
 	return val
 }
 
+func (c *client) GetFloat64E(key string) (float64, error) {
+	return c.getFloat64(key, 0)
+}
+
 func (c *client) getFloat64(key string, defaultVal float64) (float64, error) {
 	config, err := c.sm.GetKey(key)
 	if err != nil {
 		return defaultVal, obserr.Annotate(err, "getFloat64: error getting key")
 	}
-	pv := c.sm.GetParsedValue(config)
-	if pv != nil {
-		switch val := pv.(type) {
-		case float64:
-			return val, nil
-		case float32:
-			return float64(val), nil
-		}
+	if err := checkType(config, model.TypeFloat64, model.TypeInt64); err != nil {
+		return defaultVal, obserr.Annotate(err, "getFloat64: wrong type")
+	}
+	if val, ok := config.CachedFloat64(); ok {
+		return val, nil
 	}
 	var val float64
-	if err := c.Unmarshal(key, &val); err != nil {
+	if err := c.decode(key, config.RawValue, &val); err != nil {
 		return defaultVal, obserr.Annotate(err, "getFloat64: error unmarshalling")
 	}
-	c.sm.SetParsedValue(config, val)
+	config.CacheFloat64(val)
 	return val, nil
 
 }
@@ -314,22 +748,26 @@ func (c *client) GetString(key string, defaultVal string) string {
 	return val
 }
 
+func (c *client) GetStringE(key string) (string, error) {
+	return c.getString(key, "")
+}
+
 func (c *client) getString(key string, defaultVal string) (string, error) {
 	config, err := c.sm.GetKey(key)
 	if err != nil {
 		return defaultVal, obserr.Annotate(err, "getString: error getting key")
 	}
-	pv := c.sm.GetParsedValue(config)
-	if pv != nil {
-		if val, ok := pv.(string); ok {
-			return val, nil
-		}
+	if err := checkType(config, model.TypeString); err != nil {
+		return defaultVal, obserr.Annotate(err, "getString: wrong type")
+	}
+	if val, ok := config.CachedString(); ok {
+		return val, nil
 	}
 	var val string
-	if err := c.Unmarshal(key, &val); err != nil {
+	if err := c.decode(key, config.RawValue, &val); err != nil {
 		return defaultVal, obserr.Annotate(err, "getString: error unmarshalling")
 	}
-	c.sm.SetParsedValue(config, val)
+	config.CacheString(val)
 	return val, nil
 
 }
@@ -342,8 +780,39 @@ func (c *client) GetRaw(key string) ([]byte, error) {
 	return config.RawValue, nil
 }
 
-func defaultRng(seed int64) rnd {
-	return rand.New(rand.NewSource(seed))
+func (c *client) GetMany(keys ...string) (map[string]json.RawMessage, error) {
+	sm := c.sm.Snapshot()
+	vals := make(map[string]json.RawMessage, len(keys))
+	var missing []string
+	for _, key := range keys {
+		config, err := sm.GetKey(key)
+		if err != nil {
+			missing = append(missing, key)
+			continue
+		}
+		vals[key] = config.RawValue
+	}
+	if len(missing) > 0 {
+		return vals, obserr.Annotate(model.ErrNotFound, "GetMany: error getting keys").Set("keys", missing)
+	}
+	return vals, nil
+}
+
+func (c *client) Keys() []string {
+	return c.sm.Keys()
+}
+
+// HasKey does not count as a read of key
+func (c *client) HasKey(key string) bool {
+	_, err := c.lookup(key)
+	return err == nil
+}
+
+// lookup gets key for the client itself, e.g. to check that the key
+// exists: unlike the reads of the getters it is not observed, so it
+// is neither reported as a read nor as a read of a deprecated key
+func (c *client) lookup(key string) (*model.Config, error) {
+	return model.GetKeyUnobserved(c.sm, key)
 }
 
 func (c *client) IsFeatureEnabled(key string, enabledByDefault bool) bool {
@@ -357,16 +826,24 @@ func (c *client) rollDie(name string, enabledByDefault bool) bool {
 	}
 
 	// This can return error but will return default value
-	val := c.GetFloat64(name, defaultValue)
-	c.mu.Lock()
-	randomFloat := c.rng.Float64()
-	c.mu.Unlock()
-	return randomFloat < val
+	val := c.GetRolloutFraction(name, c.opts.now(), defaultValue)
+	result := c.rng.Float64() < val
+	c.expose(name, "", result)
+	return result
 }
 
+// IsProjectWhitelisted returns true if projectID is in the whitelist in key,
+// either a map keyed by project id or an object with inclusive ranges
+// of project ids and single ids, e.g.
+//
+//	{"ranges": [[1000, 1999], [5000, 5999]], "ids": [42]}
+//
+// Entries of the map may expire, e.g. for temporary exemptions:
+//
+//	{"123": {"expires": "2025-10-01T00:00:00Z"}}
 func (c *client) IsProjectWhitelisted(key string, projectID int64, defaultVal bool) bool {
 	fs := c.fr.ScopeName("is_project_whitelisted").WithSpan(context.Background())
-	val, err := c.isProjectWhitelisted(key, projectID, defaultVal)
+	val, err := c.isProjectListed(key, projectID, defaultVal)
 	if err != nil {
 		c.logErrGet(err, key, defaultVal, fs)
 		return defaultVal
@@ -374,9 +851,26 @@ func (c *client) IsProjectWhitelisted(key string, projectID int64, defaultVal bo
 	return val
 }
 
+// IsTokenWhitelisted returns true if token is in the whitelist in key,
+// with the globs and regular expressions of IsMemberWhitelisted
 func (c *client) IsTokenWhitelisted(key string, token string, defaultVal bool) bool {
 	fs := c.fr.ScopeName("is_token_whitelisted").WithSpan(context.Background())
-	val, err := c.isTokenWhitelisted(key, token, defaultVal)
+	val, err := c.isMemberListed(key, token, defaultVal)
+	if err != nil {
+		c.logErrGet(err, key, defaultVal, fs)
+		return defaultVal
+	}
+	return val
+}
+
+// IsMemberWhitelisted returns true if member is in the whitelist in key,
+// a map keyed by member like the token whitelists. Keys with * or ?
+// are globs, e.g. "internal-*", and keys between slashes are regular
+// expressions, e.g. "/^internal-[0-9]+$/". They are only matched
+// when member is not one of the keys.
+func (c *client) IsMemberWhitelisted(key string, member string, defaultVal bool) bool {
+	fs := c.fr.ScopeName("is_member_whitelisted").WithSpan(context.Background())
+	val, err := c.isMemberListed(key, member, defaultVal)
 	if err != nil {
 		c.logErrGet(err, key, defaultVal, fs)
 		return defaultVal
@@ -384,52 +878,199 @@ func (c *client) IsTokenWhitelisted(key string, token string, defaultVal bool) b
 	return val
 }
 
-func (c *client) isTokenWhitelisted(key string, token string, defaultVal bool) (bool, error) {
+// IsProjectBlacklisted returns true if projectID is in the deny list
+// in key, a map keyed by project id like the project whitelists
+func (c *client) IsProjectBlacklisted(key string, projectID int64, defaultVal bool) bool {
+	fs := c.fr.ScopeName("is_project_blacklisted").WithSpan(context.Background())
+	val, err := c.isProjectListed(key, projectID, defaultVal)
+	if err != nil {
+		c.logErrGet(err, key, defaultVal, fs)
+		return defaultVal
+	}
+	return val
+}
+
+// IsTokenBlacklisted returns true if token is in the deny list
+// in key, a map keyed by token like the token whitelists
+func (c *client) IsTokenBlacklisted(key string, token string, defaultVal bool) bool {
+	fs := c.fr.ScopeName("is_token_blacklisted").WithSpan(context.Background())
+	val, err := c.isMemberListed(key, token, defaultVal)
+	if err != nil {
+		c.logErrGet(err, key, defaultVal, fs)
+		return defaultVal
+	}
+	return val
+}
+
+// isMemberListed returns true if member is in the list of members in key
+func (c *client) isMemberListed(key string, member string, defaultVal bool) (bool, error) {
+	list, err := c.getMemberList(key)
+	if err != nil {
+		return defaultVal, obserr.Annotate(err, "isMemberListed: error getting the list")
+	}
+	return list.contains(member), nil
+}
+
+// getMemberList returns the parsed list of members in key
+func (c *client) getMemberList(key string) (*memberList, error) {
 	config, err := c.sm.GetKey(key)
 	if err != nil {
-		return defaultVal, obserr.Annotate(err, "isTokenWhitelisted: error getting key from sm")
+		return nil, obserr.Annotate(err, "getMemberList: error getting key from sm")
+	}
+	if err := checkType(config, model.TypeTokenSet); err != nil {
+		return nil, obserr.Annotate(err, "getMemberList: wrong type")
 	}
 	pv := c.sm.GetParsedValue(config)
 	if pv != nil {
 		switch val := pv.(type) {
-		case map[string]struct{}:
-			_, ok := val[token]
-			return ok, nil
+		case *memberList:
+			return val, nil
 		default:
 		}
 	}
-	val := make(map[string]struct{})
-	if err := c.unmarshalFn(config.RawValue, &val); err != nil {
-		return defaultVal, obserr.Annotate(err, "isTokenWhitelisted: error unmarshaling value")
+	list := &memberList{}
+	if err := c.decode(key, config.RawValue, list); err != nil {
+		return nil, obserr.Annotate(err, "getMemberList: error unmarshaling value")
+	}
+	c.learnParsed(key, ParsedMemberList)
+	c.sm.SetParsedValue(config, list)
+	return list, nil
+}
+
+// isProjectListed returns true if projectID is in the list of projects in key
+func (c *client) isProjectListed(key string, projectID int64, defaultVal bool) (bool, error) {
+	list, err := c.getProjectList(key)
+	if err != nil {
+		return defaultVal, obserr.Annotate(err, "isProjectListed: error getting the list")
 	}
-	c.sm.SetParsedValue(config, val)
-	_, ok := val[token]
-	return ok, nil
+	return list.contains(projectID, c.opts.now()), nil
 }
 
-func (c *client) isProjectWhitelisted(key string, projectID int64, defaultVal bool) (bool, error) {
+// getProjectList returns the parsed list of projects in key
+func (c *client) getProjectList(key string) (*projectList, error) {
 	config, err := c.sm.GetKey(key)
 	if err != nil {
-		return defaultVal, obserr.Annotate(err, "isProjectWhitelisted: error getting key from sm")
+		return nil, obserr.Annotate(err, "getProjectList: error getting key from sm")
+	}
+	if err := checkType(config, model.TypeProjectSet); err != nil {
+		return nil, obserr.Annotate(err, "getProjectList: wrong type")
 	}
 	pv := c.sm.GetParsedValue(config)
 	if pv != nil {
 		switch val := pv.(type) {
-		case map[int64]struct{}:
-			_, ok := val[projectID]
-			return ok, nil
+		case *projectList:
+			return val, nil
 		default:
 		}
 	}
-	val := make(map[int64]struct{})
-	if err := c.unmarshalFn(config.RawValue, &val); err != nil {
-		return defaultVal, obserr.Annotate(err, "isProjectWhitelisted: error unmarshaling value")
+	list := &projectList{}
+	if err := c.decode(key, config.RawValue, list); err != nil {
+		return nil, obserr.Annotate(err, "getProjectList: error unmarshaling value")
+	}
+	c.learnParsed(key, ParsedProjectList)
+	c.sm.SetParsedValue(config, list)
+	return list, nil
+}
+
+// GetProjectWhitelist returns the projects in the whitelist in key,
+// without the expired ones, e.g. for batch jobs iterating the
+// whitelist. The view shares the parsed list, nothing is copied.
+// Whitelists with ranges can not be listed.
+func (c *client) GetProjectWhitelist(key string) (ProjectWhitelist, error) {
+	list, err := c.getProjectList(key)
+	if err != nil {
+		return ProjectWhitelist{}, obserr.Annotate(err, "GetProjectWhitelist: error getting the list").Set("key", key)
+	}
+	projects, err := list.whitelist(c.opts.now())
+	if err != nil {
+		return ProjectWhitelist{}, obserr.Annotate(err, "GetProjectWhitelist: error listing the projects").Set("key", key)
+	}
+	return projects, nil
+}
+
+// GetTokenWhitelist returns the tokens in the whitelist in key.
+// Whitelists with globs or regular expressions can not be listed.
+func (c *client) GetTokenWhitelist(key string) (map[string]struct{}, error) {
+	list, err := c.getMemberList(key)
+	if err != nil {
+		return nil, obserr.Annotate(err, "GetTokenWhitelist: error getting the list").Set("key", key)
+	}
+	tokens, err := list.set()
+	if err != nil {
+		return nil, obserr.Annotate(err, "GetTokenWhitelist: error listing the tokens").Set("key", key)
+	}
+	return tokens, nil
+}
+
+func (c *client) Subscribe(key string, fn func(old, new []byte)) func() {
+	return c.sm.Subscribe(key, fn)
+}
+
+func (c *client) SubscribeDiff(fn func(model.Diff)) func() {
+	return c.sm.OnDiff(fn)
+}
+
+// derive returns a client sharing the settings of c reading from sm
+func (c *client) derive(sm model.StateManager) *client {
+	return &client{
+		fr:          c.fr,
+		sm:          sm,
+		unmarshalFn: c.unmarshalFn,
+		rng:         pooledRnd{},
+		opts:        c.opts,
+		overrides:   c.overrides,
+		defaults:    c.defaults,
+		prefix:      c.prefix,
+		decoders:    c.decoders,
+		version:     c.version,
+		usage:       c.usage,
+		health:      c.health,
+		preparser:   c.preparser,
 	}
-	c.sm.SetParsedValue(config, val)
-	_, ok := val[projectID]
-	return ok, nil
 }
 
+func (c *client) Snapshot() Snapshot {
+	return c.derive(c.sm.Snapshot())
+}
+
+func (c *client) WithPrefix(prefix string) Client {
+	pc := c.derive(model.NewPrefixStateManager(c.sm, prefix))
+	pc.prefix = c.prefix + prefix
+	return pc
+}
+
+// SetOverride overrides key with raw in this process only. The
+// override is cleared after ttl, or never if ttl is not positive.
+func (c *client) SetOverride(key string, raw []byte, ttl time.Duration) {
+	c.overrides.Set(c.prefix+key, raw, ttl)
+}
+
+// ClearOverride clears the override set by SetOverride
+func (c *client) ClearOverride(key string) {
+	c.overrides.Clear(c.prefix + key)
+}
+
+// Reload reads the configs again without waiting for the source to
+// notify a change, e.g. for an admin endpoint. The configs are only
+// reloaded if they changed. Keys that are not valid are not loaded
+// and do not fail the reload.
+func (c *client) Reload() error {
+	return c.sm.Reload()
+}
+
+// Close stops the watchers of the configs and the watches of the
+// client, and returns once the callbacks and subscribers in flight
+// returned. It must not be called from a callback.
 func (c *client) Close() {
-	c.sm.Close()
+	c.life.close(func() {
+		for _, fn := range c.onClose {
+			fn()
+		}
+		c.sm.Close()
+	})
+}
+
+// Done returns a channel closed once Close returned
+func (c *client) Done() <-chan struct{} {
+	return c.life.doneChan()
 }
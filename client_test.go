@@ -1,6 +1,7 @@
 package configmanager
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -16,6 +17,7 @@ import (
 	"github.com/mixpanel/configmanager/model"
 
 	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -106,16 +108,14 @@ func withFixture(t *testing.T, persist *model.State, fn func(f *fixture)) {
 	ns := getNs()
 	writePersistToFile(t, persist, dir, ns)
 
-	c, err := NewClient(dir, ns, obs.NullFR)
+	cu := &countUnmarshal{}
+	c, err := NewClient(dir, ns, obs.NullFR, WithUnmarshal(cu.unmarshal))
 	require.NoError(t, err)
 	defer c.Close()
 
 	cc, ok := c.(*client)
 	assert.True(t, ok)
 
-	cu := &countUnmarshal{}
-	cc.unmarshalFn = cu.unmarshal
-
 	f := &fixture{
 		dir: dir,
 		c:   c,
@@ -221,6 +221,12 @@ func TestByte(t *testing.T) {
 
 		val = c.GetByte("baz", 0)
 		assert.EqualValues(t, val, 0)
+
+		// the bytes and the int64s share the cached value
+		assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+		assert.EqualValues(t, 256, c.GetInt64("baz", 0))
+		assert.EqualValues(t, 0, c.GetByte("baz", 0))
+		assert.EqualValues(t, f.cu.count(), 5)
 	})
 }
 
@@ -285,6 +291,142 @@ func TestProjectWhitelisted(t *testing.T) {
 	})
 }
 
+func TestProjectWhitelistedRanges(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "cohorts", map[string]interface{}{
+				"ranges": [][2]int64{{5000, 5999}, {1000, 1999}, {1500, 2500}},
+				"ids":    []int64{42},
+			}),
+			cfg(t, "inverted", map[string]interface{}{
+				"ranges": [][2]int64{{1999, 1000}},
+			}),
+		},
+	}
+	withFixture(t, persist, func(f *fixture) {
+		cc := f.cc
+		for i := 0; i < 5; i++ {
+			assert.True(t, cc.IsProjectWhitelisted("cohorts", 42, false))
+			assert.True(t, cc.IsProjectWhitelisted("cohorts", 1000, false))
+			assert.True(t, cc.IsProjectWhitelisted("cohorts", 2200, false))
+			assert.True(t, cc.IsProjectWhitelisted("cohorts", 2500, false))
+			assert.True(t, cc.IsProjectWhitelisted("cohorts", 5999, false))
+			assert.False(t, cc.IsProjectWhitelisted("cohorts", 999, true))
+			assert.False(t, cc.IsProjectWhitelisted("cohorts", 2501, true))
+			assert.False(t, cc.IsProjectWhitelisted("cohorts", 6000, true))
+		}
+		assert.EqualValues(t, f.cu.count(), 1)
+		assert.True(t, cc.IsProjectWhitelisted("inverted", 1500, true))
+		assert.False(t, cc.IsProjectWhitelisted("inverted", 1500, false))
+	})
+}
+
+func TestProjectWhitelistedExpiry(t *testing.T) {
+	now := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	client := NewTestClient(WithNow(func() time.Time { return now }))
+	client.setValue("exemptions", map[string]interface{}{
+		"1": map[string]interface{}{},
+		"2": map[string]interface{}{"expires": "2025-10-01T00:00:00Z"},
+		"3": map[string]interface{}{"expires": "2025-08-01T00:00:00Z"},
+	})
+	client.setValue("invalid", map[string]interface{}{
+		"1": map[string]interface{}{"expires": "tomorrow"},
+	})
+
+	assert.True(t, client.IsProjectWhitelisted("exemptions", 1, false))
+	assert.True(t, client.IsProjectWhitelisted("exemptions", 2, false))
+	assert.False(t, client.IsProjectWhitelisted("exemptions", 3, true))
+	assert.True(t, client.IsProjectWhitelisted("invalid", 1, true))
+	assert.False(t, client.IsProjectWhitelisted("invalid", 1, false))
+
+	now = time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	assert.True(t, client.IsProjectWhitelisted("exemptions", 1, false))
+	assert.False(t, client.IsProjectWhitelisted("exemptions", 2, true))
+}
+
+func TestMemberWhitelisted(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "hosts", map[string]struct{}{
+				"ingest-1.local": {},
+				"ingest-2.local": {},
+			}),
+		},
+	}
+	withFixture(t, persist, func(f *fixture) {
+		cc := f.cc
+		for i := 0; i < 5; i++ {
+			assert.True(t, cc.IsMemberWhitelisted("hosts", "ingest-1.local", false))
+			assert.False(t, cc.IsMemberWhitelisted("hosts", "ingest-3.local", true))
+			assert.True(t, cc.IsTokenWhitelisted("hosts", "ingest-2.local", false))
+		}
+		assert.EqualValues(t, f.cu.count(), 1)
+		assert.True(t, cc.IsMemberWhitelisted("missing", "ingest-1.local", true))
+	})
+
+	client := NewTestClient().SetMembersWhitelist("orgs", "acme")
+	assert.True(t, client.IsMemberWhitelisted("orgs", "acme", false))
+	assert.False(t, client.IsMemberWhitelisted("orgs", "globex", false))
+}
+
+func TestMemberWhitelistedPatterns(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "tokens", map[string]struct{}{
+				"abc":             {},
+				"internal-*":      {},
+				"qa-?":            {},
+				"/^load-[0-9]+$/": {},
+				"literal.dot":     {},
+			}),
+			cfg(t, "invalid", map[string]struct{}{
+				"/[/": {},
+			}),
+		},
+	}
+	withFixture(t, persist, func(f *fixture) {
+		cc := f.cc
+		for i := 0; i < 5; i++ {
+			assert.True(t, cc.IsTokenWhitelisted("tokens", "abc", false))
+			assert.True(t, cc.IsTokenWhitelisted("tokens", "internal-", false))
+			assert.True(t, cc.IsTokenWhitelisted("tokens", "internal-etl", false))
+			assert.False(t, cc.IsTokenWhitelisted("tokens", "external-etl", true))
+			assert.True(t, cc.IsTokenWhitelisted("tokens", "qa-1", false))
+			assert.False(t, cc.IsTokenWhitelisted("tokens", "qa-12", true))
+			assert.True(t, cc.IsTokenWhitelisted("tokens", "load-42", false))
+			assert.False(t, cc.IsTokenWhitelisted("tokens", "load-x", true))
+			assert.False(t, cc.IsTokenWhitelisted("tokens", "literalxdot", true))
+		}
+		assert.EqualValues(t, f.cu.count(), 1)
+		assert.True(t, cc.IsTokenWhitelisted("invalid", "abc", true))
+		assert.False(t, cc.IsTokenWhitelisted("invalid", "abc", false))
+	})
+}
+
+func TestBlacklisted(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "bad_projects", map[int]struct{}{
+				3: {},
+			}),
+			cfg(t, "bad_tokens", map[string]struct{}{
+				"abc": {},
+			}),
+		},
+	}
+	withFixture(t, persist, func(f *fixture) {
+		cc := f.cc
+		for i := 0; i < 5; i++ {
+			assert.True(t, cc.IsProjectBlacklisted("bad_projects", 3, false))
+			assert.False(t, cc.IsProjectBlacklisted("bad_projects", 4, true))
+		}
+		assert.EqualValues(t, f.cu.count(), 1)
+		assert.True(t, cc.IsTokenBlacklisted("bad_tokens", "abc", false))
+		assert.False(t, cc.IsTokenBlacklisted("bad_tokens", "def", true))
+		assert.True(t, cc.IsTokenBlacklisted("missing", "abc", true))
+	})
+}
+
 func TestMultiThreadedGet(t *testing.T) {
 	persist := &model.State{
 		Configs: []*model.Config{
@@ -338,3 +480,684 @@ func TestClientWithDummy(t *testing.T) {
 	assert.True(t, client.IsProjectWhitelisted("blah", 1, false))
 	assert.True(t, client.IsProjectWhitelisted("blah", 2, false))
 }
+
+func TestGetE(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "bool", true),
+			cfg(t, "int", 3),
+			cfg(t, "byte", 7),
+			cfg(t, "float", 0.5),
+			cfg(t, "string", "hello"),
+		},
+	}
+	withFixture(t, persist, func(f *fixture) {
+		c := f.c
+
+		b, err := c.GetBooleanE("bool")
+		assert.NoError(t, err)
+		assert.True(t, b)
+		i, err := c.GetInt64E("int")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, i)
+		by, err := c.GetByteE("byte")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 7, by)
+		fl, err := c.GetFloat64E("float")
+		assert.NoError(t, err)
+		assert.EqualValues(t, 0.5, fl)
+		s, err := c.GetStringE("string")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", s)
+
+		_, err = c.GetInt64E("missing")
+		assert.Error(t, err)
+		assert.True(t, IsNotFound(err))
+
+		_, err = c.GetInt64E("string")
+		assert.Error(t, err)
+		assert.False(t, IsNotFound(err))
+	})
+}
+
+func TestStrictTypes(t *testing.T) {
+	var mismatched []string
+	c := NewTestClient(WithTypeMismatchHandler(func(key string, err error) {
+		assert.Error(t, err)
+		mismatched = append(mismatched, key)
+	})).
+		SetBoolean("bar", true).
+		SetInt64("foo", 1)
+
+	assert.EqualValues(t, 1, c.GetInt64("foo", 2))
+	assert.EqualValues(t, 2, c.GetInt64("bar", 2))
+	assert.EqualValues(t, 2, c.GetInt64("missing", 2))
+	assert.Equal(t, []string{"bar"}, mismatched)
+
+	c = NewTestClient(WithTypeMismatchHandler(func(key string, err error) {
+		panic(err)
+	})).SetBoolean("bar", true)
+	assert.Panics(t, func() { c.GetInt64("bar", 2) })
+}
+
+func TestRequiredKeys(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "foo", 1),
+			cfg(t, "bar", 2),
+		},
+	}
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, persist, dir, ns)
+
+	c, err := NewClient(dir, ns, obs.NullFR, WithRequiredKeys("foo", "bar"))
+	require.NoError(t, err)
+	c.Close()
+
+	ns = getNs()
+	writePersistToFile(t, persist, dir, ns)
+	_, err = NewClient(dir, ns, obs.NullFR, WithRequiredKeys("foo", "baz"))
+	require.Error(t, err)
+	assert.Equal(t, ErrMissingRequiredKeys, obserr.Original(err))
+}
+
+func TestKeys(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "foo", 1),
+			cfg(t, "bar", 2),
+		},
+	}
+	withFixture(t, persist, func(f *fixture) {
+		assert.Equal(t, []string{"bar", "foo"}, f.c.Keys())
+		assert.True(t, f.c.HasKey("foo"))
+		assert.False(t, f.c.HasKey("baz"))
+	})
+
+	c := NewTestClient().SetInt64("foo", 1)
+	assert.Equal(t, []string{"foo"}, c.Keys())
+	assert.Empty(t, NewNullClient().Keys())
+}
+
+func TestSnapshot(t *testing.T) {
+	c := NewTestClient().
+		SetInt64("rate_limit", 10).
+		SetInt64("rate_burst", 20)
+
+	snap := c.Snapshot()
+	c.SetInt64("rate_limit", 100).SetInt64("rate_burst", 200)
+
+	assert.EqualValues(t, 10, snap.GetInt64("rate_limit", 0))
+	assert.EqualValues(t, 20, snap.GetInt64("rate_burst", 0))
+	assert.EqualValues(t, 100, c.GetInt64("rate_limit", 0))
+	assert.EqualValues(t, 200, c.GetInt64("rate_burst", 0))
+}
+
+func TestGetMany(t *testing.T) {
+	c := NewTestClient().
+		SetInt64("rate_limit", 10).
+		SetInt64("rate_burst", 20)
+
+	vals, err := c.GetMany("rate_limit", "rate_burst")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]json.RawMessage{
+		"rate_limit": json.RawMessage("10"),
+		"rate_burst": json.RawMessage("20"),
+	}, vals)
+
+	vals, err = c.GetMany("rate_limit", "missing")
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, map[string]json.RawMessage{
+		"rate_limit": json.RawMessage("10"),
+	}, vals)
+}
+
+func TestSubscribe(t *testing.T) {
+	c := NewTestClient().SetInt64("foo", 1)
+
+	type change struct{ old, new string }
+	var changes []change
+	cancel := c.Subscribe("foo", func(old, new []byte) {
+		changes = append(changes, change{string(old), string(new)})
+	})
+
+	c.SetInt64("foo", 2).
+		SetInt64("bar", 3).
+		SetInt64("foo", 2)
+	cancel()
+	c.SetInt64("foo", 4)
+
+	assert.Equal(t, []change{{"1", "2"}}, changes)
+}
+
+func TestOnReload(t *testing.T) {
+	var summaries []ReloadSummary
+	c := NewTestClient(WithOnReload(func(s ReloadSummary) {
+		summaries = append(summaries, s)
+	}))
+	c.SetInt64("foo", 1).SetInt64("bar", 2)
+
+	require.Len(t, summaries, 2)
+	assert.Equal(t, []string{"foo"}, summaries[0].Keys)
+	assert.Equal(t, []string{"bar", "foo"}, summaries[1].Keys)
+	assert.False(t, summaries[1].LoadedAt.IsZero())
+
+	c.Close()
+	c.SetInt64("baz", 3)
+	assert.Len(t, summaries, 2)
+}
+
+func TestMultiScopeClient(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	global, ingest := getNs(), getNs()
+	writePersistToFile(t, &model.State{
+		Configs: []*model.Config{
+			cfg(t, "kill_switch", true),
+			cfg(t, "timeout", 1),
+		},
+	}, dir, global)
+	writePersistToFile(t, &model.State{
+		Configs: []*model.Config{
+			cfg(t, "timeout", 2),
+			cfg(t, "batch_size", 100),
+		},
+	}, dir, ingest)
+
+	c, err := NewMultiScopeClient(dir, []string{global, ingest}, obs.NullFR)
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.True(t, c.GetBoolean("kill_switch", false))
+	assert.EqualValues(t, 2, c.GetInt64("timeout", 0))
+	assert.EqualValues(t, 100, c.GetInt64("batch_size", 0))
+	assert.Equal(t, []string{"batch_size", "kill_switch", "timeout"}, c.Keys())
+
+	_, err = NewMultiScopeClient(dir, []string{getNs()}, obs.NullFR)
+	assert.Error(t, err)
+}
+
+func TestFallbackScope(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	global, service := getNs(), getNs()
+	writePersistToFile(t, &model.State{
+		Configs: []*model.Config{
+			cfg(t, "kill_switch", true),
+			cfg(t, "timeout", 1),
+		},
+	}, dir, global)
+	writePersistToFile(t, &model.State{
+		Configs: []*model.Config{
+			cfg(t, "timeout", 2),
+		},
+	}, dir, service)
+
+	c, err := NewClient(dir, service, obs.NullFR, WithFallbackScope(global))
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.True(t, c.GetBoolean("kill_switch", false))
+	assert.EqualValues(t, 2, c.GetInt64("timeout", 0))
+}
+
+func TestOverrides(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "foo", 1),
+			cfg(t, "bar", 2),
+		},
+	}
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, persist, dir, ns)
+	overridesPath := path.Join(dir, ns, model.OverridesFileName)
+	require.NoError(t, ioutil.WriteFile(overridesPath, []byte(`[{"key": "foo", "value": 3}]`), 0777))
+
+	c, err := NewClient(dir, ns, obs.NullFR, WithOverridesFile(""))
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.EqualValues(t, 3, c.GetInt64("foo", 0))
+	assert.EqualValues(t, 2, c.GetInt64("bar", 0))
+
+	changed := make(chan struct{}, 10)
+	defer c.Subscribe("foo", func(_, _ []byte) { changed <- struct{}{} })()
+	data, err := json.Marshal([]*model.Config{})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(overridesPath, data, 0777))
+	<-changed
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+}
+
+// the overrides file is optional, it is loaded once created
+func TestOverridesMissing(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "foo", 1),
+		},
+	}
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, persist, dir, ns)
+	c, err := NewClient(dir, ns, obs.NullFR, WithOverridesFile(""))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+	assert.NoError(t, c.Healthy(context.Background()))
+	require.NoError(t, c.Reload())
+
+	changed := make(chan []byte, 10)
+	defer c.Subscribe("foo", func(_, new []byte) { changed <- new })()
+	overridesPath := path.Join(dir, ns, model.OverridesFileName)
+	require.NoError(t, ioutil.WriteFile(overridesPath, []byte(`[{"key": "foo", "value": 3}]`), 0777))
+	assert.Equal(t, "3", string(<-changed))
+
+	// the overrides are dropped with the file
+	require.NoError(t, os.Remove(overridesPath))
+	require.NoError(t, c.Reload())
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+	assert.NoError(t, c.Healthy(context.Background()))
+}
+
+func TestEnvironment(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "foo", 1),
+			cfg(t, "bar", 2),
+		},
+	}
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, persist, dir, ns)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ns, "configs.staging.json"), []byte(`[{"key": "foo", "value": 3}]`), 0777))
+
+	c, err := NewClient(dir, ns, obs.NullFR, WithEnvironment("staging"))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 3, c.GetInt64("foo", 0))
+	assert.EqualValues(t, 2, c.GetInt64("bar", 0))
+
+	// the overlay is optional
+	ns = getNs()
+	writePersistToFile(t, persist, dir, ns)
+	c, err = NewClient(dir, ns, obs.NullFR, WithEnvironment("staging"))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+}
+
+func TestFragments(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "foo", 1),
+			cfg(t, "bar", 2),
+		},
+	}
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, persist, dir, ns)
+	fragments := path.Join(dir, ns, model.FragmentsDirName)
+	require.NoError(t, os.MkdirAll(fragments, 0777))
+	require.NoError(t, ioutil.WriteFile(path.Join(fragments, "a.json"), []byte(`[{"key": "foo", "value": 3}, {"key": "baz", "value": 4}]`), 0777))
+	require.NoError(t, ioutil.WriteFile(path.Join(fragments, "b.json"), []byte(`[{"key": "foo", "value": 5}]`), 0777))
+	require.NoError(t, ioutil.WriteFile(path.Join(fragments, "README"), []byte("not configs"), 0777))
+
+	c, err := NewClient(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 5, c.GetInt64("foo", 0))
+	assert.EqualValues(t, 2, c.GetInt64("bar", 0))
+	assert.EqualValues(t, 4, c.GetInt64("baz", 0))
+
+	changed := make(chan struct{}, 10)
+	defer c.Subscribe("foo", func(_, _ []byte) { changed <- struct{}{} })()
+	require.NoError(t, ioutil.WriteFile(path.Join(fragments, "b.json"), []byte(`[]`), 0777))
+	<-changed
+	assert.EqualValues(t, 3, c.GetInt64("foo", 0))
+}
+
+// the fragments added to configs.d are loaded and
+// the configs of the fragments removed are dropped
+func TestFragmentsWatched(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "foo", 1),
+		},
+	}
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, persist, dir, ns)
+	fragments := path.Join(dir, ns, model.FragmentsDirName)
+	require.NoError(t, os.MkdirAll(fragments, 0777))
+	require.NoError(t, ioutil.WriteFile(path.Join(fragments, "a.json"), []byte(`[{"key": "foo", "value": 3}]`), 0777))
+
+	c, err := NewClient(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 3, c.GetInt64("foo", 0))
+
+	changed := make(chan []byte, 10)
+	defer c.Subscribe("foo", func(_, new []byte) { changed <- new })()
+	// the fragment is written next to configs.d and moved in
+	tmp := path.Join(dir, ns, "b.json")
+	require.NoError(t, ioutil.WriteFile(tmp, []byte(`[{"key": "foo", "value": 5}]`), 0777))
+	require.NoError(t, os.Rename(tmp, path.Join(fragments, "b.json")))
+	assert.Equal(t, "5", string(<-changed))
+
+	require.NoError(t, os.Remove(path.Join(fragments, "b.json")))
+	assert.Equal(t, "3", string(<-changed))
+	require.NoError(t, c.Reload())
+	assert.NoError(t, c.Healthy(context.Background()))
+
+	// the error of a broken fragment is dropped with the fragment,
+	// the last one removed drops all the configs of configs.d
+	require.NoError(t, ioutil.WriteFile(path.Join(fragments, "a.json"), []byte(`[{"key": "foo", "val`), 0777))
+	require.Eventually(t, func() bool { return c.Healthy(context.Background()) != nil }, 5*time.Second, time.Millisecond)
+	require.NoError(t, os.Remove(path.Join(fragments, "a.json")))
+	assert.Equal(t, "1", string(<-changed))
+	require.NoError(t, c.Reload())
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+	assert.NoError(t, c.Healthy(context.Background()))
+}
+
+func TestWithPrefix(t *testing.T) {
+	c := NewTestClient().
+		SetInt64("kafka.batch_size", 100).
+		SetString("kafka.topic", "events").
+		SetInt64("batch_size", 1)
+
+	kafka := c.WithPrefix("kafka.")
+	assert.EqualValues(t, 100, kafka.GetInt64("batch_size", 0))
+	assert.Equal(t, "events", kafka.GetString("topic", ""))
+	assert.Equal(t, []string{"batch_size", "topic"}, kafka.Keys())
+
+	var changed []string
+	defer kafka.Subscribe("topic", func(_, new []byte) {
+		changed = append(changed, string(new))
+	})()
+	c.SetString("kafka.topic", "people").SetString("topic", "other")
+	assert.Equal(t, []string{`"people"`}, changed)
+
+	kafka.Close()
+	assert.EqualValues(t, 1, c.GetInt64("batch_size", 0))
+}
+
+func TestSetOverride(t *testing.T) {
+	c := NewTestClient().SetInt64("foo", 1)
+
+	c.SetOverride("foo", []byte("2"), time.Hour)
+	assert.EqualValues(t, 2, c.GetInt64("foo", 0))
+	c.SetInt64("foo", 3)
+	assert.EqualValues(t, 2, c.GetInt64("foo", 0))
+	c.ClearOverride("foo")
+	assert.EqualValues(t, 3, c.GetInt64("foo", 0))
+
+	expired := make(chan struct{})
+	defer c.Subscribe("bar", func(old, new []byte) {
+		if new == nil {
+			close(expired)
+		}
+	})()
+	c.WithPrefix("b").SetOverride("ar", []byte("4"), 10*time.Millisecond)
+	assert.EqualValues(t, 4, c.GetInt64("bar", 0))
+	<-expired
+	assert.EqualValues(t, 0, c.GetInt64("bar", 0))
+}
+
+func TestDeclaredTypes(t *testing.T) {
+	c := NewTestClient()
+	c.dm.SetConfig(&model.Config{Key: "ratio", RawValue: []byte("1"), Type: model.TypeFloat64})
+	c.dm.SetConfig(&model.Config{Key: "count", RawValue: []byte("1"), Type: model.TypeInt64})
+	c.dm.SetConfig(&model.Config{Key: "projects", RawValue: []byte(`{"1": {}}`), Type: model.TypeProjectSet})
+
+	assert.EqualValues(t, 1, c.GetFloat64("ratio", 0))
+	assert.EqualValues(t, 5, c.GetInt64("ratio", 5))
+	// int64 configs can be read as float64
+	assert.EqualValues(t, 1, c.GetFloat64("count", 0))
+	assert.EqualValues(t, 1, c.GetInt64("count", 0))
+	assert.Equal(t, "default", c.GetString("count", "default"))
+
+	assert.True(t, c.IsProjectWhitelisted("projects", 1, false))
+	assert.False(t, c.IsTokenWhitelisted("projects", "1", false))
+
+	_, err := c.GetInt64E("ratio")
+	assert.Equal(t, model.ErrWrongType, obserr.Original(err))
+}
+
+func TestStartupTimeout(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	require.NoError(t, os.Mkdir(path.Join(dir, ns), 0777))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ns, "configs.json"), []byte(`[{"key": "foo", "val`), 0777))
+	_, err := NewClient(dir, ns, obs.NullFR, WithStartupTimeout(50*time.Millisecond))
+	assert.Error(t, err)
+
+	ns = getNs()
+	require.NoError(t, os.Mkdir(path.Join(dir, ns), 0777))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ns, "configs.json"), []byte(`[{"key": "foo", "val`), 0777))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = NewClientContext(ctx, dir, ns, obs.NullFR)
+	assert.Equal(t, context.DeadlineExceeded, obserr.Original(err))
+
+	ns = getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	c, err := NewClientContext(context.Background(), dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+}
+
+func TestReload(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	c, err := NewClient(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+
+	filePath := path.Join(dir, ns, "configs.json")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`[{"key": "foo", "value": 2}]`), 0777))
+	require.NoError(t, c.Reload())
+	assert.EqualValues(t, 2, c.GetInt64("foo", 0))
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`[{"key": "foo", "val`), 0777))
+	assert.Error(t, c.Reload())
+	assert.EqualValues(t, 2, c.GetInt64("foo", 0))
+}
+
+func TestCloseDone(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	c, err := NewClient(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+
+	ch, _ := c.WatchRaw("foo")
+	assert.Equal(t, "1", string(<-ch))
+
+	started := make(chan struct{})
+	var finished int32
+	c.Subscribe("foo", func(old, new []byte) {
+		close(started)
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+	})
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ns, "configs.json"), []byte(`[{"key": "foo", "value": 2}]`), 0777))
+	go c.Reload()
+	<-started
+
+	select {
+	case <-c.Done():
+		t.Fatal("Done is closed before Close")
+	default:
+	}
+	c.Close()
+	// the subscriber in flight returned
+	assert.EqualValues(t, 1, atomic.LoadInt32(&finished))
+	<-c.Done()
+	// the watch is stopped
+	for range ch {
+	}
+	c.Close()
+}
+
+func TestFallbackCause(t *testing.T) {
+	c := NewTestClient()
+	c.SetString("name", "x")
+	c.dm.SetConfig(&model.Config{Key: "ratio", RawValue: []byte("1.5"), Type: model.TypeFloat64})
+
+	_, err := c.GetInt64E("missing")
+	assert.Equal(t, "not_found", fallbackCause(err))
+	_, err = c.GetInt64E("ratio")
+	assert.Equal(t, "wrong_type", fallbackCause(err))
+	_, err = c.GetInt64E("name")
+	assert.Equal(t, "invalid_value", fallbackCause(err))
+}
+
+func TestErrorHandler(t *testing.T) {
+	type handled struct {
+		key      string
+		notFound bool
+	}
+	var errs []handled
+	c := NewTestClient(WithErrorHandler(func(err error, key string) {
+		errs = append(errs, handled{key, IsNotFound(err)})
+	}))
+	c.SetString("name", "x")
+
+	assert.EqualValues(t, 1, c.GetInt64("missing", 1))
+	assert.EqualValues(t, 2, c.GetInt64("name", 2))
+	assert.Equal(t, "x", c.GetString("name", ""))
+	assert.Equal(t, []handled{{"missing", true}, {"name", false}}, errs)
+
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	loadErrs := make(chan error, 10)
+	fc, err := NewClient(dir, ns, obs.NullFR, WithErrorHandler(func(err error, key string) {
+		if key == "" {
+			loadErrs <- err
+		}
+	}))
+	require.NoError(t, err)
+	defer fc.Close()
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ns, "configs.json"), []byte(`[{"key": "foo", "val`), 0777))
+	assert.Error(t, fc.Reload())
+	assert.Error(t, <-loadErrs)
+}
+
+// BenchmarkGetHotKey reads the same key of every scalar type, the
+// values are parsed on the first read only
+func BenchmarkGetHotKey(b *testing.B) {
+	c := NewTestClient().
+		SetBoolean("bool", true).
+		SetInt64("int64", 1<<40).
+		SetFloat64("float64", 0.5).
+		SetString("string", "foo")
+	for _, bc := range []struct {
+		name string
+		get  func()
+	}{
+		{"bool", func() { c.GetBoolean("bool", false) }},
+		{"int64", func() { c.GetInt64("int64", 0) }},
+		{"float64", func() { c.GetFloat64("float64", 0) }},
+		{"string", func() { c.GetString("string", "") }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					bc.get()
+				}
+			})
+		})
+	}
+}
+
+func TestNewClientWithOptions(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	_, err := NewClientWithOptions(dir, ns, WithRequiredKeys("bar"))
+	require.Error(t, err)
+
+	updates := make(chan ReloadSummary, 1)
+	c, err := NewClientWithOptions(dir, ns,
+		WithFlightRecorder(obs.NullFR),
+		WithRequiredKeys("foo"),
+		WithUpdateChannel(updates))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ns, "configs.json"), []byte(`[{"key": "foo", "value": 2}]`), 0777))
+	select {
+	case summary := <-updates:
+		assert.Equal(t, []string{"foo"}, summary.Keys)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update after the reload")
+	}
+	assert.EqualValues(t, 2, c.GetInt64("foo", 0))
+}
+
+func TestReaderInterfaces(t *testing.T) {
+	c := NewTestClient().
+		SetFloat64("on", 1).
+		SetInt64("foo", 2).
+		SetProjectsWhitelist("projects", 1)
+
+	// the views of the client have all the pieces of Reader
+	var flags FlagEvaluator = c
+	var whitelists WhitelistChecker = c.WithPrefix("")
+	var getters TypedGetter = c.Snapshot()
+	var raw RawReader = c.Snapshot()
+	assert.True(t, flags.IsFeatureEnabled("on", false))
+	assert.True(t, whitelists.IsProjectWhitelisted("projects", 1, false))
+	assert.EqualValues(t, 2, getters.GetInt64("foo", 0))
+	assert.Equal(t, []string{"foo", "on", "projects"}, raw.Keys())
+}
+
+func TestNewClientFromStateManager(t *testing.T) {
+	dm := model.NewDummyStateManager()
+	dm.SetConfig(&model.Config{Key: "foo", RawValue: []byte("1")})
+	_, err := NewClientFromStateManager(dm, obs.NullFR, WithRequiredKeys("bar"))
+	require.Error(t, err)
+
+	c, err := NewClientFromStateManager(dm, obs.NullFR,
+		WithRequiredKeys("foo"),
+		WithFlagOverrides(FlagOverrides{"flag": "1"}))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+	assert.True(t, c.IsFeatureEnabled("flag", false))
+
+	dm.SetConfig(&model.Config{Key: "foo", RawValue: []byte("2")})
+	assert.EqualValues(t, 2, c.GetInt64("foo", 0))
+}
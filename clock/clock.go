@@ -0,0 +1,198 @@
+// Package clock abstracts the time for the time-dependent behaviour of
+// configmanager, e.g. the expiry of the overrides, the debouncing of the
+// reloads and the resync of the files, so that it can be tested with a
+// Fake clock instead of sleeping.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and schedules the timers
+type Clock interface {
+	Now() time.Time
+	// NewTicker is time.NewTicker
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc is time.AfterFunc
+	AfterFunc(d time.Duration, fn func()) Timer
+}
+
+// Ticker is a time.Ticker of a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer is a time.Timer of AfterFunc
+type Timer interface {
+	// Stop prevents the timer from firing, it returns
+	// false if the timer already fired or was stopped
+	Stop() bool
+}
+
+// After is time.After on clk. Stopping the Timer
+// releases it if the channel is not received from.
+func After(clk Clock, d time.Duration) (<-chan time.Time, Timer) {
+	c := make(chan time.Time, 1)
+	t := clk.AfterFunc(d, func() {
+		c <- clk.Now()
+	})
+	return c, t
+}
+
+// Real is the Clock of the time package
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, fn func()) Timer {
+	return time.AfterFunc(d, fn)
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// Fake is a Clock whose time only moves with Advance. The funcs of
+// AfterFunc are called by Advance, and the ticks of the tickers are
+// dropped when their channel is full, like with the time package.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	nextID int
+	timers map[int]*fakeTimer
+}
+
+// fakeTimer is a timer or a ticker of a Fake, period
+// is zero for timers. fire is called with the time due.
+type fakeTimer struct {
+	f      *Fake
+	id     int
+	due    time.Time
+	period time.Duration
+	fire   func(now time.Time)
+	c      chan time.Time
+}
+
+// NewFake returns a Fake clock at now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now, timers: make(map[int]*fakeTimer)}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{period: d, c: make(chan time.Time, 1)}
+	t.fire = func(now time.Time) {
+		select {
+		case t.c <- now:
+		default:
+		}
+	}
+	f.add(t, d)
+	return fakeTicker{t}
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	t := &fakeTimer{fire: func(time.Time) { fn() }}
+	f.add(t, d)
+	return t
+}
+
+func (f *Fake) add(t *fakeTimer, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.f = f
+	t.id = f.nextID
+	f.nextID++
+	t.due = f.now.Add(d)
+	f.timers[t.id] = t
+}
+
+// Advance moves the time by d, firing the timers and
+// the ticks due in the order of their due time
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	f.mu.Unlock()
+	for {
+		f.mu.Lock()
+		t := f.next(end)
+		if t == nil {
+			f.now = end
+			f.mu.Unlock()
+			return
+		}
+		f.now = t.due
+		now := t.due
+		if t.period > 0 {
+			t.due = t.due.Add(t.period)
+		} else {
+			delete(f.timers, t.id)
+		}
+		f.mu.Unlock()
+		t.fire(now)
+	}
+}
+
+// next returns the timer due first, not after end
+func (f *Fake) next(end time.Time) *fakeTimer {
+	var due []*fakeTimer
+	for _, t := range f.timers {
+		if !t.due.After(end) {
+			due = append(due, t)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].due.Equal(due[j].due) {
+			return due[i].id < due[j].id
+		}
+		return due[i].due.Before(due[j].due)
+	})
+	return due[0]
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	_, ok := t.f.timers[t.id]
+	delete(t.f.timers, t.id)
+	return ok
+}
+
+// fakeTicker is a ticker of a Fake
+type fakeTicker struct {
+	t *fakeTimer
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.t.c
+}
+
+func (t fakeTicker) Stop() {
+	t.t.Stop()
+}
@@ -0,0 +1,71 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	assert.Equal(t, start, f.Now())
+
+	var fired []time.Time
+	f.AfterFunc(2*time.Second, func() { fired = append(fired, f.Now()) })
+	stopped := f.AfterFunc(time.Second, func() { t.Fatal("stopped timer fired") })
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	ticker := f.NewTicker(time.Second)
+
+	f.Advance(time.Second)
+	assert.Empty(t, fired)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+
+	// the timer fires at its due time, the ticks
+	// are dropped while the channel is full
+	f.Advance(2 * time.Second)
+	assert.Equal(t, []time.Time{start.Add(2 * time.Second)}, fired)
+	assert.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	select {
+	case <-ticker.C():
+		t.Fatal("the tick was not dropped")
+	default:
+	}
+	assert.Equal(t, start.Add(3*time.Second), f.Now())
+
+	ticker.Stop()
+	f.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("the stopped ticker ticked")
+	default:
+	}
+}
+
+func TestReal(t *testing.T) {
+	fired := make(chan struct{})
+	Real.AfterFunc(time.Millisecond, func() { close(fired) })
+	<-fired
+	ticker := Real.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	<-ticker.C()
+	assert.WithinDuration(t, time.Now(), Real.Now(), time.Second)
+}
+
+func TestAfter(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	c, _ := After(f, time.Second)
+	stopped, timer := After(f, time.Second)
+	assert.True(t, timer.Stop())
+
+	f.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-c)
+	select {
+	case <-stopped:
+		t.Fatal("the stopped timer fired")
+	default:
+	}
+}
@@ -3,8 +3,12 @@ package configmap
 import (
 	"context"
 	"os"
+	"path"
+	"path/filepath"
 	"sync"
+	"time"
 
+	"github.com/mixpanel/configmanager/clock"
 	"github.com/mixpanel/configmanager/testutil"
 
 	"github.com/mixpanel/obs"
@@ -13,6 +17,9 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
+// k8sDataDir is the symlink swapped by Kubernetes to update the files of a volume
+const k8sDataDir = "..data"
+
 type OnFileEvent func(path string) error
 
 type CmWatcher struct {
@@ -21,8 +28,20 @@ type CmWatcher struct {
 	// Call whenever there is a change to ConfigMap
 	onFileEvent OnFileEvent
 
+	// watcher is the handle of the CmWatcher on the
+	// fsnotify.Watcher shared by the CmWatchers
 	wg      sync.WaitGroup
-	watcher *fsnotify.Watcher
+	watcher *watchHandle
+
+	// ResyncInterval, if set before Start, is the interval at which
+	// onFileEvent is also invoked without any event of the file
+	ResyncInterval time.Duration
+	// Clock, if set before Start, ticks the resyncs instead of the time package
+	Clock clock.Clock
+
+	// symlinked is set if Path is a symlink, target is the file it resolved to
+	symlinked bool
+	target    string
 
 	// used for tests
 	NotifyCounter *testutil.CallCounter
@@ -30,11 +49,12 @@ type CmWatcher struct {
 	fr obs.FlightRecorder
 }
 
-// NewCmWatcher() creates a new ConfigMap file watcher, which looks for changes to the file and invokes onFileEvent
+// NewCmWatcher() creates a new ConfigMap file watcher, which looks for changes to the file and invokes onFileEvent.
+// The CmWatchers of the process share one fsnotify watcher.
 func NewCmWatcher(path string, onFileEvent OnFileEvent, fr obs.FlightRecorder) (*CmWatcher, error) {
-	watcher, err := fsnotify.NewWatcher()
+	watcher, err := sharedWatches.handle()
 	if err != nil {
-		return nil, obserr.Annotate(err, "Error while creating fsnotify watcher")
+		return nil, err
 	}
 
 	w := &CmWatcher{
@@ -68,19 +88,87 @@ func (w *CmWatcher) Start() error {
 		return obserr.Annotate(err, "Path does not exist").Set("Path", w.Path)
 	}
 
-	if err := w.watcher.Add(w.Path); err != nil {
-		return obserr.Annotate(err, "watcher.Add failed")
+	if err := w.addWatches(); err != nil {
+		return err
 	}
 
 	w.wg.Add(1)
 	go func() {
 		defer w.wg.Done()
-		w.startWatcher(context.Background())
+		w.startWatcher(context.Background(), true)
 	}()
 
 	return nil
 }
 
+// StartLenient() starts the file watcher like Start(), but if the file does not
+// exist yet it watches the parent directory instead and invokes onFileEvent once
+// the file is created. The parent directory must exist.
+func (w *CmWatcher) StartLenient() error {
+	if _, err := os.Stat(w.Path); err == nil {
+		return w.Start()
+	}
+
+	dir := path.Dir(w.Path)
+	if err := w.watcher.Add(dir); err != nil {
+		return obserr.Annotate(err, "watcher.Add failed").Set("Path", dir)
+	}
+	// the file may have been created before the directory was watched
+	exists := false
+	if _, err := os.Stat(w.Path); err == nil {
+		if err := w.watchFile(); err != nil {
+			return err
+		}
+		exists = true
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.startWatcher(context.Background(), exists)
+	}()
+
+	return nil
+}
+
+// watchFile() replaces the watch on the parent directory by the watches of the file
+func (w *CmWatcher) watchFile() error {
+	w.watcher.Remove(path.Dir(w.Path))
+	return w.addWatches()
+}
+
+// addWatches() watches the file and, if the file is a symlink, its directory.
+// Kubernetes mounts the files of a configmap as symlinks through the ..data
+// symlink of the mount directory, which is atomically swapped on updates.
+// The watch of the file follows the symlink and may miss the swap.
+func (w *CmWatcher) addWatches() error {
+	if err := w.watcher.Add(w.Path); err != nil {
+		return obserr.Annotate(err, "watcher.Add failed").Set("Path", w.Path)
+	}
+	info, err := os.Lstat(w.Path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	dir := path.Dir(w.Path)
+	if err := w.watcher.Add(dir); err != nil {
+		return obserr.Annotate(err, "watcher.Add failed").Set("Path", dir)
+	}
+	w.symlinked = true
+	w.target, _ = filepath.EvalSymlinks(w.Path)
+	return nil
+}
+
+// targetChanged() returns true if the symlinked file
+// resolves to another file than when last called
+func (w *CmWatcher) targetChanged() bool {
+	target, err := filepath.EvalSymlinks(w.Path)
+	if err != nil || target == w.target {
+		return false
+	}
+	w.target = target
+	return true
+}
+
 // Stop() stop file watcher
 func (w *CmWatcher) Stop() {
 	if w == nil {
@@ -90,27 +178,75 @@ func (w *CmWatcher) Stop() {
 	w.wg.Wait()
 }
 
-func (w *CmWatcher) startWatcher(ctx context.Context) {
+// startWatcher() processes the events of the file, or of its
+// parent directory until the file is created if exists is false
+func (w *CmWatcher) startWatcher(ctx context.Context, exists bool) {
 	fs := w.fr.WithSpan(ctx)
 
 	// force the callback once to make sure that file is processed in the event
 	// that no fsnotify events ever fired.
-	if err := w.onFileEvent(w.Path); err != nil {
-		fs.Warn("initial_on_file_event", "initial onFileEvent failed", obs.Vals{
-			"Path": w.Path,
-		}.WithError(err))
-		// fail open
+	if exists {
+		if err := w.onFileEvent(w.Path); err != nil {
+			fs.Warn("initial_on_file_event", "initial onFileEvent failed", obs.Vals{
+				"Path": w.Path,
+			}.WithError(err))
+			// fail open
+		}
+	}
+
+	var resync <-chan time.Time
+	if w.ResyncInterval > 0 {
+		clk := w.Clock
+		if clk == nil {
+			clk = clock.Real
+		}
+		ticker := clk.NewTicker(w.ResyncInterval)
+		defer ticker.Stop()
+		resync = ticker.C()
 	}
 
 	for {
 		select {
-		case event, ok := <-w.watcher.Events:
-			if !ok {
-				return
-			}
+		case <-resync:
+			exists = w.resync(fs, exists)
+		case <-w.watcher.Overflow:
+			// events of the file may have been dropped
+			exists = w.resync(fs, exists)
+		case <-w.watcher.done:
+			return
+		case event := <-w.watcher.Events:
 			if event.Name != w.Path {
+				// the ..data symlink was swapped by Kubernetes
+				if w.symlinked && event.Name == path.Join(path.Dir(w.Path), k8sDataDir) && w.targetChanged() {
+					w.watcher.Remove(w.Path)
+					if err := w.watcher.Add(w.Path); err != nil {
+						fs.Warn("error_reset", "error while resetting watch on config file", obs.Vals{
+							"Path": w.Path,
+						}.WithError(err))
+					}
+					if err := w.onFileEvent(w.Path); err != nil {
+						fs.Warn("error_read", "could not read config file", obs.Vals{
+							"Path": w.Path,
+						}.WithError(err))
+					}
+				}
 				continue
 			}
+			if !exists {
+				if event.Op&fsnotify.Create == 0 {
+					continue
+				}
+				if err := w.watchFile(); err != nil {
+					fs.Warn("error_reset", "error while watching the created config file", obs.Vals{
+						"Path": event.Name,
+					}.WithError(err))
+					continue
+				}
+				exists = true
+				fs.Debug("config_file_created", obs.Vals{
+					"Path": event.Name,
+				})
+			}
 			switch event.Op {
 			case fsnotify.Remove, fsnotify.Rename, fsnotify.Chmod:
 				w.watcher.Remove(event.Name)
@@ -137,13 +273,38 @@ func (w *CmWatcher) startWatcher(ctx context.Context) {
 					"op":   event.Op,
 				})
 			}
-		case err, ok := <-w.watcher.Errors:
-			if err != nil {
-				fs.Warn("error_watching", "error while watching config file", obs.Vals{}.WithError(err))
-			}
-			if !ok {
-				return
-			}
+		case err := <-w.watcher.Errors:
+			fs.Warn("error_watching", "error while watching config file", obs.Vals{}.WithError(err))
 		}
 	}
 }
+
+// resync resets the watch of the file and reads it without any event,
+// in case the watch or its events were lost. It returns whether the
+// file exists and is watched.
+func (w *CmWatcher) resync(fs obs.FlightSpan, exists bool) bool {
+	if _, err := os.Stat(w.Path); err != nil {
+		return exists
+	}
+	if exists {
+		w.watcher.Remove(w.Path)
+		if err := w.watcher.Add(w.Path); err != nil {
+			fs.Warn("error_reset", "error while resetting watch on config file", obs.Vals{
+				"Path": w.Path,
+			}.WithError(err))
+		}
+	} else {
+		if err := w.watchFile(); err != nil {
+			fs.Warn("error_reset", "error while watching the created config file", obs.Vals{
+				"Path": w.Path,
+			}.WithError(err))
+			return false
+		}
+	}
+	if err := w.onFileEvent(w.Path); err != nil {
+		fs.Warn("error_resync", "could not read config file", obs.Vals{
+			"Path": w.Path,
+		}.WithError(err))
+	}
+	return true
+}
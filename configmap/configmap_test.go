@@ -1,13 +1,16 @@
 package configmap
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/mixpanel/configmanager/clock"
 	"github.com/mixpanel/configmanager/testutil"
 
 	"github.com/mixpanel/obs"
@@ -136,6 +139,206 @@ func TestConfigDynamicDelete(t *testing.T) {
 	})
 }
 
+// file does not exist at start => the file is loaded once it is created
+func TestConfigLenientStart(t *testing.T) {
+	t.Parallel()
+
+	testutil.WithTempDir(t, func(root string) {
+		cfgFile := path.Join(root, "config.yaml")
+
+		var v atomic.Value
+		onNotify := func(p string) error {
+			bs, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			v.Store(string(bs))
+			return nil
+		}
+
+		w, err := NewCmWatcherForTest(cfgFile, onNotify, obs.NullFR)
+		require.NoError(t, err)
+
+		require.NoError(t, w.StartLenient())
+		defer w.Stop()
+
+		// other files of the directory are ignored
+		safeWriteFile(t, path.Join(root, "other.yaml"), "foo: baz")
+		safeWriteFile(t, cfgFile, "foo: bar")
+		w.NotifyCounter.Wait(1)
+		assert.Equal(t, "foo: bar", v.Load())
+
+		safeWriteFile(t, cfgFile, "foo: qux")
+		w.NotifyCounter.Wait(2)
+		assert.Equal(t, "foo: qux", v.Load())
+	})
+}
+
+// the file is read every ResyncInterval without any event
+func TestConfigResync(t *testing.T) {
+	t.Parallel()
+
+	testutil.WithTempDir(t, func(root string) {
+		cfgFile := path.Join(root, "config.yaml")
+		require.NoError(t, ioutil.WriteFile(cfgFile, []byte("foo: bar"), 0700))
+
+		w, err := NewCmWatcherForTest(cfgFile, nullOnFileEvent, obs.NullFR)
+		require.NoError(t, err)
+		w.ResyncInterval = 5 * time.Millisecond
+
+		require.NoError(t, w.Start())
+		defer w.Stop()
+		w.NotifyCounter.Wait(3)
+	})
+}
+
+// the resyncs are ticked by the Clock
+func TestConfigResyncClock(t *testing.T) {
+	t.Parallel()
+
+	testutil.WithTempDir(t, func(root string) {
+		cfgFile := path.Join(root, "config.yaml")
+		require.NoError(t, ioutil.WriteFile(cfgFile, []byte("foo: bar"), 0700))
+
+		var reads int32
+		onFileEvent := func(string) error {
+			atomic.AddInt32(&reads, 1)
+			return nil
+		}
+		w, err := NewCmWatcher(cfgFile, onFileEvent, obs.NullFR)
+		require.NoError(t, err)
+		clk := clock.NewFake(time.Now())
+		w.ResyncInterval = time.Hour
+		w.Clock = clk
+
+		require.NoError(t, w.Start())
+		defer w.Stop()
+		// the ticker is created by the goroutine of the watcher
+		require.Eventually(t, func() bool {
+			clk.Advance(time.Hour)
+			return atomic.LoadInt32(&reads) >= 3
+		}, 5*time.Second, time.Millisecond)
+	})
+}
+
+// the file is mounted like Kubernetes mounts configmaps, through the
+// ..data symlink which is swapped to update the file
+func TestConfigDataSymlink(t *testing.T) {
+	t.Parallel()
+
+	testutil.WithTempDir(t, func(root string) {
+		cfgFile := path.Join(root, "config.yaml")
+		writeVersion := func(version, contents string) {
+			require.NoError(t, os.Mkdir(path.Join(root, version), 0700))
+			require.NoError(t, ioutil.WriteFile(path.Join(root, version, "config.yaml"), []byte(contents), 0700))
+			require.NoError(t, os.Symlink(version, path.Join(root, "..data_tmp")))
+			require.NoError(t, os.Rename(path.Join(root, "..data_tmp"), path.Join(root, "..data")))
+		}
+		writeVersion("..v1", "foo: bar")
+		require.NoError(t, os.Symlink("..data/config.yaml", cfgFile))
+
+		var v atomic.Value
+		onNotify := func(p string) error {
+			bs, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			v.Store(string(bs))
+			return nil
+		}
+
+		w, err := NewCmWatcherForTest(cfgFile, onNotify, obs.NullFR)
+		require.NoError(t, err)
+
+		require.NoError(t, w.Start())
+		defer w.Stop()
+		w.NotifyCounter.Wait(1)
+		assert.Equal(t, "foo: bar", v.Load())
+
+		writeVersion("..v2", "foo: baz")
+		require.NoError(t, os.RemoveAll(path.Join(root, "..v1")))
+		w.NotifyCounter.Wait(2)
+		for i := 0; i < 100 && v.Load() != "foo: baz"; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, "foo: baz", v.Load())
+	})
+}
+
+// the watchers of several files, e.g. of several scopes, share one fsnotify watcher
+func TestConfigSharedWatcher(t *testing.T) {
+	t.Parallel()
+
+	testutil.WithTempDir(t, func(root string) {
+		var watchers []*CmWatcher
+		for _, scope := range []string{"a", "b", "c"} {
+			cfgFile := path.Join(root, scope, "config.yaml")
+			safeWriteFile(t, cfgFile, "foo: bar")
+			w, err := NewCmWatcherForTest(cfgFile, nullOnFileEvent, obs.NullFR)
+			require.NoError(t, err)
+			require.NoError(t, w.Start())
+			defer w.Stop()
+			w.NotifyCounter.Wait(1)
+			watchers = append(watchers, w)
+		}
+		sharedWatches.mu.Lock()
+		assert.Equal(t, sharedWatches.watcher, watchers[0].watcher.m.watcher)
+		sharedWatches.mu.Unlock()
+
+		// the other watchers keep watching once one is stopped
+		watchers[0].Stop()
+		for _, w := range watchers[1:] {
+			safeWriteFile(t, w.Path, "foo: baz")
+			w.NotifyCounter.Wait(2)
+		}
+	})
+}
+
+// a watcher falling behind does not block the events of the others,
+// its dropped events are replaced by a resync
+func TestConfigSharedWatcherOverflow(t *testing.T) {
+	t.Parallel()
+
+	testutil.WithTempDir(t, func(root string) {
+		slowDir, fastDir := path.Join(root, "slow"), path.Join(root, "fast")
+		require.NoError(t, os.Mkdir(slowDir, 0700))
+		require.NoError(t, os.Mkdir(fastDir, 0700))
+		slow, err := sharedWatches.handle()
+		require.NoError(t, err)
+		defer slow.Close()
+		require.NoError(t, slow.Add(slowDir))
+		fast, err := sharedWatches.handle()
+		require.NoError(t, err)
+		defer fast.Close()
+		require.NoError(t, fast.Add(fastDir))
+
+		for i := 0; i < 2*handleBuffer; i++ {
+			require.NoError(t, ioutil.WriteFile(path.Join(slowDir, fmt.Sprint(i)), nil, 0700))
+		}
+		require.NoError(t, ioutil.WriteFile(path.Join(fastDir, "config.yaml"), nil, 0700))
+		select {
+		case <-fast.Events:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the events of the other handles are blocked")
+		}
+		select {
+		case <-slow.Overflow:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the overflow was not signaled")
+		}
+
+		cfgFile := path.Join(root, "config.yaml")
+		require.NoError(t, ioutil.WriteFile(cfgFile, []byte("foo: bar"), 0700))
+		w, err := NewCmWatcherForTest(cfgFile, nullOnFileEvent, obs.NullFR)
+		require.NoError(t, err)
+		require.NoError(t, w.Start())
+		defer w.Stop()
+		w.NotifyCounter.Wait(1)
+		w.watcher.Overflow <- struct{}{}
+		w.NotifyCounter.Wait(2)
+	})
+}
+
 func safeWriteFile(t *testing.T, destPath, contents string) {
 	err := os.MkdirAll(path.Dir(destPath), 0700)
 	require.NoError(t, err)
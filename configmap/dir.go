@@ -0,0 +1,118 @@
+package configmap
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DirWatcher watches the entries of a directory, e.g. a directory of
+// config fragments, and invokes onDirEvent with the path of the directory
+// every time an entry is created, removed, renamed or written, e.g. so
+// that a file that could not be loaded when it was created is retried.
+type DirWatcher struct {
+	// Path of the directory to watch
+	Path       string
+	onDirEvent OnFileEvent
+
+	wg      sync.WaitGroup
+	watcher *watchHandle
+
+	// ResyncInterval, if set before Start, is the interval at which
+	// onDirEvent is also invoked without any event of the directory
+	ResyncInterval time.Duration
+	// Clock, if set before Start, ticks the resyncs instead of the time package
+	Clock clock.Clock
+
+	fr obs.FlightRecorder
+}
+
+// NewDirWatcher creates a watcher of the entries of the directory
+// at path, sharing the fsnotify watcher of the CmWatchers
+func NewDirWatcher(path string, onDirEvent OnFileEvent, fr obs.FlightRecorder) (*DirWatcher, error) {
+	watcher, err := sharedWatches.handle()
+	if err != nil {
+		return nil, err
+	}
+	return &DirWatcher{
+		Path:       path,
+		onDirEvent: onDirEvent,
+		watcher:    watcher,
+		fr:         fr,
+	}, nil
+}
+
+// Start starts watching the directory, which must exist
+func (w *DirWatcher) Start() error {
+	if _, err := os.Stat(w.Path); err != nil {
+		return obserr.Annotate(err, "Path does not exist").Set("Path", w.Path)
+	}
+	if err := w.watcher.Add(w.Path); err != nil {
+		return obserr.Annotate(err, "watcher.Add failed").Set("Path", w.Path)
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run(context.Background())
+	}()
+	return nil
+}
+
+func (w *DirWatcher) run(ctx context.Context) {
+	fs := w.fr.WithSpan(ctx)
+
+	var resync <-chan time.Time
+	if w.ResyncInterval > 0 {
+		clk := w.Clock
+		if clk == nil {
+			clk = clock.Real
+		}
+		ticker := clk.NewTicker(w.ResyncInterval)
+		defer ticker.Stop()
+		resync = ticker.C()
+	}
+
+	notify := func() {
+		if err := w.onDirEvent(w.Path); err != nil {
+			fs.Warn("error_read", "could not read config directory", obs.Vals{
+				"Path": w.Path,
+			}.WithError(err))
+		}
+	}
+	for {
+		select {
+		case <-resync:
+			notify()
+		case <-w.watcher.Overflow:
+			// events of the directory may have been dropped
+			notify()
+		case <-w.watcher.done:
+			return
+		case event := <-w.watcher.Events:
+			if event.Name == w.Path || event.Op == fsnotify.Chmod {
+				continue
+			}
+			notify()
+		case err := <-w.watcher.Errors:
+			fs.Warn("error_watching", "error while watching config directory", obs.Vals{}.WithError(err))
+		}
+	}
+}
+
+// Stop stops watching the directory and waits for
+// the onDirEvent in flight
+func (w *DirWatcher) Stop() {
+	if w == nil {
+		return
+	}
+	w.watcher.Close()
+	w.wg.Wait()
+}
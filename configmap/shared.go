@@ -0,0 +1,196 @@
+package configmap
+
+import (
+	"errors"
+	"path"
+	"sync"
+
+	"github.com/mixpanel/obs/obserr"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// errHandleClosed is returned by the watches of a closed handle
+var errHandleClosed = errors.New("watch handle closed")
+
+// handleBuffer is the number of events buffered for each CmWatcher
+const handleBuffer = 64
+
+// sharedWatches is the watch manager of all the CmWatchers of the process
+var sharedWatches = &watchManager{}
+
+// watchManager shares one fsnotify.Watcher between the CmWatchers of the
+// process, e.g. of the scopes under /etc/configs, so that they do not each
+// hold an inotify instance. One goroutine reads the events and routes them
+// to the CmWatchers watching the file or its directory. The fsnotify.Watcher
+// is created with the first handle and closed with the last one.
+type watchManager struct {
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	// handles are the open handles, watches
+	// the handles watching every path
+	handles map[*watchHandle]struct{}
+	watches map[string]map[*watchHandle]struct{}
+}
+
+// watchHandle is the view of a CmWatcher on the shared fsnotify.Watcher:
+// the events of the paths it watches are sent on Events, and the errors
+// of the fsnotify.Watcher on Errors, until it is closed. The events are
+// dropped when Events is full, so that a slow CmWatcher does not hold
+// back the others, and Overflow is signaled for the CmWatcher to resync.
+type watchHandle struct {
+	m        *watchManager
+	Events   chan fsnotify.Event
+	Errors   chan error
+	Overflow chan struct{}
+	// done is closed by Close
+	done chan struct{}
+	// paths are the paths watched, guarded by m.mu
+	paths map[string]struct{}
+}
+
+// handle returns a new handle, creating the fsnotify.Watcher if needed
+func (m *watchManager) handle() (*watchHandle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, obserr.Annotate(err, "Error while creating fsnotify watcher")
+		}
+		m.watcher = watcher
+		m.handles = make(map[*watchHandle]struct{})
+		m.watches = make(map[string]map[*watchHandle]struct{})
+		go m.run(watcher)
+	}
+	h := &watchHandle{
+		m:        m,
+		Events:   make(chan fsnotify.Event, handleBuffer),
+		Errors:   make(chan error, 1),
+		Overflow: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		paths:    make(map[string]struct{}),
+	}
+	m.handles[h] = struct{}{}
+	return h, nil
+}
+
+// run routes the events of watcher until it is closed
+func (m *watchManager) run(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			for _, h := range m.watching(event.Name) {
+				h.send(event)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			m.mu.Lock()
+			for h := range m.handles {
+				select {
+				case h.Errors <- err:
+				default:
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// send sends event to the handle without blocking, the event is
+// dropped and Overflow signaled if the buffer of Events is full
+func (h *watchHandle) send(event fsnotify.Event) {
+	select {
+	case h.Events <- event:
+		return
+	default:
+	}
+	select {
+	case h.Overflow <- struct{}{}:
+	default:
+	}
+}
+
+// watching returns the handles watching name or its directory
+func (m *watchManager) watching(name string) []*watchHandle {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var handles []*watchHandle
+	for h := range m.watches[name] {
+		handles = append(handles, h)
+	}
+	if dir := path.Dir(name); dir != name {
+		for h := range m.watches[dir] {
+			if _, ok := m.watches[name][h]; !ok {
+				handles = append(handles, h)
+			}
+		}
+	}
+	return handles
+}
+
+// Add watches name. The watch is added again even if another handle
+// watches name, so that it follows name if the file was replaced.
+func (h *watchHandle) Add(name string) error {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if _, ok := h.m.handles[h]; !ok {
+		return errHandleClosed
+	}
+	if err := h.m.watcher.Add(name); err != nil {
+		return err
+	}
+	if h.m.watches[name] == nil {
+		h.m.watches[name] = make(map[*watchHandle]struct{})
+	}
+	h.m.watches[name][h] = struct{}{}
+	h.paths[name] = struct{}{}
+	return nil
+}
+
+// Remove stops watching name, the watch is only
+// removed once no other handle watches name
+func (h *watchHandle) Remove(name string) error {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	return h.remove(name)
+}
+
+func (h *watchHandle) remove(name string) error {
+	if _, ok := h.paths[name]; !ok {
+		return nil
+	}
+	delete(h.paths, name)
+	delete(h.m.watches[name], h)
+	if len(h.m.watches[name]) > 0 {
+		return nil
+	}
+	delete(h.m.watches, name)
+	return h.m.watcher.Remove(name)
+}
+
+// Close removes the watches of the handle and closes done. The
+// fsnotify.Watcher is closed if no other handle is open.
+func (h *watchHandle) Close() error {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if _, ok := h.m.handles[h]; !ok {
+		return nil
+	}
+	for name := range h.paths {
+		h.remove(name)
+	}
+	delete(h.m.handles, h)
+	close(h.done)
+	if len(h.m.handles) > 0 {
+		return nil
+	}
+	err := h.m.watcher.Close()
+	h.m.watcher = nil
+	return err
+}
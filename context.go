@@ -0,0 +1,78 @@
+package configmanager
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+type ctxOverridesKey struct{}
+
+// WithOverrides returns a context carrying overrides for the
+// configs read with the Ctx getters, e.g. for request-scoped
+// experiments or shadow traffic. Values are raw JSON. Overrides
+// already in ctx are kept unless overridden again.
+func WithOverrides(ctx context.Context, overrides map[string][]byte) context.Context {
+	merged := make(map[string]json.RawMessage)
+	for key, raw := range overridesFromContext(ctx) {
+		merged[key] = raw
+	}
+	for key, raw := range overrides {
+		merged[key] = raw
+	}
+	return context.WithValue(ctx, ctxOverridesKey{}, merged)
+}
+
+func overridesFromContext(ctx context.Context) map[string]json.RawMessage {
+	overrides, _ := ctx.Value(ctxOverridesKey{}).(map[string]json.RawMessage)
+	return overrides
+}
+
+// forContext returns a client applying the overrides of ctx and
+// tracing its decodes in ctx, or c itself if there is nothing to do
+func (c *client) forContext(ctx context.Context) *client {
+	overrides := overridesFromContext(ctx)
+	if len(overrides) == 0 {
+		if c.opts.tracer == nil {
+			return c
+		}
+		tc := c.derive(c.sm)
+		tc.ctx = ctx
+		return tc
+	}
+	if c.prefix != "" {
+		// overrides are keyed by full key
+		// while the keys of c are trimmed
+		trimmed := make(map[string]json.RawMessage)
+		for key, raw := range overrides {
+			if len(key) > len(c.prefix) && key[:len(c.prefix)] == c.prefix {
+				trimmed[key[len(c.prefix):]] = raw
+			}
+		}
+		overrides = trimmed
+	}
+	oc := c.derive(model.NewRawOverrideStateManager(c.sm, overrides))
+	oc.ctx = ctx
+	return oc
+}
+
+func (c *client) GetBooleanCtx(ctx context.Context, key string, defaultVal bool) bool {
+	return c.forContext(ctx).GetBoolean(key, defaultVal)
+}
+
+func (c *client) GetInt64Ctx(ctx context.Context, key string, defaultVal int64) int64 {
+	return c.forContext(ctx).GetInt64(key, defaultVal)
+}
+
+func (c *client) GetFloat64Ctx(ctx context.Context, key string, defaultVal float64) float64 {
+	return c.forContext(ctx).GetFloat64(key, defaultVal)
+}
+
+func (c *client) GetStringCtx(ctx context.Context, key string, defaultVal string) string {
+	return c.forContext(ctx).GetString(key, defaultVal)
+}
+
+func (c *client) IsFeatureEnabledCtx(ctx context.Context, key string, enabledByDefault bool) bool {
+	return c.forContext(ctx).IsFeatureEnabled(key, enabledByDefault)
+}
@@ -0,0 +1,29 @@
+package configmanager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextOverrides(t *testing.T) {
+	c := NewTestClient().
+		SetString("model", "v1").
+		SetString("search.model", "s1").
+		SetFloat64("rollout", 0)
+
+	ctx := WithOverrides(context.Background(), map[string][]byte{
+		"model":        []byte(`"v2"`),
+		"search.model": []byte(`"s2"`),
+	})
+	ctx = WithOverrides(ctx, map[string][]byte{
+		"rollout": []byte("1"),
+	})
+
+	assert.Equal(t, "v2", c.GetStringCtx(ctx, "model", ""))
+	assert.Equal(t, "v1", c.GetStringCtx(context.Background(), "model", ""))
+	assert.Equal(t, "v1", c.GetString("model", ""))
+	assert.True(t, c.IsFeatureEnabledCtx(ctx, "rollout", false))
+	assert.Equal(t, "s2", c.WithPrefix("search.").GetStringCtx(ctx, "model", ""))
+}
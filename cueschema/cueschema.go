@@ -0,0 +1,83 @@
+// Package cueschema validates configs against a CUE schema. The
+// configs are unified as an object mapping the keys to their values:
+//
+//	timeout_secs: int & >0 & <=60
+//	scaling_percentage?: float & >=0 & <=1
+//
+// Use it with configmanager.WithSchema(cueschema.Loader).
+package cueschema
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/mixpanel/obs/obserr"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+// FileName is the schema read from the scope directory
+const FileName = "schema.cue"
+
+// schema is a compiled schema.cue. cue.Context is
+// not safe for concurrent use so validations are
+// serialized.
+type schema struct {
+	mu  sync.Mutex
+	ctx *cue.Context
+	val cue.Value
+}
+
+// Loader is a model.SchemaLoader compiling the schema.cue
+// of the scope directory. Scopes without a schema.cue
+// are not validated.
+func Loader(scopeDir string) (model.Schema, error) {
+	filePath := path.Join(scopeDir, FileName)
+	data, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, obserr.Annotate(err, "cueschema.Loader: error reading the schema").Set("path", filePath)
+	}
+	return Compile(data, filePath)
+}
+
+// Compile compiles the CUE schema in data.
+// filename is used in the errors.
+func Compile(data []byte, filename string) (model.Schema, error) {
+	ctx := cuecontext.New()
+	val := ctx.CompileBytes(data, cue.Filename(filename))
+	if err := val.Err(); err != nil {
+		return nil, obserr.Annotate(err, "cueschema.Compile: invalid schema").Set("path", filename)
+	}
+	return &schema{ctx: ctx, val: val}, nil
+}
+
+func (s *schema) Validate(configs []*model.Config) error {
+	obj := make(map[string]json.RawMessage, len(configs))
+	for _, cfg := range configs {
+		obj[cfg.Key] = cfg.RawValue
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return obserr.Annotate(err, "cueschema: error marshalling the configs")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	val := s.ctx.CompileBytes(data)
+	if err := val.Err(); err != nil {
+		return obserr.Annotate(err, "cueschema: error compiling the configs")
+	}
+	if err := s.val.Unify(val).Validate(cue.Concrete(true)); err != nil {
+		return obserr.Annotate(err, "cueschema: configs do not match the schema")
+	}
+	return nil
+}
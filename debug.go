@@ -0,0 +1,97 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+// redactedValue replaces the values of the sensitive configs
+var redactedValue = json.RawMessage(`"<redacted>"`)
+
+// DebugReport is the state of the configs served by a client
+type DebugReport struct {
+	// Generation, Hash and LoadedAt are the Version of the configs
+	Generation uint64        `json:"generation"`
+	Hash       string        `json:"hash"`
+	LoadedAt   time.Time     `json:"loaded_at"`
+	Configs    []DebugConfig `json:"configs"`
+}
+
+// DebugConfig is a config loaded, with its parsed value if a
+// getter parsed it. The values of sensitive configs are redacted.
+type DebugConfig struct {
+	Key        string           `json:"key"`
+	Value      json.RawMessage  `json:"value"`
+	Sensitive  bool             `json:"sensitive,omitempty"`
+	Type       model.ConfigType `json:"type,omitempty"`
+	Deprecated string           `json:"deprecated,omitempty"`
+	// ParsedType is the Go type of the parsed value and Parsed
+	// the value itself if it is a bool, a number or a string
+	ParsedType string      `json:"parsed_type,omitempty"`
+	Parsed     interface{} `json:"parsed,omitempty"`
+}
+
+// DebugReport returns all the configs loaded in the scope, including
+// the ones outside of the prefix of a view, and their version. Building
+// the report does not count as reads of the keys.
+func (c *client) DebugReport() DebugReport {
+	gen, hash, loadedAt := c.Version()
+	r := DebugReport{Generation: gen, Hash: hash, LoadedAt: loadedAt, Configs: []DebugConfig{}}
+	sm := c.version.sm.Snapshot()
+	for _, key := range sm.Keys() {
+		cfg, err := sm.GetKey(key)
+		if err != nil {
+			continue
+		}
+		dc := DebugConfig{
+			Key:        cfg.Key,
+			Value:      cfg.RawValue,
+			Sensitive:  cfg.Sensitive,
+			Type:       cfg.Type,
+			Deprecated: cfg.Deprecated,
+		}
+		if cfg.Sensitive {
+			dc.Value = redactedValue
+		}
+		pv := sm.GetParsedValue(cfg)
+		if pv == nil {
+			pv = cfg.CachedScalar()
+		}
+		if pv != nil {
+			dc.ParsedType = fmt.Sprintf("%T", pv)
+			if isScalar(pv) && !cfg.Sensitive {
+				dc.Parsed = pv
+			}
+		}
+		r.Configs = append(r.Configs, dc)
+	}
+	return r
+}
+
+// isScalar returns true for bools, numbers and strings
+func isScalar(v interface{}) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// DebugHandler serves the DebugReport of c as JSON, e.g. on an
+// admin endpoint such as /configz
+func DebugHandler(c Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(c.DebugReport())
+	})
+}
@@ -0,0 +1,45 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugReport(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewTestClient(WithNow(func() time.Time { return now }))
+	c.SetInt64("foo", 1)
+	c.SetString("kafka.topic", "events")
+	c.dm.SetConfig(&model.Config{Key: "password", RawValue: []byte(`"hunter2"`), Sensitive: true})
+	c.GetInt64("foo", 0)
+	c.GetString("password", "")
+
+	r := c.WithPrefix("kafka.").DebugReport()
+	gen, hash, _ := c.Version()
+	assert.Equal(t, gen, r.Generation)
+	assert.Equal(t, hash, r.Hash)
+	assert.Equal(t, now, r.LoadedAt)
+	assert.Equal(t, []DebugConfig{
+		{Key: "foo", Value: []byte("1"), ParsedType: "int64", Parsed: int64(1)},
+		{Key: "kafka.topic", Value: []byte(`"events"`)},
+		{Key: "password", Value: redactedValue, Sensitive: true, ParsedType: "string"},
+	}, r.Configs)
+	// the report is not a read
+	assert.Equal(t, []string{"kafka.topic"}, c.UsageReport().Unread)
+
+	rec := httptest.NewRecorder()
+	DebugHandler(c).ServeHTTP(rec, httptest.NewRequest("GET", "/configz", nil))
+	assert.NotContains(t, rec.Body.String(), "hunter2")
+	var report DebugReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.Len(t, report.Configs, 3)
+	assert.Equal(t, "foo", report.Configs[0].Key)
+	assert.EqualValues(t, 1, report.Configs[0].Parsed)
+}
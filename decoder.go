@@ -0,0 +1,52 @@
+package configmanager
+
+import (
+	"sync"
+)
+
+// DecodeFunc decodes the raw value of a config into val
+type DecodeFunc func(raw []byte, val interface{}) error
+
+// decoders are the DecodeFuncs registered per key. They
+// are shared by the clients derived from the same client.
+type decoders struct {
+	mu  sync.RWMutex
+	fns map[string]DecodeFunc
+}
+
+func (d *decoders) get(key string) DecodeFunc {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.fns[key]
+}
+
+// RegisterDecoder makes the client decode the values of key with fn
+// instead of JSON, e.g. for values stored as protobuf text, base64 or
+// CSV. fn is used by all the getters and typed subscriptions of key
+// and its results are cached like the JSON ones. The values of key
+// cached before fn is registered are dropped.
+func (c *client) RegisterDecoder(key string, fn DecodeFunc) {
+	c.decoders.mu.Lock()
+	if c.decoders.fns == nil {
+		c.decoders.fns = make(map[string]DecodeFunc)
+	}
+	c.decoders.fns[c.prefix+key] = fn
+	c.decoders.mu.Unlock()
+
+	// the values read so far were decoded without fn
+	if cfg, err := c.lookup(key); err == nil {
+		cfg.ResetScalar()
+		c.sm.SetParsedValue(cfg, nil)
+	}
+}
+
+// decode decodes raw, the value of key, into val
+func (c *client) decode(key string, raw []byte, val interface{}) (err error) {
+	if end := c.traceDecode(key); end != nil {
+		defer func() { end(err) }()
+	}
+	if fn := c.decoders.get(c.prefix + key); fn != nil {
+		return fn(raw, val)
+	}
+	return c.unmarshalFn(raw, val)
+}
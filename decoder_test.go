@@ -0,0 +1,74 @@
+package configmanager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeBase64(raw []byte, val interface{}) error {
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	*val.(*string) = string(decoded)
+	return nil
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	c := NewTestClient().
+		SetString("secret", base64.StdEncoding.EncodeToString([]byte("hunter2"))).
+		SetString("plain", "foo").
+		SetString("kafka.secret", base64.StdEncoding.EncodeToString([]byte("topic")))
+	c.RegisterDecoder("secret", decodeBase64)
+
+	assert.Equal(t, "hunter2", c.GetString("secret", ""))
+	assert.Equal(t, "foo", c.GetString("plain", ""))
+
+	// decoders are registered by full key
+	kafka := c.WithPrefix("kafka.")
+	kafka.RegisterDecoder("secret", decodeBase64)
+	assert.Equal(t, "topic", c.GetString("kafka.secret", ""))
+
+	var val string
+	require.NoError(t, c.Unmarshal("secret", &val))
+	assert.Equal(t, "hunter2", val)
+}
+
+func TestRegisterDecoderAfterRead(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+	c := NewTestClient().SetString("secret", encoded)
+	assert.Equal(t, encoded, c.GetString("secret", ""))
+
+	// the value cached before the registration is dropped
+	c.RegisterDecoder("secret", decodeBase64)
+	assert.Equal(t, "hunter2", c.GetString("secret", ""))
+}
+
+func TestWithUnmarshal(t *testing.T) {
+	// the values larger than 8 bytes are rejected
+	limited := func(data []byte, val interface{}) error {
+		if len(data) > 8 {
+			return errors.New("value too large")
+		}
+		return json.Unmarshal(data, val)
+	}
+	c := NewTestClient(WithUnmarshal(limited)).
+		SetString("small", "foo").
+		SetString("large", "foo bar baz").
+		SetString("secret", base64.StdEncoding.EncodeToString([]byte("hunter2")))
+	c.RegisterDecoder("secret", decodeBase64)
+
+	assert.Equal(t, "foo", c.GetString("small", ""))
+	assert.Equal(t, "default", c.GetString("large", "default"))
+	// the decoders take precedence
+	assert.Equal(t, "hunter2", c.GetString("secret", ""))
+}
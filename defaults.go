@@ -0,0 +1,27 @@
+package configmanager
+
+import (
+	"encoding/json"
+
+	"github.com/mixpanel/obs/obserr"
+)
+
+// RegisterDefaults registers the default values of keys, marshalled
+// as JSON, so that they are declared once instead of at every call
+// site. A registered default is used for its key when no source has
+// the key, by all the getters including the E ones: it takes precedence
+// over the default values given to the getters. It returns an error,
+// without registering any default, if a value can not be marshalled.
+func (c *client) RegisterDefaults(defaults map[string]interface{}) error {
+	raws := make(map[string]json.RawMessage, len(defaults))
+	for key, val := range defaults {
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return obserr.Annotate(err, "RegisterDefaults: error marshalling the default").Set("key", key)
+		}
+		raws[c.prefix+key] = raw
+	}
+	// all the defaults are applied in a single reload
+	c.defaults.SetMany(raws, 0)
+	return nil
+}
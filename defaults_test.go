@@ -0,0 +1,73 @@
+package configmanager
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mixpanel/configmanager/model"
+	"github.com/mixpanel/configmanager/testutil"
+)
+
+func TestRegisterDefaults(t *testing.T) {
+	c := NewTestClient().SetInt64("batch_size", 10)
+	require.NoError(t, c.RegisterDefaults(map[string]interface{}{
+		"batch_size": 100,
+		"timeout":    5,
+		"mode":       "safe",
+	}))
+	require.NoError(t, c.WithPrefix("kafka.").RegisterDefaults(map[string]interface{}{
+		"shards": 8,
+	}))
+	assert.Error(t, c.RegisterDefaults(map[string]interface{}{
+		"invalid": make(chan int),
+	}))
+
+	assert.EqualValues(t, 10, c.GetInt64("batch_size", 0))
+	timeout, err := c.GetInt64E("timeout")
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, timeout)
+	assert.Equal(t, "safe", c.GetString("mode", "fast"))
+	assert.EqualValues(t, 8, c.GetInt64("kafka.shards", 0))
+	assert.False(t, c.HasKey("invalid"))
+
+	c.SetInt64("timeout", 1)
+	assert.EqualValues(t, 1, c.GetInt64("timeout", 0))
+}
+
+func TestRegisterDefaultsSingleReload(t *testing.T) {
+	c := NewTestClient()
+	before, _, _ := c.Version()
+	require.NoError(t, c.RegisterDefaults(map[string]interface{}{
+		"batch_size": 100,
+		"timeout":    5,
+		"mode":       "safe",
+	}))
+	after, _, _ := c.Version()
+	assert.Equal(t, before+1, after)
+	assert.EqualValues(t, 5, c.GetInt64("timeout", 0))
+}
+
+func TestDefaultsFile(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{
+		Configs: []*model.Config{
+			cfg(t, "batch_size", 10),
+		},
+	}, dir, ns)
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, ns, model.DefaultsFileName), []byte(`{"batch_size": 100, "timeout": 5}`), 0777))
+
+	c, err := NewClient(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 10, c.GetInt64("batch_size", 0))
+	assert.EqualValues(t, 5, c.GetInt64("timeout", 0))
+}
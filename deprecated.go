@@ -0,0 +1,67 @@
+package configmanager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+// deprecationLogInterval is the minimum interval between
+// two logs about the reads of the same deprecated key
+const deprecationLogInterval = time.Minute
+
+// deprecations reports the reads of the configs with the
+// Deprecated field and of the old keys of aliases: every read
+// is counted and the reads of a key are logged at most once
+// per interval
+type deprecations struct {
+	fr  obs.FlightRecorder
+	now func() time.Time
+
+	mu     sync.Mutex
+	logged map[string]time.Time
+}
+
+func newDeprecations(fr obs.FlightRecorder, now func() time.Time) *deprecations {
+	return &deprecations{
+		fr:     fr.ScopeName("deprecated"),
+		now:    now,
+		logged: make(map[string]time.Time),
+	}
+}
+
+func (d *deprecations) onGet(key string, cfg *model.Config, err error) {
+	if err != nil || cfg.Deprecated == "" {
+		return
+	}
+	d.report(key, cfg.Deprecated)
+}
+
+// onAlias reports the read of an old key renamed to newKey
+func (d *deprecations) onAlias(key, newKey string) {
+	d.report(key, fmt.Sprintf("renamed to %s", newKey))
+}
+
+func (d *deprecations) report(key, deprecated string) {
+	fs := d.fr.WithSpan(context.Background())
+	fs.Incr("deprecated_key_read")
+
+	now := d.now()
+	d.mu.Lock()
+	last, ok := d.logged[key]
+	if ok && now.Sub(last) < deprecationLogInterval {
+		d.mu.Unlock()
+		return
+	}
+	d.logged[key] = now
+	d.mu.Unlock()
+	fs.Warn("deprecated_key_read", "read of a deprecated config", obs.Vals{
+		"key":        key,
+		"deprecated": deprecated,
+	})
+}
@@ -0,0 +1,38 @@
+package configmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+func TestDeprecations(t *testing.T) {
+	now := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	d := newDeprecations(obs.NullFR, func() time.Time { return now })
+	old := &model.Config{Key: "old", RawValue: []byte("1"), Deprecated: "use new instead"}
+
+	d.onGet("old", old, nil)
+	assert.Equal(t, now, d.logged["old"])
+	logged := now
+
+	now = now.Add(deprecationLogInterval / 2)
+	d.onGet("old", old, nil)
+	assert.Equal(t, logged, d.logged["old"], "reads are logged at most once per interval")
+
+	now = now.Add(deprecationLogInterval)
+	d.onGet("old", old, nil)
+	assert.Equal(t, now, d.logged["old"])
+
+	d.onGet("new", &model.Config{Key: "new", RawValue: []byte("1")}, nil)
+	d.onGet("missing", nil, model.ErrNotFound)
+	assert.Len(t, d.logged, 1)
+
+	c := NewTestClient()
+	c.dm.SetConfig(old)
+	assert.EqualValues(t, 1, c.GetInt64("old", 0))
+}
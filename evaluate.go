@@ -0,0 +1,301 @@
+package configmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mixpanel/obs/obserr"
+)
+
+// ReasonKind is the kind of rule that decided a flag
+type ReasonKind string
+
+const (
+	// ReasonWhitelisted is for projects in the whitelist of the flag
+	ReasonWhitelisted ReasonKind = "whitelisted"
+	// ReasonBlacklisted is for projects in the blacklist of the flag
+	ReasonBlacklisted ReasonKind = "blacklisted"
+	// ReasonRollout is for projects decided by their rollout bucket
+	ReasonRollout ReasonKind = "rollout"
+	// ReasonDefault is for projects no rule of the flag matched,
+	// the default of the evaluation is returned for them
+	ReasonDefault ReasonKind = "default"
+	// ReasonMissingKey is for flags missing from the configs
+	ReasonMissingKey ReasonKind = "missing_key"
+	// ReasonParseError is for flags whose value is invalid
+	ReasonParseError ReasonKind = "parse_error"
+)
+
+// Reason explains the result of EvaluateFlag
+type Reason struct {
+	Kind ReasonKind
+	// Bucket and Fraction are set for ReasonRollout:
+	// the project is enabled if Bucket < Fraction
+	Bucket   float64
+	Fraction float64
+	// Err is set for ReasonParseError
+	Err error
+}
+
+func (r Reason) String() string {
+	switch r.Kind {
+	case ReasonRollout:
+		return fmt.Sprintf("%s: bucket %.4f, fraction %.4f", r.Kind, r.Bucket, r.Fraction)
+	case ReasonParseError:
+		return fmt.Sprintf("%s: %v", r.Kind, r.Err)
+	default:
+		return string(r.Kind)
+	}
+}
+
+// flagRule is the parsed value of a flag evaluated per project:
+// a rollout, a whitelist of projects, or a composite of a blacklist,
+// a whitelist and a rollout
+type flagRule struct {
+	blacklist map[int64]struct{}
+	// whitelist is nil without a whitelist
+	whitelist *projectList
+	ramp      *Ramp
+}
+
+// compositeFlag is the value of a composite flag, e.g.
+// {"whitelist": [1, 2], "blacklist": [3], "percent": 0.25}
+type compositeFlag struct {
+	// Whitelist is a list of ids or a project list
+	// like the ones of IsProjectWhitelisted
+	Whitelist json.RawMessage `json:"whitelist"`
+	Blacklist []int64         `json:"blacklist"`
+	Percent   *Ramp           `json:"percent"`
+	// Salt is the salt of Percent if it has none
+	Salt string `json:"salt"`
+}
+
+// compositeWhitelist parses the whitelist of a composite flag,
+// either an array of ids or a project list, nil if it has none
+func compositeWhitelist(raw json.RawMessage) (*projectList, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var ids []int64
+	if json.Unmarshal(raw, &ids) == nil {
+		return &projectList{ids: newIDSet(ids)}, nil
+	}
+	list := &projectList{}
+	if err := json.Unmarshal(raw, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func projectSet(projects []int64) map[int64]struct{} {
+	set := make(map[int64]struct{}, len(projects))
+	for _, projectID := range projects {
+		set[projectID] = struct{}{}
+	}
+	return set
+}
+
+func (r *flagRule) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) == nil {
+		_, hasWhitelist := fields["whitelist"]
+		_, hasBlacklist := fields["blacklist"]
+		_, hasPercent := fields["percent"]
+		if hasWhitelist || hasBlacklist || hasPercent {
+			var composite compositeFlag
+			if err := json.Unmarshal(data, &composite); err != nil {
+				return obserr.Annotate(err, "invalid composite flag")
+			}
+			whitelist, err := compositeWhitelist(composite.Whitelist)
+			if err != nil {
+				return obserr.Annotate(err, "invalid whitelist of the composite flag")
+			}
+			r.blacklist = projectSet(composite.Blacklist)
+			r.whitelist = whitelist
+			r.ramp = composite.Percent
+			if r.ramp != nil && r.ramp.Salt == "" {
+				r.ramp.Salt = composite.Salt
+			}
+			return nil
+		}
+	}
+
+	var ramp Ramp
+	rampErr := json.Unmarshal(data, &ramp)
+	if rampErr == nil {
+		r.ramp = &ramp
+		return nil
+	}
+	whitelist := &projectList{}
+	if err := json.Unmarshal(data, whitelist); err != nil {
+		return obserr.Annotate(rampErr, "flag is neither a rollout nor a whitelist")
+	}
+	r.whitelist = whitelist
+	return nil
+}
+
+func (c *client) getFlagRule(key string) (*flagRule, error) {
+	config, err := c.sm.GetKey(key)
+	if err != nil {
+		return nil, obserr.Annotate(err, "getFlagRule: error getting key from sm")
+	}
+	if pv, ok := c.sm.GetParsedValue(config).(*flagRule); ok {
+		return pv, nil
+	}
+	val := &flagRule{}
+	if err := c.decode(key, config.RawValue, val); err != nil {
+		return nil, obserr.Annotate(err, "getFlagRule: error unmarshaling value")
+	}
+	c.learnParsed(key, ParsedFlag)
+	c.sm.SetParsedValue(config, val)
+	return val, nil
+}
+
+// EvaluateFlag returns whether the flag in key is enabled for the project
+// and why. The flag is either a rollout fraction, see GetRolloutFraction,
+// with projects bucketed like IsFeatureEnabledForProject, a whitelist of
+// projects like IsProjectWhitelisted, or a composite of both, see
+// IsEnabledForProject. enabledByDefault is returned when the flag is
+// missing or invalid, or when no rule of the flag matches the project,
+// e.g. for the projects not in the blacklist of a flag without percent.
+func (c *client) EvaluateFlag(key string, projectID int64, enabledByDefault bool) (bool, Reason) {
+	fs := c.fr.ScopeName("evaluate_flag").WithSpan(context.Background())
+	rule, err := c.getFlagRule(key)
+	if IsNotFound(err) {
+		return enabledByDefault, Reason{Kind: ReasonMissingKey}
+	}
+	if err != nil {
+		c.logErrGet(err, key, enabledByDefault, fs)
+		return enabledByDefault, Reason{Kind: ReasonParseError, Err: err}
+	}
+
+	if _, ok := rule.blacklist[projectID]; ok {
+		return false, Reason{Kind: ReasonBlacklisted}
+	}
+	now := c.opts.now()
+	if rule.whitelist != nil && rule.whitelist.contains(projectID, now) {
+		return true, Reason{Kind: ReasonWhitelisted}
+	}
+	if rule.ramp != nil {
+		b := bucket(key, rule.ramp.Salt, strconv.FormatInt(projectID, 10))
+		fraction := rule.ramp.FractionAt(now)
+		return b < fraction, Reason{Kind: ReasonRollout, Bucket: b, Fraction: fraction}
+	}
+	return enabledByDefault, Reason{Kind: ReasonDefault}
+}
+
+// EvaluateFlagForID returns whether the flag in key is enabled for id,
+// e.g. a token, and why. The flag is either a rollout fraction, with ids
+// bucketed like IsFeatureEnabledForID, or a whitelist of members like
+// IsMemberWhitelisted. enabledByDefault is returned when the flag is
+// missing or invalid, or when id is not in the whitelist.
+func (c *client) EvaluateFlagForID(key string, id string, enabledByDefault bool) (bool, Reason) {
+	ramp, rampErr := c.getRamp(key)
+	if IsNotFound(rampErr) {
+		return enabledByDefault, Reason{Kind: ReasonMissingKey}
+	}
+	if rampErr == nil {
+		b := bucket(key, ramp.Salt, id)
+		fraction := ramp.FractionAt(c.opts.now())
+		return b < fraction, Reason{Kind: ReasonRollout, Bucket: b, Fraction: fraction}
+	}
+	list, err := c.getMemberList(key)
+	if err != nil {
+		fs := c.fr.ScopeName("evaluate_flag").WithSpan(context.Background())
+		err = obserr.Annotate(rampErr, "flag is neither a rollout nor a whitelist")
+		c.logErrGet(err, key, enabledByDefault, fs)
+		return enabledByDefault, Reason{Kind: ReasonParseError, Err: err}
+	}
+	if list.contains(id) {
+		return true, Reason{Kind: ReasonWhitelisted}
+	}
+	return enabledByDefault, Reason{Kind: ReasonDefault}
+}
+
+// IsEnabledForProject evaluates a composite flag such as
+// {"whitelist": [1, 2], "blacklist": [3], "percent": 0.25}: projects in
+// the blacklist are always disabled, projects in the whitelist are always
+// enabled and the other projects are enabled by their sticky rollout
+// bucket. Any part may be left out, percent may be a Ramp and the
+// whitelist may be a project list like the ones of IsProjectWhitelisted,
+// with ranges and expiring entries. See EvaluateFlag for the other
+// values accepted.
+func (c *client) IsEnabledForProject(key string, projectID int64, enabledByDefault bool) bool {
+	enabled, _ := c.EvaluateFlag(key, projectID, enabledByDefault)
+	c.expose(key, strconv.FormatInt(projectID, 10), enabled)
+	return enabled
+}
+
+// flagEvaluation is the response of FlagHandler
+type flagEvaluation struct {
+	Key       string     `json:"key"`
+	ProjectID *int64     `json:"project_id,omitempty"`
+	Token     string     `json:"token,omitempty"`
+	Enabled   bool       `json:"enabled"`
+	Reason    ReasonKind `json:"reason"`
+	Bucket    *float64   `json:"bucket,omitempty"`
+	Fraction  *float64   `json:"fraction,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// Explanation is Reason.String()
+	Explanation string `json:"explanation"`
+}
+
+// FlagHandler answers whether the flag in key is enabled right now for a
+// project, with EvaluateFlag, or for a token, with EvaluateFlagForID, and
+// why, e.g. on an admin endpoint such as /configz/flags:
+//
+//	/configz/flags?key=new_ui&project=123
+//	/configz/flags?key=new_ui&token=abc&default=true
+//
+// default is the enabledByDefault of the evaluation, false if omitted.
+// The evaluations are not reported to the exposure hook.
+func FlagHandler(c Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		key := q.Get("key")
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		enabledByDefault := false
+		if def := q.Get("default"); def != "" {
+			var err error
+			if enabledByDefault, err = strconv.ParseBool(def); err != nil {
+				http.Error(w, "default must be true or false", http.StatusBadRequest)
+				return
+			}
+		}
+
+		e := flagEvaluation{Key: key}
+		var reason Reason
+		switch project, token := q.Get("project"), q.Get("token"); {
+		case project != "" && token == "":
+			projectID, err := strconv.ParseInt(project, 10, 64)
+			if err != nil {
+				http.Error(w, "project must be a project id", http.StatusBadRequest)
+				return
+			}
+			e.ProjectID = &projectID
+			e.Enabled, reason = c.EvaluateFlag(key, projectID, enabledByDefault)
+		case token != "" && project == "":
+			e.Token = token
+			e.Enabled, reason = c.EvaluateFlagForID(key, token, enabledByDefault)
+		default:
+			http.Error(w, "one of project and token is required", http.StatusBadRequest)
+			return
+		}
+		e.Reason = reason.Kind
+		e.Explanation = reason.String()
+		if reason.Kind == ReasonRollout {
+			e.Bucket, e.Fraction = &reason.Bucket, &reason.Fraction
+		}
+		if reason.Err != nil {
+			e.Error = reason.Err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+	})
+}
@@ -0,0 +1,188 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateFlag(t *testing.T) {
+	c := NewTestClient().
+		SetProjectsWhitelist("whitelist", 1, 2).
+		SetFloat64("rollout", 0.5).
+		SetString("invalid", "yes")
+
+	enabled, reason := c.EvaluateFlag("whitelist", 1, false)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonWhitelisted, reason.Kind)
+
+	enabled, reason = c.EvaluateFlag("whitelist", 3, true)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonDefault, reason.Kind)
+	enabled, _ = c.EvaluateFlag("whitelist", 3, false)
+	assert.False(t, enabled)
+
+	for projectID := int64(0); projectID < 100; projectID++ {
+		enabled, reason = c.EvaluateFlag("rollout", projectID, false)
+		assert.Equal(t, ReasonRollout, reason.Kind)
+		assert.Equal(t, 0.5, reason.Fraction)
+		assert.Equal(t, reason.Bucket < 0.5, enabled)
+		assert.Equal(t, c.IsFeatureEnabledForProject("rollout", projectID, false), enabled)
+	}
+
+	enabled, reason = c.EvaluateFlag("missing", 1, true)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonMissingKey, reason.Kind)
+
+	enabled, reason = c.EvaluateFlag("invalid", 1, true)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonParseError, reason.Kind)
+	assert.Error(t, reason.Err)
+}
+
+func TestIsEnabledForProject(t *testing.T) {
+	c := NewTestClient().
+		SetRaw("composite", []byte(`{"whitelist": [1, 3], "blacklist": [3, 4], "percent": 0.25}`)).
+		SetRaw("lists", []byte(`{"whitelist": [1]}`))
+
+	assert.True(t, c.IsEnabledForProject("composite", 1, false))
+	assert.False(t, c.IsEnabledForProject("composite", 3, true), "blacklist wins")
+	assert.False(t, c.IsEnabledForProject("composite", 4, true))
+
+	enabled := 0
+	for projectID := int64(10); projectID < 10010; projectID++ {
+		if c.IsEnabledForProject("composite", projectID, false) {
+			enabled++
+		}
+	}
+	assert.InDelta(t, 2500, enabled, 300)
+
+	_, reason := c.EvaluateFlag("composite", 3, false)
+	assert.Equal(t, ReasonBlacklisted, reason.Kind)
+	assert.True(t, c.IsEnabledForProject("lists", 1, false))
+	enabled2, reason := c.EvaluateFlag("lists", 2, true)
+	assert.True(t, enabled2)
+	assert.Equal(t, ReasonDefault, reason.Kind)
+}
+
+func TestEvaluateBlacklistOnlyFlag(t *testing.T) {
+	c := NewTestClient().
+		SetRaw("blacklist", []byte(`{"blacklist": [3]}`))
+
+	enabled, reason := c.EvaluateFlag("blacklist", 3, true)
+	assert.False(t, enabled)
+	assert.Equal(t, ReasonBlacklisted, reason.Kind)
+
+	// the other projects get the default of the caller
+	enabled, reason = c.EvaluateFlag("blacklist", 4, true)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonDefault, reason.Kind)
+	assert.True(t, c.IsEnabledForProject("blacklist", 4, true))
+	assert.False(t, c.IsEnabledForProject("blacklist", 4, false))
+}
+
+func TestEvaluateFlagProjectLists(t *testing.T) {
+	c := NewTestClient().
+		SetRaw("expiring", []byte(`{"1": {"expires": "2020-01-01T00:00:00Z"}, "2": {"expires": "2999-01-01T00:00:00Z"}}`)).
+		SetRaw("ranges", []byte(`{"ranges": [[1000, 1999]], "ids": [42]}`)).
+		SetRaw("composite", []byte(`{"whitelist": {"ranges": [[1000, 1999]], "1": {"expires": "2020-01-01T00:00:00Z"}}, "blacklist": [1500]}`))
+
+	enabled, reason := c.EvaluateFlag("expiring", 1, false)
+	assert.False(t, enabled, "expired entry")
+	assert.Equal(t, ReasonDefault, reason.Kind)
+	enabled, reason = c.EvaluateFlag("expiring", 2, false)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonWhitelisted, reason.Kind)
+
+	for _, projectID := range []int64{42, 1000, 1500, 1999} {
+		enabled, reason = c.EvaluateFlag("ranges", projectID, false)
+		assert.True(t, enabled)
+		assert.Equal(t, ReasonWhitelisted, reason.Kind)
+		assert.Equal(t, c.IsProjectWhitelisted("ranges", projectID, false), enabled)
+	}
+	enabled, reason = c.EvaluateFlag("ranges", 2000, false)
+	assert.False(t, enabled)
+	assert.Equal(t, ReasonDefault, reason.Kind)
+
+	assert.True(t, c.IsEnabledForProject("composite", 1000, false))
+	assert.False(t, c.IsEnabledForProject("composite", 1500, true), "blacklist wins")
+	assert.False(t, c.IsEnabledForProject("composite", 1, false), "expired entry")
+}
+
+func TestEvaluateFlagForID(t *testing.T) {
+	c := NewTestClient().
+		SetMembersWhitelist("whitelist", "abc", "internal-*").
+		SetFloat64("rollout", 0.5).
+		SetString("invalid", "yes")
+
+	enabled, reason := c.EvaluateFlagForID("whitelist", "internal-1", false)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonWhitelisted, reason.Kind)
+
+	enabled, reason = c.EvaluateFlagForID("whitelist", "def", true)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonDefault, reason.Kind)
+	enabled, _ = c.EvaluateFlagForID("whitelist", "def", false)
+	assert.False(t, enabled)
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		enabled, reason = c.EvaluateFlagForID("rollout", id, false)
+		assert.Equal(t, ReasonRollout, reason.Kind)
+		assert.Equal(t, c.IsFeatureEnabledForID("rollout", id, false), enabled)
+	}
+
+	enabled, reason = c.EvaluateFlagForID("missing", "abc", true)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonMissingKey, reason.Kind)
+
+	enabled, reason = c.EvaluateFlagForID("invalid", "abc", true)
+	assert.True(t, enabled)
+	assert.Equal(t, ReasonParseError, reason.Kind)
+}
+
+func TestFlagHandler(t *testing.T) {
+	c := NewTestClient().
+		SetProjectsWhitelist("whitelist", 1).
+		SetMembersWhitelist("tokens", "abc").
+		SetFloat64("rollout", 0.5)
+	get := func(query string) (int, flagEvaluation) {
+		rec := httptest.NewRecorder()
+		FlagHandler(c).ServeHTTP(rec, httptest.NewRequest("GET", "/configz/flags?"+query, nil))
+		var e flagEvaluation
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &e))
+		}
+		return rec.Code, e
+	}
+
+	code, e := get("key=whitelist&project=1")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, e.Enabled)
+	assert.Equal(t, ReasonWhitelisted, e.Reason)
+	assert.EqualValues(t, 1, *e.ProjectID)
+
+	code, e = get("key=tokens&token=def&default=true")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, e.Enabled)
+	assert.Equal(t, ReasonDefault, e.Reason)
+
+	code, e = get("key=rollout&project=7")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ReasonRollout, e.Reason)
+	assert.Equal(t, 0.5, *e.Fraction)
+	assert.Equal(t, *e.Bucket < 0.5, e.Enabled)
+
+	code, e = get("key=missing&token=abc&default=true")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, e.Enabled)
+	assert.Equal(t, ReasonMissingKey, e.Reason)
+
+	for _, query := range []string{"project=1", "key=rollout", "key=rollout&project=1&token=abc", "key=rollout&project=x", "key=rollout&project=1&default=maybe"} {
+		code, _ = get(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
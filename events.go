@@ -0,0 +1,108 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+// DefaultEventBuffer is the number of ChangeEvents
+// buffered by Events unless WithEventBuffer is used
+const DefaultEventBuffer = 256
+
+// ChangeEvent is the change of the value of a key by a reload
+type ChangeEvent struct {
+	Key string
+	// Old is nil for added keys and New is nil for removed keys
+	Old json.RawMessage
+	New json.RawMessage
+	// Generation is the generation of the configs
+	// with the change, like returned by Version
+	Generation uint64
+	Time       time.Time
+}
+
+// changeEvents sends the changes of every reload to a buffered
+// channel, dropping the oldest events when the buffer is full. It is
+// guarded by the mutex of versionTracker.
+type changeEvents struct {
+	ch     chan ChangeEvent
+	cancel func()
+	closed bool
+}
+
+// diffed sends the events of d, in key order and the removed keys last
+func (e *changeEvents) diffed(d model.Diff, gen uint64, at time.Time) {
+	if e.closed {
+		return
+	}
+	changes := append(append([]model.KeyChange{}, d.Added...), d.Changed...)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	for _, c := range append(changes, d.Removed...) {
+		e.send(ChangeEvent{Key: c.Key, Old: c.Old, New: c.New, Generation: gen, Time: at})
+	}
+}
+
+// send drops the oldest event if the buffer is full. The
+// receivers only take events so the send can not block.
+func (e *changeEvents) send(event ChangeEvent) {
+	for {
+		select {
+		case e.ch <- event:
+			return
+		default:
+		}
+		select {
+		case <-e.ch:
+		default:
+		}
+	}
+}
+
+func (e *changeEvents) close() {
+	if e.cancel != nil {
+		e.cancel()
+	}
+	if !e.closed {
+		e.closed = true
+		close(e.ch)
+	}
+}
+
+// WithEventBuffer sets the number of ChangeEvents buffered
+// by Events before the oldest ones are dropped
+func WithEventBuffer(size int) Option {
+	return func(o *options) {
+		o.eventBuffer = size
+	}
+}
+
+// Events returns a channel receiving a ChangeEvent for every key
+// added, removed or changed by the reloads after the first call, e.g.
+// to invalidate caches without polling. The events of a reload are sent
+// in key order, removed keys last. When the receiver falls behind the
+// oldest events are dropped. The channel is shared by all the callers
+// and the views of the client and is closed by Close.
+func (c *client) Events() <-chan ChangeEvent {
+	v := c.version
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.events == nil {
+		size := c.opts.eventBuffer
+		if size <= 0 {
+			size = DefaultEventBuffer
+		}
+		events := &changeEvents{ch: make(chan ChangeEvent, size)}
+		// the callbacks of a reload are called in the order they were
+		// registered, so the generation of the reload is already counted
+		events.cancel = v.sm.OnDiff(func(d model.Diff) {
+			v.mu.Lock()
+			defer v.mu.Unlock()
+			events.diffed(d, v.gen, v.loadedAt)
+		})
+		v.events = events
+	}
+	return v.events.ch
+}
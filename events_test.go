@@ -0,0 +1,47 @@
+package configmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewTestClient(WithNow(func() time.Time { return now }), WithEventBuffer(2))
+	c.dm.SetConfig(&model.Config{Key: "foo", RawValue: []byte("1")})
+
+	events := c.Events()
+	c.dm.SetConfig(&model.Config{Key: "foo", RawValue: []byte("2")})
+	gen, _, _ := c.Version()
+	event := <-events
+	assert.Equal(t, ChangeEvent{Key: "foo", Old: []byte("1"), New: []byte("2"), Generation: gen, Time: now}, event)
+
+	c.SetOverride("bar", []byte("3"), 0)
+	c.ClearOverride("bar")
+	event = <-events
+	assert.Equal(t, "bar", event.Key)
+	assert.Nil(t, event.Old)
+	assert.Equal(t, "3", string(event.New))
+	event = <-events
+	assert.Equal(t, "bar", event.Key)
+	assert.Equal(t, "3", string(event.Old))
+	assert.Nil(t, event.New)
+
+	// the oldest events are dropped when the buffer is full
+	for i := 3; i <= 6; i++ {
+		c.SetInt64("foo", int64(i))
+	}
+	assert.Equal(t, "5", string((<-events).New))
+	assert.Equal(t, "6", string((<-events).New))
+
+	// views share the channel
+	assert.Equal(t, events, c.WithPrefix("f").Events())
+
+	c.Close()
+	_, ok := <-events
+	assert.False(t, ok)
+}
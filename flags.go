@@ -0,0 +1,53 @@
+package configmanager
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OverrideFlagName is the name of the flag
+// registered by RegisterOverrideFlag
+const OverrideFlagName = "config-override"
+
+// FlagOverrides is a repeatable flag.Value collecting
+// key=value overrides for configs
+type FlagOverrides map[string]string
+
+func (f FlagOverrides) String() string {
+	kvs := make([]string, 0, len(f))
+	for key, val := range f {
+		kvs = append(kvs, key+"="+val)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+// Set parses a key=value override. The value is used as is
+// if it is valid JSON and as a JSON string otherwise.
+func (f FlagOverrides) Set(kv string) error {
+	parts := strings.SplitN(kv, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("Invalid config override %q, expected key=value", kv)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// RegisterOverrideFlag registers the repeatable -config-override
+// key=value flag on fs, or on flag.CommandLine if fs is nil, and
+// returns the overrides to pass to WithFlagOverrides, e.g.
+//
+//	overrides := configmanager.RegisterOverrideFlag(nil)
+//	flag.Parse()
+//	cm, err := configmanager.NewClient("/etc/configs", "my-service", fr,
+//		configmanager.WithFlagOverrides(overrides))
+func RegisterOverrideFlag(fs *flag.FlagSet) FlagOverrides {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	f := make(FlagOverrides)
+	fs.Var(f, OverrideFlagName, "Override a config with key=value, can be repeated")
+	return f
+}
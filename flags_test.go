@@ -0,0 +1,42 @@
+package configmanager
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/mixpanel/configmanager/model"
+	"github.com/mixpanel/configmanager/testutil"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagOverrides(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	overrides := RegisterOverrideFlag(fs)
+	require.NoError(t, fs.Parse([]string{
+		"-config-override", "foo=3",
+		"-config-override=name=bar",
+	}))
+	assert.Error(t, fs.Parse([]string{"-config-override", "foo"}))
+
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "foo", 1),
+			cfg(t, "name", "baz"),
+		},
+	}
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+	ns := getNs()
+	writePersistToFile(t, persist, dir, ns)
+
+	c, err := NewClient(dir, ns, obs.NullFR, WithFlagOverrides(overrides))
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.EqualValues(t, 3, c.GetInt64("foo", 0))
+	assert.Equal(t, "bar", c.GetString("name", ""))
+}
@@ -0,0 +1,102 @@
+package configmanager
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/obs/obserr"
+)
+
+// ErrUnhealthy is returned by Healthy when the
+// configs served may not be the ones of the source
+var ErrUnhealthy = errors.New("configs are unhealthy")
+
+// healthTracker records the results of the loads of the configs
+type healthTracker struct {
+	now    func() time.Time
+	window time.Duration
+
+	mu     sync.Mutex
+	loaded bool
+	// errs is the error of the last load of every source
+	// whose last load failed, by the path of the source
+	errs      map[string]error
+	validated time.Time
+}
+
+// onLoad records the result of a load from one of the sources
+func (h *healthTracker) onLoad(source string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		if h.errs == nil {
+			h.errs = make(map[string]error)
+		}
+		h.errs[source] = err
+		return
+	}
+	delete(h.errs, source)
+	h.loaded = true
+	h.validated = h.now()
+}
+
+// failed returns one of the sources whose last load
+// failed and its error, the first in sorted order
+func (h *healthTracker) failed() (string, error) {
+	sources := make([]string, 0, len(h.errs))
+	for source := range h.errs {
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		return "", nil
+	}
+	sort.Strings(sources)
+	return sources[0], h.errs[sources[0]]
+}
+
+func (h *healthTracker) healthy() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	source, err := h.failed()
+	if err != nil && !h.loaded {
+		return obserr.Annotate(ErrUnhealthy, "configs were never loaded from their source").Set("source", source, "load_error", err.Error())
+	}
+	if err != nil {
+		return obserr.Annotate(ErrUnhealthy, "last reload of the configs failed").Set("source", source, "load_error", err.Error())
+	}
+	if h.window > 0 {
+		if age := h.now().Sub(h.validated); age > h.window {
+			return obserr.Annotate(ErrUnhealthy, "configs were not validated within the window").Set(
+				"validated_at", h.validated,
+				"window", h.window,
+			)
+		}
+	}
+	return nil
+}
+
+// WithHealthWindow makes Healthy report the configs as unhealthy when
+// they were not loaded or re-validated for longer than window. The
+// files are only re-read when they change, use it with
+// WithResyncInterval and a window a few times the interval. The
+// window does not apply to the clients of NewClientFromMemory.
+func WithHealthWindow(window time.Duration) Option {
+	return func(o *options) {
+		o.healthWindow = window
+	}
+}
+
+// Healthy returns an error wrapping ErrUnhealthy if the configs were
+// never loaded from their source, e.g. when starting from the last
+// known good configs, if the last reload failed, or if the configs were
+// not re-validated within the window of WithHealthWindow. It is meant
+// to be the health check of the service, e.g. a readiness probe.
+func (c *client) Healthy(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return obserr.Annotate(err, "Healthy: context is done")
+	}
+	return c.health.healthy()
+}
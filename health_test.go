@@ -0,0 +1,106 @@
+package configmanager
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+	"github.com/mixpanel/configmanager/testutil"
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthy(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var elapsed int64
+	now := func() time.Time { return start.Add(time.Duration(atomic.LoadInt64(&elapsed))) }
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	c, err := NewClient(dir, ns, obs.NullFR, WithNow(now), WithHealthWindow(time.Minute))
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+	assert.NoError(t, c.Healthy(ctx))
+
+	filePath := path.Join(dir, ns, "configs.json")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`[{"key": "foo", "val`), 0777))
+	assert.Error(t, c.Reload())
+	err = c.Healthy(ctx)
+	assert.Equal(t, ErrUnhealthy, obserr.Original(err))
+	assert.Contains(t, err.Error(), "last reload")
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`[{"key": "foo", "value": 2}]`), 0777))
+	require.NoError(t, c.Reload())
+	assert.NoError(t, c.Healthy(ctx))
+
+	// the configs are stale once the window passed without a load
+	atomic.AddInt64(&elapsed, int64(2*time.Minute))
+	err = c.Healthy(ctx)
+	assert.Equal(t, ErrUnhealthy, obserr.Original(err))
+	assert.Contains(t, err.Error(), "window")
+	require.NoError(t, c.Reload())
+	assert.NoError(t, c.WithPrefix("f").Healthy(ctx))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, c.Healthy(canceled))
+
+	// starting without the file is not healthy
+	ns = getNs()
+	require.NoError(t, os.Mkdir(path.Join(dir, ns), 0777))
+	lenient, err := NewClient(dir, ns, obs.NullFR, WithLenientStart())
+	require.NoError(t, err)
+	defer lenient.Close()
+	err = lenient.Healthy(ctx)
+	assert.Equal(t, ErrUnhealthy, obserr.Original(err))
+	assert.Contains(t, err.Error(), "never loaded")
+
+	// clients without a source to load are healthy
+	assert.NoError(t, NewTestClient().Healthy(ctx))
+}
+
+func TestHealthTrackerSources(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &healthTracker{now: func() time.Time { return now }, validated: now}
+	h.onLoad("/configs/ns/configs.json", nil)
+	h.onLoad("/configs/ns/overrides.json", nil)
+	assert.NoError(t, h.healthy())
+
+	// a broken configs.json stays unhealthy while overrides.json reloads
+	h.onLoad("/configs/ns/configs.json", errors.New("invalid character"))
+	h.onLoad("/configs/ns/overrides.json", nil)
+	err := h.healthy()
+	assert.Equal(t, ErrUnhealthy, obserr.Original(err))
+	assert.Contains(t, err.Error(), "last reload")
+	assert.Contains(t, err.Error(), "configs.json")
+
+	h.onLoad("/configs/ns/configs.json", nil)
+	assert.NoError(t, h.healthy())
+}
+
+// the configs pushed to memory are not stale, whatever the window
+func TestHealthyMemory(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var elapsed int64
+	now := func() time.Time { return start.Add(time.Duration(atomic.LoadInt64(&elapsed))) }
+
+	msm := model.NewMemoryStateManager(getNs(), []*model.Config{cfg(t, "foo", 1)}, obs.NullFR, model.WithoutExpvar())
+	c, err := NewClientFromMemory(msm, "memory", obs.NullFR, WithNow(now), WithHealthWindow(time.Minute))
+	require.NoError(t, err)
+	defer c.Close()
+	atomic.AddInt64(&elapsed, int64(2*time.Minute))
+	assert.NoError(t, c.Healthy(context.Background()))
+}
@@ -0,0 +1,30 @@
+package configmanager
+
+import (
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// NewClientFromURL returns a client reading the configs.json document
+// at url, polled about every interval, for processes running outside of
+// Kubernetes such as CLIs or lambdas. The document is only downloaded
+// again when its ETag or Last-Modified changed, and the last configs
+// loaded are kept when a poll fails. WithHTTPClient sets the client
+// making the requests, e.g. to authenticate them.
+func NewClientFromURL(url, scope string, interval time.Duration, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	o := newOptions(opts)
+	fr = fr.ScopeName("config_manager")
+	sm, err := model.NewHTTPStateManager(o.httpClient, url, scope, interval, fr, o.smOpts...)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating http config manager client").Set("url", url)
+	}
+	c, err := newCheckedClient(o.withOverrides(sm, scope), fr, o)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating http config manager client").Set("url", url)
+	}
+	return c, nil
+}
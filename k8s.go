@@ -0,0 +1,42 @@
+package configmanager
+
+import (
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// NewClientFromK8s returns a client reading the configs from the
+// ConfigMap namespace/name through the Kubernetes API instead of a
+// mounted volume, so that changes propagate in about a second instead
+// of waiting for the kubelet sync. The configs.json key of the ConfigMap
+// holds the configs. The in-cluster service account is used unless
+// WithK8sConfig is given; it needs get and watch on the ConfigMap.
+func NewClientFromK8s(namespace, name, scope string, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	o := newOptions(opts)
+	cfg := o.k8sConfig
+	if cfg == nil {
+		var err error
+		if cfg, err = model.InClusterK8sConfig(); err != nil {
+			return nil, obserr.Annotate(err, "Error creating k8s config manager client")
+		}
+	}
+
+	fr = fr.ScopeName("config_manager")
+	sm, err := model.NewK8sStateManager(cfg, namespace, name, scope, fr, o.smOpts...)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating k8s config manager client").Set(
+			"namespace", namespace,
+			"name", name,
+		)
+	}
+	c, err := newCheckedClient(o.withOverrides(sm, scope), fr, o)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating k8s config manager client").Set(
+			"namespace", namespace,
+			"name", name,
+		)
+	}
+	return c, nil
+}
@@ -0,0 +1,81 @@
+package configmanager
+
+import (
+	"sync"
+)
+
+// lifecycle stops the watches of a client on Close and
+// closes the channel returned by Done once it is closed
+type lifecycle struct {
+	mu      sync.Mutex
+	closed  bool
+	done    chan struct{}
+	nextID  int
+	cancels map[int]func()
+	// running counts the goroutines of the watches
+	running sync.WaitGroup
+}
+
+// doneChan returns the channel closed by close
+func (l *lifecycle) doneChan() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done == nil {
+		l.done = make(chan struct{})
+	}
+	return l.done
+}
+
+// track registers the cancel func of a watch, which must call
+// untrack, and counts its goroutine until it calls running.Done.
+// It returns false if the client is already closed.
+func (l *lifecycle) track(cancel func()) (id int, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, false
+	}
+	if l.cancels == nil {
+		l.cancels = make(map[int]func())
+	}
+	id = l.nextID
+	l.nextID++
+	l.cancels[id] = cancel
+	l.running.Add(1)
+	return id, true
+}
+
+func (l *lifecycle) untrack(id int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cancels, id)
+}
+
+// close cancels the watches, calls release, waits for the goroutines
+// of the watches and closes the done channel. Only the first call
+// does anything, the others return once the first is done.
+func (l *lifecycle) close(release func()) {
+	l.mu.Lock()
+	if l.done == nil {
+		l.done = make(chan struct{})
+	}
+	done := l.done
+	if l.closed {
+		l.mu.Unlock()
+		<-done
+		return
+	}
+	l.closed = true
+	cancels := make([]func(), 0, len(l.cancels))
+	for _, cancel := range l.cancels {
+		cancels = append(cancels, cancel)
+	}
+	l.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	release()
+	l.running.Wait()
+	close(done)
+}
@@ -0,0 +1,27 @@
+package configmanager
+
+import (
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// NewClientFromMemory returns a client reading the configs pushed to sm,
+// for applications receiving their configs from their own control plane.
+// The client gets the same caching and subscriptions as with the other
+// sources. Closing the client closes sm. Options of the StateManager,
+// such as debouncing, must be given to model.NewMemoryStateManager.
+// The window of WithHealthWindow does not apply to the client.
+func NewClientFromMemory(sm *model.MemoryStateManager, scope string, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	o := newOptions(opts)
+	// the pushes are not loads from a source that may be
+	// missed, the configs are as fresh as the last push
+	o.health.window = 0
+	fr = fr.ScopeName("config_manager")
+	c, err := newCheckedClient(o.withOverrides(sm, scope), fr, o)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating in-memory config manager client").Set("scope", scope)
+	}
+	return c, nil
+}
@@ -0,0 +1,59 @@
+package configmanager
+
+import (
+	"github.com/mixpanel/configmanager/model"
+)
+
+// Metrics receives the events of a Client worth exporting as metrics,
+// e.g. to Prometheus collectors, so that services can alert on configs
+// that failed to load for too long or on getters falling back to their
+// defaults. The methods are called on the hot path and must be cheap
+// and safe to call concurrently.
+type Metrics interface {
+	// Loaded is called after every load of the configs from one of
+	// their sources with the error of the load, nil when the configs
+	// were loaded or did not change. The time of the last call with
+	// a nil error is the time of the last successful load.
+	Loaded(err error)
+	// Read is called on every read of key, found is false
+	// if none of the sources has key
+	Read(key string, found bool)
+	// DefaultUsed is called every time a getter returns the default
+	// value of key, with the cause, one of not_found, wrong_type and
+	// invalid_value, and the error
+	DefaultUsed(key, cause string, err error)
+}
+
+// StateSizeMetrics is implemented by the Metrics that
+// also export the memory held by the configs
+type StateSizeMetrics interface {
+	// StateSize is called after every load that changed the configs
+	// with the size in bytes of their keys and values
+	StateSize(bytes int64)
+}
+
+// WithMetrics reports the loads of the configs, the reads of
+// the keys and the fallbacks to the default values to m, and
+// the size of the configs if m is a StateSizeMetrics
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+		o.smOpts = append(o.smOpts, model.WithOnLoad(m.Loaded))
+		if sm, ok := m.(StateSizeMetrics); ok {
+			o.smOpts = append(o.smOpts, model.WithOnStateSize(sm.StateSize))
+		}
+	}
+}
+
+// observeGet returns the func called with the result of every read
+// of the StateManager, reporting deprecated keys, recording the usage
+// and reporting the reads to metrics, if not nil
+func observeGet(deprecations *deprecations, usage *usageTracker, metrics Metrics) func(key string, cfg *model.Config, err error) {
+	return func(key string, cfg *model.Config, err error) {
+		deprecations.onGet(key, cfg, err)
+		usage.onGet(key, cfg, err)
+		if metrics != nil {
+			metrics.Read(key, err == nil)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package configmanager
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/mixpanel/configmanager/model"
+	"github.com/mixpanel/configmanager/testutil"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMetrics struct {
+	mu       sync.Mutex
+	loads    []error
+	reads    map[string]int
+	defaults map[string]int
+	sizes    []int64
+}
+
+func (m *testMetrics) Loaded(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads = append(m.loads, err)
+}
+
+func (m *testMetrics) Read(key string, found bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads[key]++
+}
+
+func (m *testMetrics) DefaultUsed(key, cause string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.defaults[key]++
+}
+
+func (m *testMetrics) StateSize(bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sizes = append(m.sizes, bytes)
+}
+
+func TestMetrics(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1), cfg(t, "bar", "x")}}, dir, ns)
+	m := &testMetrics{reads: map[string]int{}, defaults: map[string]int{}}
+	c, err := NewClient(dir, ns, obs.NullFR, WithMetrics(m))
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+	assert.EqualValues(t, 2, c.GetInt64("missing", 2))
+	assert.EqualValues(t, 3, c.GetInt64("bar", 3))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	require.NotEmpty(t, m.loads)
+	assert.NoError(t, m.loads[0])
+	assert.Equal(t, 1, m.reads["foo"])
+	assert.Equal(t, 1, m.reads["missing"])
+	assert.Equal(t, 0, m.defaults["foo"])
+	assert.Equal(t, 1, m.defaults["missing"])
+	assert.Equal(t, 1, m.defaults["bar"])
+	// foo 1 bar "x"
+	assert.Equal(t, []int64{10}, m.sizes)
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// AliasesKey is the config holding aliases in the config
+// file, an object mapping old keys to their new keys
+const AliasesKey = "configmanager.aliases"
+
+// aliasStateManager resolves renamed keys to their new keys
+type aliasStateManager struct {
+	StateManager
+	aliases map[string]string
+	onAlias func(old, new string)
+
+	// resolved holds the map[string]string of the aliases merged
+	// with the ones of the AliasesKey config, rebuilt on reloads
+	// so that reads do not look the config up
+	resolved atomic.Value
+	cancel   func()
+}
+
+// NewAliasStateManager returns a view of base where an old key of
+// aliases, or of the AliasesKey config of base, resolves to its new
+// key as long as base has the new key, so that keys can be renamed
+// without changing every caller at once. onAlias is called on every
+// read of an old key resolved to its new key. Closing the view
+// closes base.
+func NewAliasStateManager(base StateManager, aliases map[string]string, onAlias func(old, new string)) StateManager {
+	a := &aliasStateManager{
+		StateManager: base,
+		aliases:      aliases,
+		onAlias:      onAlias,
+	}
+	a.refresh()
+	a.cancel = base.OnReload(a.refresh)
+	return a
+}
+
+// refresh merges the aliases with the ones of the
+// AliasesKey config, which take a lower precedence
+func (a *aliasStateManager) refresh() {
+	file := fileAliases(a.StateManager)
+	if len(file) == 0 {
+		a.resolved.Store(a.aliases)
+		return
+	}
+	merged := make(map[string]string, len(file)+len(a.aliases))
+	for oldKey, newKey := range file {
+		merged[oldKey] = newKey
+	}
+	for oldKey, newKey := range a.aliases {
+		merged[oldKey] = newKey
+	}
+	a.resolved.Store(merged)
+}
+
+// fileAliases returns the aliases of the AliasesKey config of sm
+func fileAliases(sm StateManager) map[string]string {
+	cfg, err := sm.GetKey(AliasesKey)
+	if err != nil {
+		return nil
+	}
+	aliases, ok := sm.GetParsedValue(cfg).(map[string]string)
+	if !ok {
+		if err := json.Unmarshal(cfg.RawValue, &aliases); err != nil {
+			// not retried until the config changes
+			aliases = map[string]string{}
+		}
+		sm.SetParsedValue(cfg, aliases)
+	}
+	return aliases
+}
+
+// resolve returns the new key of key, if key is an old key
+func (a *aliasStateManager) resolve(key string) (string, bool) {
+	aliases, _ := a.resolved.Load().(map[string]string)
+	if len(aliases) == 0 {
+		return "", false
+	}
+	newKey, ok := aliases[key]
+	return newKey, ok
+}
+
+func (a *aliasStateManager) GetKey(key string) (*Config, error) {
+	if newKey, ok := a.resolve(key); ok && newKey != key {
+		if cfg, err := a.StateManager.GetKey(newKey); err == nil {
+			a.onAlias(key, newKey)
+			return cfg, nil
+		}
+	}
+	return a.StateManager.GetKey(key)
+}
+
+func (a *aliasStateManager) Snapshot() StateManager {
+	snap := &aliasStateManager{
+		StateManager: a.StateManager.Snapshot(),
+		aliases:      a.aliases,
+		onAlias:      a.onAlias,
+	}
+	snap.refresh()
+	return snap
+}
+
+func (a *aliasStateManager) Close() {
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.StateManager.Close()
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStateManager counts the reads of the keys of its StateManager
+type countingStateManager struct {
+	StateManager
+	gets map[string]int
+}
+
+func (c *countingStateManager) GetKey(key string) (*Config, error) {
+	c.gets[key]++
+	return c.StateManager.GetKey(key)
+}
+
+func TestAliasStateManager(t *testing.T) {
+	dm := NewDummyStateManager()
+	dm.SetConfig(&Config{Key: "timeout", RawValue: json.RawMessage("1")})
+	base := &countingStateManager{StateManager: dm, gets: make(map[string]int)}
+	var aliased []string
+	asm := NewAliasStateManager(base, nil, func(old, new string) {
+		aliased = append(aliased, old+"->"+new)
+	})
+	defer asm.Close()
+
+	_, err := asm.GetKey("old.timeout")
+	assert.Equal(t, ErrNotFound, err)
+
+	dm.SetConfig(&Config{Key: AliasesKey, RawValue: json.RawMessage(`{"old.timeout": "timeout"}`)})
+	cfg, err := asm.GetKey("old.timeout")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfg.String())
+	assert.Equal(t, []string{"old.timeout->timeout"}, aliased)
+
+	// the aliases are only read on reloads
+	reads := base.gets[AliasesKey]
+	for i := 0; i < 10; i++ {
+		_, err = asm.GetKey("timeout")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, reads, base.gets[AliasesKey])
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/mixpanel/obs"
+)
+
+// WithAuditLog logs every key added, removed or changed by a reload with
+// its old and new values, the time the change was applied and the
+// modification time of the file, as an audit trail of the configs each
+// process applied. Values of sensitive configs are redacted. Values are
+// logged in full, which may be verbose for large configs.
+func WithAuditLog() Option {
+	return func(sm *stateManager) {
+		sm.auditLog = true
+	}
+}
+
+// audit logs the changes of d, the diff between old and new
+func (sm *stateManager) audit(old, new *State, d Diff) {
+	if !sm.auditLog || d.Empty() {
+		return
+	}
+	fs := sm.fr.WithSpan(context.Background())
+	for _, entry := range sm.auditEntries(old, new, d, sm.clk().Now()) {
+		fs.Info("config_changed", entry)
+	}
+}
+
+// auditEntries returns the log entries of the changes of d
+// applied at appliedAt, with the sensitive values redacted
+func (sm *stateManager) auditEntries(old, new *State, d Diff, appliedAt time.Time) []obs.Vals {
+	var mtime string
+	if info, err := os.Stat(sm.filePath); err == nil {
+		mtime = info.ModTime().UTC().Format(time.RFC3339Nano)
+	}
+	entries := make([]obs.Vals, 0, len(d.Added)+len(d.Removed)+len(d.Changed))
+	add := func(change string, c KeyChange) {
+		oldVal, newVal := string(c.Old), string(c.New)
+		if sm.isSensitive(old, c.Key) || sm.isSensitive(new, c.Key) {
+			if c.Old != nil {
+				oldVal = redacted{}.String()
+			}
+			if c.New != nil {
+				newVal = redacted{}.String()
+			}
+		}
+		entries = append(entries, obs.Vals{
+			"path":       sm.filePath,
+			"key":        c.Key,
+			"change":     change,
+			"old_value":  oldVal,
+			"new_value":  newVal,
+			"applied_at": appliedAt.UTC().Format(time.RFC3339Nano),
+			"file_mtime": mtime,
+		})
+	}
+	for _, c := range d.Added {
+		add("added", c)
+	}
+	for _, c := range d.Removed {
+		add("removed", c)
+	}
+	for _, c := range d.Changed {
+		add("changed", c)
+	}
+	return entries
+}
+
+// isSensitive returns true if the values of key in State must not be logged
+func (sm *stateManager) isSensitive(State *State, key string) bool {
+	if sm.sensitive {
+		return true
+	}
+	cfg, ok := State.lookup(key)
+	return ok && cfg.Sensitive
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditEntries(t *testing.T) {
+	old, err := parseState([]byte(`[
+		{"key": "foo", "value": 1},
+		{"key": "bar", "value": 2},
+		{"key": "password", "value": "hunter2", "sensitive": true}
+	]`))
+	require.NoError(t, err)
+	old.buildCache()
+	new, err := parseState([]byte(`[
+		{"key": "foo", "value": 3},
+		{"key": "baz", "value": 4},
+		{"key": "password", "value": "hunter3", "sensitive": true}
+	]`))
+	require.NoError(t, err)
+	new.buildCache()
+
+	sm := &stateManager{filePath: "/missing/configs.json", auditLog: true}
+	at := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	entries := sm.auditEntries(old, new, DiffStates(old, new), at)
+	require.Len(t, entries, 4)
+
+	byKey := make(map[string]map[string]interface{})
+	for _, e := range entries {
+		byKey[e["key"].(string)] = e
+	}
+	assert.Equal(t, "added", byKey["baz"]["change"])
+	assert.Equal(t, "", byKey["baz"]["old_value"])
+	assert.Equal(t, "4", byKey["baz"]["new_value"])
+	assert.Equal(t, "removed", byKey["bar"]["change"])
+	assert.Equal(t, "2", byKey["bar"]["old_value"])
+	assert.Equal(t, "changed", byKey["foo"]["change"])
+	assert.Equal(t, "1", byKey["foo"]["old_value"])
+	assert.Equal(t, "3", byKey["foo"]["new_value"])
+	assert.Equal(t, "2025-09-01T00:00:00Z", byKey["foo"]["applied_at"])
+	assert.Equal(t, `"<redacted>"`, byKey["password"]["old_value"])
+	assert.Equal(t, `"<redacted>"`, byKey["password"]["new_value"])
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+)
+
+// debouncer coalesces the reloads happening within
+// window of each other into a single reload
+type debouncer struct {
+	window time.Duration
+
+	// flushMu serializes the flushes so that
+	// listeners are not called concurrently
+	flushMu sync.Mutex
+
+	mu        sync.Mutex
+	timer     clock.Timer
+	pending   bool
+	delivered *State
+}
+
+// reloaded schedules a flush window after the last reload
+func (d *debouncer) reloaded(clk clock.Clock, flush func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = clk.AfterFunc(d.window, flush)
+}
+
+// take returns the State delivered by the last flush and the
+// current State, marking it as delivered. ok is false if there
+// is nothing new to deliver. current is called holding the lock
+// so that a reload racing with the flush is not lost.
+func (d *debouncer) take(current func() *State) (old, new *State, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	new = current()
+	if !d.pending || d.delivered == new {
+		d.pending = false
+		return nil, nil, false
+	}
+	old = d.delivered
+	d.delivered = new
+	d.pending = false
+	return old, new, true
+}
+
+func (d *debouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.pending = false
+}
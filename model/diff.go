@@ -0,0 +1,79 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// KeyChange is a key whose value changed in a reload.
+// Old is nil for added keys and New is nil for removed keys.
+// Sensitive is set if the old or the new config is sensitive.
+type KeyChange struct {
+	Key       string
+	Old       json.RawMessage
+	New       json.RawMessage
+	Sensitive bool
+}
+
+// Diff lists the keys added, removed and changed
+// between two States, sorted by key
+type Diff struct {
+	Added   []KeyChange
+	Removed []KeyChange
+	Changed []KeyChange
+}
+
+// Empty returns true if nothing changed
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Keys returns all the keys in the diff
+func (d Diff) Keys() []string {
+	keys := append(changeKeys(d.Added), changeKeys(d.Removed)...)
+	keys = append(keys, changeKeys(d.Changed)...)
+	sort.Strings(keys)
+	return keys
+}
+
+func changeKeys(changes []KeyChange) []string {
+	keys := make([]string, 0, len(changes))
+	for _, c := range changes {
+		keys = append(keys, c.Key)
+	}
+	return keys
+}
+
+// DiffStates returns the difference between old and new.
+// A nil State is treated as empty.
+func DiffStates(old, new *State) Diff {
+	var d Diff
+	if new != nil {
+		for _, key := range new.keys() {
+			ncfg, _ := new.lookup(key)
+			ocfg, ok := old.lookup(key)
+			if !ok {
+				d.Added = append(d.Added, KeyChange{Key: key, New: ncfg.RawValue, Sensitive: ncfg.Sensitive})
+				continue
+			}
+			if !bytes.Equal(ocfg.RawValue, ncfg.RawValue) {
+				d.Changed = append(d.Changed, KeyChange{
+					Key:       key,
+					Old:       ocfg.RawValue,
+					New:       ncfg.RawValue,
+					Sensitive: ocfg.Sensitive || ncfg.Sensitive,
+				})
+			}
+		}
+	}
+	if old != nil {
+		for _, key := range old.keys() {
+			if _, ok := new.lookup(key); !ok {
+				ocfg, _ := old.lookup(key)
+				d.Removed = append(d.Removed, KeyChange{Key: key, Old: ocfg.RawValue, Sensitive: ocfg.Sensitive})
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stateOf(raw map[string]string) *State {
+	s := &State{}
+	for key, val := range raw {
+		s.Configs = append(s.Configs, &Config{Key: key, RawValue: json.RawMessage(val)})
+	}
+	s.buildCache()
+	return s
+}
+
+func TestDiffStates(t *testing.T) {
+	old := stateOf(map[string]string{"foo": "1", "bar": "2", "baz": "3"})
+	new := stateOf(map[string]string{"foo": "1", "bar": "4", "qux": "5"})
+
+	d := DiffStates(old, new)
+	assert.Equal(t, Diff{
+		Added:   []KeyChange{{Key: "qux", New: json.RawMessage("5")}},
+		Removed: []KeyChange{{Key: "baz", Old: json.RawMessage("3")}},
+		Changed: []KeyChange{{Key: "bar", Old: json.RawMessage("2"), New: json.RawMessage("4")}},
+	}, d)
+	assert.Equal(t, []string{"bar", "baz", "qux"}, d.Keys())
+
+	assert.True(t, DiffStates(old, old).Empty())
+	assert.Len(t, DiffStates(nil, new).Added, 3)
+}
+
+func TestDummyOnDiff(t *testing.T) {
+	d := NewDummyStateManager()
+	d.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("1")})
+
+	var diffs []Diff
+	defer d.OnDiff(func(diff Diff) { diffs = append(diffs, diff) })()
+	d.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("1")})
+	d.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("2")})
+
+	assert.Equal(t, []Diff{{
+		Changed: []KeyChange{{Key: "foo", Old: json.RawMessage("1"), New: json.RawMessage("2")}},
+	}}, diffs)
+}
@@ -11,6 +11,8 @@ type DummyStateManager struct {
 	*NullStateManager
 	state *State
 	mu    sync.RWMutex
+
+	listeners reloadListeners
 }
 
 // NewDummyStateManager returns a new instance
@@ -31,13 +33,58 @@ func (d *DummyStateManager) GetKey(key string) (*Config, error) {
 	return d.state.get(key)
 }
 
+// Keys returns the sorted keys of the configs set
+func (d *DummyStateManager) Keys() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.state.keys()
+}
+
+// Snapshot returns a StateManager with
+// the configs set so far
+func (d *DummyStateManager) Snapshot() StateManager {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return &snapshotStateManager{
+		NullStateManager: d.NullStateManager,
+		state:            d.state,
+	}
+}
+
 // SetConfig can be used to store a config into the
 // dummy state manager
 func (d *DummyStateManager) SetConfig(cfg *Config) *DummyStateManager {
 	d.mu.Lock()
-	defer d.mu.Unlock()
 	// state has slice of configs too but we dont care
-	// here
-	d.state.cache[cfg.Key] = cfg
+	// here. The cache is copied so that listeners get
+	// both the old and the new state.
+	old := d.state
+	state := &State{}
+	state.buildCache()
+	for key, c := range old.cache {
+		state.cache[key] = c
+	}
+	state.cache[cfg.Key] = cfg
+	d.state = state
+	d.mu.Unlock()
+	d.listeners.fire(newReload(old, state))
 	return d
 }
+
+// OnReload registers fn to be called every time
+// a config is set on the dummy state manager
+func (d *DummyStateManager) OnReload(fn func()) func() {
+	return d.listeners.add(onReload(fn))
+}
+
+// OnDiff registers fn to be called with the
+// changes made by SetConfig
+func (d *DummyStateManager) OnDiff(fn func(Diff)) func() {
+	return d.listeners.add(onDiff(fn))
+}
+
+// Subscribe registers fn to be called every time
+// the raw value of key is changed by SetConfig
+func (d *DummyStateManager) Subscribe(key string, fn func(old, new []byte)) func() {
+	return d.listeners.add(onKeyChange(key, fn))
+}
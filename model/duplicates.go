@@ -0,0 +1,70 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// ErrDuplicateKeys is returned when configs define a key more
+// than once with the DuplicateKeysError policy
+var ErrDuplicateKeys = errors.New("configs define keys more than once")
+
+// DuplicateKeyPolicy is what to do with configs
+// defining the same key more than once
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeysLastWins loads the last config of a
+	// duplicate key and logs a warning. It is the default.
+	DuplicateKeysLastWins DuplicateKeyPolicy = iota
+	// DuplicateKeysError does not load configs with
+	// duplicate keys, the loaded configs are kept
+	DuplicateKeysError
+)
+
+// WithDuplicateKeys sets the policy for configs
+// defining the same key more than once
+func WithDuplicateKeys(policy DuplicateKeyPolicy) Option {
+	return func(sm *stateManager) {
+		sm.duplicateKeys = policy
+	}
+}
+
+// dedupeKeys applies the duplicate keys policy to State: with
+// DuplicateKeysLastWins only the last config of a key is kept
+func (sm *stateManager) dedupeKeys(State *State) error {
+	last := make(map[string]int, len(State.Configs))
+	var duplicates []string
+	for i, cfg := range State.Configs {
+		if _, ok := last[cfg.Key]; ok {
+			duplicates = append(duplicates, cfg.Key)
+		}
+		last[cfg.Key] = i
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+	fs := sm.fr.WithSpan(context.Background())
+	fs.Incr("duplicate_keys")
+	if sm.duplicateKeys == DuplicateKeysError {
+		return obserr.Annotate(ErrDuplicateKeys, "configs define keys more than once, keeping the loaded configs").Set(
+			"path", sm.filePath,
+			"keys", duplicates,
+		)
+	}
+	fs.Warn("duplicate_keys", "configs define keys more than once, the last definition wins", obs.Vals{
+		"path": sm.filePath,
+		"keys": duplicates,
+	})
+	configs := make([]*Config, 0, len(last))
+	for i, cfg := range State.Configs {
+		if last[cfg.Key] == i {
+			configs = append(configs, cfg)
+		}
+	}
+	State.Configs = configs
+	return nil
+}
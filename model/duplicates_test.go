@@ -0,0 +1,60 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateKeys(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	for i, data := range []string{
+		`[{"key": "foo", "value": 1}, {"key": "bar", "value": 2}, {"key": "foo", "value": 3}]`,
+		`{"foo": 1, "bar": 2, "foo": 3}`,
+	} {
+		ns := fmt.Sprintf("duplicate_keys_%d", i)
+		safeWriteFile(t, path.Join(dir, ns, "configs.json"), data)
+
+		sm, err := NewStateManager(dir, ns, nil, obs.NullFR)
+		require.NoError(t, err)
+		cfg, err := sm.GetKey("foo")
+		require.NoError(t, err)
+		assert.Equal(t, "3", cfg.String())
+		assert.Equal(t, []string{"bar", "foo"}, sm.Keys())
+		sm.Close()
+	}
+}
+
+func TestDuplicateKeysError(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "duplicate_keys_error"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `{"foo": 1}`)
+
+	sm, err := NewStateManager(dir, ns, nil, obs.NullFR, WithDuplicateKeys(DuplicateKeysError))
+	require.NoError(t, err)
+	defer sm.Close()
+
+	loaded := make(chan string, 10)
+	defer sm.OnReload(func() {
+		cfg, err := sm.GetKey("foo")
+		require.NoError(t, err)
+		loaded <- cfg.String()
+	})()
+
+	safeWriteFile(t, filePath, `{"foo": 2, "foo": 3}`)
+	safeWriteFile(t, filePath, `{"foo": 4}`)
+	for val := range loaded {
+		assert.NotEqual(t, "3", val, "configs with duplicate keys should not be loaded")
+		if val == "4" {
+			break
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+var (
+	// publishMu serializes the lookups and publications of the
+	// expvar maps, and the updates of the maps of the StateManagers
+	publishMu sync.Mutex
+	// releasedMaps are the maps of the closed StateManagers by
+	// name: expvar can not unpublish them so they are reused
+	releasedMaps = make(map[string]*expvar.Map)
+)
+
+// WithoutExpvar does not publish the configs to expvar, e.g. when
+// /debug/vars is exposed or the scope is loaded more than once
+func WithoutExpvar() Option {
+	return func(sm *stateManager) {
+		sm.noExpvar = true
+	}
+}
+
+// publishExpvar publishes the expvar map of the configs as name, or as
+// name#2, name#3... if other StateManagers in the process already
+// published name, instead of panicking like expvar.NewMap. The maps
+// released by closed StateManagers are reused. Nothing is published
+// with WithoutExpvar.
+func (sm *stateManager) publishExpvar(name string) {
+	if sm.noExpvar {
+		return
+	}
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	published := name
+	for i := 2; ; i++ {
+		if emap, ok := releasedMaps[published]; ok {
+			delete(releasedMaps, published)
+			sm.emap, sm.emapName = emap, published
+			return
+		}
+		if expvar.Get(published) == nil {
+			break
+		}
+		published = fmt.Sprintf("%s#%d", name, i)
+	}
+	sm.emap, sm.emapName = expvar.NewMap(published), published
+}
+
+// unpublishExpvar empties the expvar map of the configs, so that it
+// does not hold on to them, and releases it to the next StateManager
+// publishing the same name
+func (sm *stateManager) unpublishExpvar() {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	if sm.emap == nil {
+		return
+	}
+	sm.emap.Init()
+	releasedMaps[sm.emapName] = sm.emap
+	sm.emap = nil
+}
+
+// publishState publishes the configs of State
+// and unpublishes the keys of old it does not have
+func (sm *stateManager) publishState(old, State *State) {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	if sm.emap == nil {
+		return
+	}
+	if old != nil {
+		for key := range old.cache {
+			if _, ok := State.cache[key]; !ok {
+				sm.emap.Delete(key)
+			}
+		}
+	}
+	for _, cfg := range State.Configs {
+		sm.publish(cfg)
+	}
+}
+
+// publish sets the published value of cfg, redacted if it is sensitive
+func (sm *stateManager) publish(cfg *Config) {
+	if cfg.Sensitive {
+		sm.emap.Set(cfg.Key, redacted{})
+		return
+	}
+	sm.emap.Set(cfg.Key, cfg)
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	configs := []*Config{
+		{Key: "port", RawValue: json.RawMessage("5432")},
+		{Key: "password", RawValue: json.RawMessage(`"hunter2"`), Sensitive: true},
+	}
+
+	// the same scope twice does not panic
+	first := NewMemoryStateManager("expvar-test", configs, obs.NullFR)
+	defer first.Close()
+	second := NewMemoryStateManager("expvar-test", configs, obs.NullFR)
+	defer second.Close()
+
+	for _, name := range []string{"configmanager.expvar-test", "configmanager.expvar-test#2"} {
+		emap, ok := expvar.Get(name).(*expvar.Map)
+		require.True(t, ok, name)
+		assert.Equal(t, "5432", emap.Get("port").String())
+		assert.Equal(t, `"<redacted>"`, emap.Get("password").String())
+	}
+
+	unpublished := NewMemoryStateManager("expvar-unpublished", configs, obs.NullFR, WithoutExpvar())
+	defer unpublished.Close()
+	assert.Nil(t, expvar.Get("configmanager.expvar-unpublished"))
+	cfg, err := unpublished.GetKey("port")
+	require.NoError(t, err)
+	assert.Equal(t, "5432", cfg.String())
+}
+
+func TestExpvarReleased(t *testing.T) {
+	configs := []*Config{
+		{Key: "port", RawValue: json.RawMessage("5432")},
+		{Key: "host", RawValue: json.RawMessage(`"db"`)},
+	}
+	msm := NewMemoryStateManager("expvar-released", configs, obs.NullFR)
+	emap, ok := expvar.Get("configmanager.expvar-released").(*expvar.Map)
+	require.True(t, ok)
+
+	// the keys removed by a reload are unpublished
+	require.NoError(t, msm.Push(configs[:1]))
+	assert.NotNil(t, emap.Get("port"))
+	assert.Nil(t, emap.Get("host"))
+
+	// the map of a closed StateManager is emptied and reused
+	msm.Close()
+	assert.Nil(t, emap.Get("port"))
+	reopened := NewMemoryStateManager("expvar-released", configs, obs.NullFR)
+	defer reopened.Close()
+	assert.Nil(t, expvar.Get("configmanager.expvar-released#2"))
+	assert.Equal(t, `"db"`, emap.Get("host").String())
+}
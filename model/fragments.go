@@ -0,0 +1,166 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mixpanel/configmanager/configmap"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// fragmentsStateManager merges the json and yaml files of the configs.d
+// directory of a scope in the order of their names. The directory is
+// watched: a StateManager is added for every file created and the one
+// of every file removed is closed, dropping its configs.
+type fragmentsStateManager struct {
+	*layeredStateManager
+
+	dirPath string
+	scope   string
+	fr      obs.FlightRecorder
+	opts    []Option
+	watcher *configmap.DirWatcher
+	// cancel cancels the initial loads of the files
+	// added to the directory, so that Close does not
+	// wait for the startup timeout of a broken file
+	cancel func()
+
+	// mu serializes the syncs of the files with the directory,
+	// fragments are the StateManagers of the files by path
+	mu        sync.Mutex
+	fragments map[string]*stateManager
+	closed    bool
+}
+
+func newFragmentsStateManager(dirPath, scope string, fr obs.FlightRecorder, opts []Option) (*fragmentsStateManager, error) {
+	o := optionsOf(opts)
+	ctx := o.startupCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	f := &fragmentsStateManager{
+		layeredStateManager: newLayeredStateManager(nil),
+		dirPath:             dirPath,
+		scope:               scope,
+		fr:                  fr,
+		opts: append(opts[:len(opts):len(opts)], func(sm *stateManager) {
+			sm.startupCtx = ctx
+		}),
+		cancel:    cancel,
+		fragments: make(map[string]*stateManager),
+	}
+	if err := f.sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	watcher, err := configmap.NewDirWatcher(dirPath, func(string) error { return f.sync() }, fr)
+	if err != nil {
+		f.Close()
+		return nil, obserr.Annotate(err, "Error making the watcher of the config fragments").Set("path", dirPath)
+	}
+	watcher.ResyncInterval = o.resyncInterval
+	watcher.Clock = o.clk()
+	if err := watcher.Start(); err != nil {
+		f.Close()
+		return nil, obserr.Annotate(err, "Error watching the config fragments").Set("path", dirPath)
+	}
+	f.watcher = watcher
+	return f, nil
+}
+
+// sync adds the StateManagers of the files added to the directory and
+// closes the ones of the files removed. A file that can not be loaded is
+// not added, it is tried again with the next event of the directory.
+func (f *fragmentsStateManager) sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	paths, err := listFragments(f.dirPath)
+	if err != nil {
+		return err
+	}
+
+	var first error
+	changed := false
+	listed := make(map[string]bool, len(paths))
+	layers := make([]StateManager, 0, len(paths))
+	for _, fragmentPath := range paths {
+		fsm, ok := f.fragments[fragmentPath]
+		if !ok {
+			name := strings.TrimSuffix(path.Base(fragmentPath), path.Ext(fragmentPath))
+			fsm, err = newFileStateManager(fragmentPath, fmt.Sprintf("configmanager.%s.%s.%s", f.scope, FragmentsDirName, name), nil, f.fr, f.opts)
+			if err != nil {
+				if first == nil {
+					first = obserr.Annotate(err, "Error loading the config fragment").Set("path", fragmentPath)
+				}
+				continue
+			}
+			f.fragments[fragmentPath] = fsm
+			changed = true
+		}
+		listed[fragmentPath] = true
+		layers = append(layers, fsm)
+	}
+	for fragmentPath, fsm := range f.fragments {
+		if !listed[fragmentPath] {
+			delete(f.fragments, fragmentPath)
+			// the last error of the file must not outlive it
+			fsm.reportLoad(nil)
+			changed = true
+		}
+	}
+	if changed {
+		// the StateManagers of the removed files are closed by setLayers
+		f.setLayers(layers)
+	}
+	return first
+}
+
+// Reload syncs the files with the directory and reloads them
+func (f *fragmentsStateManager) Reload() error {
+	err := f.sync()
+	if lerr := f.layeredStateManager.Reload(); err == nil {
+		err = lerr
+	}
+	return err
+}
+
+// Close stops watching the directory and closes the StateManagers of the files
+func (f *fragmentsStateManager) Close() {
+	f.cancel()
+	f.watcher.Stop()
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.layeredStateManager.Close()
+}
+
+// listFragments returns the sorted paths of the json and yaml files in dirPath,
+// or none if dirPath does not exist
+func listFragments(dirPath string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dirPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error listing the config fragments").Set("path", dirPath)
+	}
+	var fragments []string
+	for _, info := range infos {
+		if info.IsDir() || (path.Ext(info.Name()) != ".json" && !isYAML(info.Name())) {
+			continue
+		}
+		fragments = append(fragments, path.Join(dirPath, info.Name()))
+	}
+	return fragments, nil
+}
@@ -0,0 +1,159 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// DefaultHTTPClient is used by NewHTTPStateManager
+// when no client is given
+var DefaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// httpStateManager loads the configs from a
+// configs.json document polled over HTTP
+type httpStateManager struct {
+	*stateManager
+
+	client   *http.Client
+	url      string
+	interval time.Duration
+
+	// validators of the last document loaded
+	etag, lastModified string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHTTPStateManager returns a StateManager loading the configs.json
+// document at url and polling it about every interval: each wait is
+// jittered by up to a fifth of interval so that a fleet of processes do
+// not poll in lockstep. The ETag and Last-Modified of the document are
+// sent back so unchanged documents are not downloaded again. The last
+// configs loaded are kept when a poll fails. scope names the expvar map
+// of the configs like with NewStateManager. interval must be positive.
+func NewHTTPStateManager(client *http.Client, url, scope string, interval time.Duration, fr obs.FlightRecorder, opts ...Option) (StateManager, error) {
+	if interval <= 0 {
+		return nil, obserr.Annotate(fmt.Errorf("interval must be positive"), "NewHTTPStateManager: invalid poll interval").Set("interval", interval)
+	}
+	if client == nil {
+		client = DefaultHTTPClient
+	}
+	hsm := &httpStateManager{
+		stateManager: &stateManager{
+			filePath:   url,
+			updateChan: make(chan struct{}),
+			fr:         fr.ScopeName("http_state_manager"),
+		},
+		client:   client,
+		url:      url,
+		interval: interval,
+	}
+	for _, opt := range opts {
+		opt(hsm.stateManager)
+	}
+	hsm.publishExpvar(fmt.Sprintf("configmanager.%s", scope))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hsm.cancel = cancel
+	if err := hsm.poll(ctx); err != nil {
+		cancel()
+		hsm.unpublishExpvar()
+		return nil, obserr.Annotate(err, "NewHTTPStateManager: error loading the configs").Set("url", url)
+	}
+	hsm.wg.Add(1)
+	go func() {
+		defer hsm.wg.Done()
+		hsm.run(ctx)
+	}()
+	return hsm, nil
+}
+
+// poll loads the document if it changed since the last poll
+func (hsm *httpStateManager) poll(ctx context.Context) (err error) {
+	hsm.loadMu.Lock()
+	defer hsm.loadMu.Unlock()
+	defer hsm.startLoad(ctx)(&err)
+
+	req, err := http.NewRequest(http.MethodGet, hsm.url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if hsm.etag != "" {
+		req.Header.Set("If-None-Match", hsm.etag)
+	}
+	if hsm.lastModified != "" {
+		req.Header.Set("If-Modified-Since", hsm.lastModified)
+	}
+	resp, err := hsm.client.Do(req)
+	if err != nil {
+		return obserr.Annotate(err, "Error fetching the configs")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		return obserr.Annotate(fmt.Errorf("unexpected status %d", resp.StatusCode), "Error fetching the configs")
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return obserr.Annotate(err, "Error reading the configs")
+	}
+	State, err := parseState(data)
+	if err != nil {
+		return obserr.Annotate(err, "error json unmarshal the State").Set("path", hsm.url)
+	}
+	hsm.etag = resp.Header.Get("ETag")
+	hsm.lastModified = resp.Header.Get("Last-Modified")
+	return hsm.loadState(State)
+}
+
+// run polls the document until ctx is done
+func (hsm *httpStateManager) run(ctx context.Context) {
+	fs := hsm.fr.WithSpan(ctx)
+	for {
+		jitter := time.Duration(0)
+		if hsm.interval >= 5 {
+			jitter = time.Duration(rand.Int63n(int64(hsm.interval/5)*2)) - hsm.interval/5
+		}
+		wait, timer := clock.After(hsm.clk(), hsm.interval+jitter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-wait:
+		}
+		if err := hsm.poll(ctx); err != nil && ctx.Err() == nil {
+			fs.Warn("error_read", "could not poll the configs, keeping the last configs", obs.Vals{
+				"path": hsm.url,
+			}.WithError(err))
+			fs.Incr("poll_failed")
+		}
+	}
+}
+
+// Reload fetches the document again, without waiting for the next poll
+func (hsm *httpStateManager) Reload() error {
+	return hsm.poll(context.Background())
+}
+
+func (hsm *httpStateManager) Close() {
+	hsm.cancel()
+	hsm.wg.Wait()
+	hsm.stateManager.Close()
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPStateManager(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		configs  = `[{"key": "foo", "value": 1}]`
+		etag     = `"1"`
+		fail     bool
+		notModif int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModif++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(configs))
+	}))
+	defer srv.Close()
+
+	sm, err := NewHTTPStateManager(nil, srv.URL, "http-test", 10*time.Millisecond, obs.NullFR)
+	require.NoError(t, err)
+	defer sm.Close()
+
+	cfg, err := sm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfg.String())
+
+	// unchanged configs are not downloaded again
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.True(t, notModif > 0)
+	mu.Unlock()
+
+	changed := make(chan []byte, 10)
+	defer sm.Subscribe("foo", func(_, new []byte) { changed <- new })()
+	mu.Lock()
+	configs, etag = `[{"key": "foo", "value": 2}]`, `"2"`
+	mu.Unlock()
+	assert.Equal(t, "2", string(<-changed))
+
+	// failed polls keep the last configs
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	cfg, err = sm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "2", cfg.String())
+}
+
+func TestHTTPStateManagerInvalidInterval(t *testing.T) {
+	var polls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&polls, 1)
+		w.Write([]byte(`[{"key": "foo", "value": 1}]`))
+	}))
+	defer srv.Close()
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		_, err := NewHTTPStateManager(nil, srv.URL, "http-test-interval", interval, obs.NullFR)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&polls))
+}
+
+// the polls are scheduled by the clock of WithClock
+func TestHTTPStateManagerClock(t *testing.T) {
+	var polls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&polls, 1)
+		w.Write([]byte(`[{"key": "foo", "value": 1}]`))
+	}))
+	defer srv.Close()
+
+	clk := clock.NewFake(time.Now())
+	sm, err := NewHTTPStateManager(nil, srv.URL, "http-test-clock", time.Hour, obs.NullFR, WithClock(clk))
+	require.NoError(t, err)
+	defer sm.Close()
+	// the timer is created by the goroutine of the poller
+	require.Eventually(t, func() bool {
+		clk.Advance(2 * time.Hour)
+		return atomic.LoadInt32(&polls) >= 3
+	}, 5*time.Second, time.Millisecond)
+}
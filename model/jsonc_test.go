@@ -0,0 +1,25 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripJSONC(t *testing.T) {
+	data := stripJSONC([]byte(`[
+  // raised for the black friday traffic
+  {"key": "timeout_secs", "value": 5,},
+  /* the url keeps its // and its /* */
+  {"key": "url", "value": "http://example.com/*x*/", /* trailing */ },
+]`))
+	var configs []*Config
+	require.NoError(t, json.Unmarshal(data, &configs))
+	require.Len(t, configs, 2)
+	assert.Equal(t, "5", configs[0].String())
+	assert.Equal(t, `"http://example.com/*x*/"`, configs[1].String())
+
+	assert.Equal(t, `["a\",", 1  ]`, string(stripJSONC([]byte(`["a\",", 1, ]`))))
+}
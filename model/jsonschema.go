@@ -0,0 +1,338 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mixpanel/obs/obserr"
+)
+
+// JSONSchemaFileName is the JSON Schema of the configs
+// read from the scope directory, if the scope has one
+const JSONSchemaFileName = "configs.schema.json"
+
+// JSONSchemaLoader is the SchemaLoader used when no other is given.
+// It compiles the configs.schema.json of the scope directory, if any.
+func JSONSchemaLoader(scopeDir string) (Schema, error) {
+	filePath := path.Join(scopeDir, JSONSchemaFileName)
+	data, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, obserr.Annotate(err, "JSONSchemaLoader: error reading the schema").Set("path", filePath)
+	}
+	schema, err := CompileJSONSchema(data)
+	if err != nil {
+		return nil, obserr.Annotate(err, "JSONSchemaLoader: invalid schema").Set("path", filePath)
+	}
+	return schema, nil
+}
+
+// CompileJSONSchema compiles the JSON Schema in data. The configs are
+// validated as an object mapping the keys to their values, e.g.
+//
+//	{
+//	  "type": "object",
+//	  "required": ["timeout_secs"],
+//	  "properties": {
+//	    "timeout_secs": {"type": "integer", "minimum": 1, "maximum": 60},
+//	    "scaling_percentage": {"type": "number", "minimum": 0, "maximum": 1}
+//	  }
+//	}
+//
+// Only the validation keywords type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern,
+// allOf, anyOf and not are supported, as well as the annotations such
+// as title and description. Schemas using any other keyword, e.g. $ref,
+// oneOf or format, fail to compile rather than accept every document.
+func CompileJSONSchema(data []byte) (Schema, error) {
+	s := &jsonSchema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// jsonSchema is a compiled JSON Schema
+type jsonSchema struct {
+	// never is set by the false schema
+	never bool
+
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Const                *interface{}           `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	Not                  *jsonSchema            `json:"not"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaKeywords are the keywords of jsonSchema, and
+// the annotations, which do not affect the validation
+var schemaKeywords = map[string]struct{}{
+	"type": {}, "enum": {}, "const": {}, "properties": {}, "required": {},
+	"additionalProperties": {}, "items": {}, "minItems": {}, "maxItems": {},
+	"minimum": {}, "maximum": {}, "exclusiveMinimum": {}, "exclusiveMaximum": {},
+	"minLength": {}, "maxLength": {}, "pattern": {}, "allOf": {}, "anyOf": {}, "not": {},
+
+	"$schema": {}, "$id": {}, "$comment": {}, "title": {}, "description": {},
+	"default": {}, "examples": {}, "deprecated": {}, "readOnly": {}, "writeOnly": {},
+}
+
+// schemaTypes is the type keyword, a type or a list of types
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var typ string
+	if err := json.Unmarshal(data, &typ); err == nil {
+		*t = schemaTypes{typ}
+		return nil
+	}
+	var types []string
+	if err := json.Unmarshal(data, &types); err != nil {
+		return err
+	}
+	*t = types
+	return nil
+}
+
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*s = jsonSchema{}
+		return nil
+	case "false":
+		*s = jsonSchema{never: true}
+		return nil
+	}
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return err
+	}
+	var unsupported []string
+	for keyword := range keywords {
+		if _, ok := schemaKeywords[keyword]; !ok {
+			unsupported = append(unsupported, keyword)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("Unsupported keywords %q in the schema", unsupported)
+	}
+	// the alias does not have the UnmarshalJSON method
+	type schema jsonSchema
+	var parsed schema
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	*s = jsonSchema(parsed)
+	for _, typ := range s.Type {
+		switch typ {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return fmt.Errorf("Unknown type %q in the schema", typ)
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("Invalid pattern %q in the schema: %v", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	return nil
+}
+
+func (s *jsonSchema) Validate(configs []*Config) error {
+	obj := make(map[string]interface{}, len(configs))
+	for _, cfg := range configs {
+		var val interface{}
+		if err := json.Unmarshal(cfg.RawValue, &val); err != nil {
+			return obserr.Annotate(err, "jsonSchema.Validate: invalid value").Set("key", cfg.Key)
+		}
+		obj[cfg.Key] = val
+	}
+	var errs []string
+	s.validate("", obj, &errs)
+	if len(errs) > 0 {
+		return fmt.Errorf("configs do not match the JSON Schema: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validate appends to errs the violations of val,
+// found at the JSON pointer ptr, of the schema
+func (s *jsonSchema) validate(ptr string, val interface{}, errs *[]string) {
+	fail := func(format string, args ...interface{}) {
+		at := ptr
+		if at == "" {
+			at = "/"
+		}
+		*errs = append(*errs, at+": "+fmt.Sprintf(format, args...))
+	}
+	if s.never {
+		fail("not allowed")
+		return
+	}
+	if len(s.Type) > 0 && !s.hasType(val) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(val))
+		return
+	}
+	if s.Const != nil && !reflect.DeepEqual(*s.Const, val) {
+		fail("expected the constant value")
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("not one of the enum values")
+		}
+	}
+
+	switch v := val.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("%v is less than the minimum %v", v, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("%v is greater than the maximum %v", v, *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+			fail("%v is not greater than %v", v, *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && v >= *s.ExclusiveMaximum {
+			fail("%v is not less than %v", v, *s.ExclusiveMaximum)
+		}
+	case string:
+		n := len([]rune(v))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("shorter than %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("longer than %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("does not match the pattern %q", s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("fewer than %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("more than %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s/%d", ptr, i), item, errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				fail("missing required key %q", key)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPtr := ptr + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+			if prop, ok := s.Properties[key]; ok {
+				prop.validate(keyPtr, v[key], errs)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(keyPtr, v[key], errs)
+			}
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		sub.validate(ptr, val, errs)
+	}
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, sub := range s.AnyOf {
+			var subErrs []string
+			sub.validate(ptr, val, &subErrs)
+			if len(subErrs) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("does not match any of the schemas of anyOf")
+		}
+	}
+	if s.Not != nil {
+		var subErrs []string
+		s.Not.validate(ptr, val, &subErrs)
+		if len(subErrs) == 0 {
+			fail("matches the schema of not")
+		}
+	}
+}
+
+func (s *jsonSchema) hasType(val interface{}) bool {
+	for _, typ := range s.Type {
+		if typ == typeOf(val) {
+			return true
+		}
+		if typ == "number" && typeOf(val) == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type of a value unmarshalled
+// into an interface{}, integer for numbers without fraction
+func typeOf(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"encoding/json"
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testJSONSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["timeout_secs"],
+  "additionalProperties": false,
+  "properties": {
+    "timeout_secs": {"type": "integer", "minimum": 1, "maximum": 60},
+    "scaling_percentage": {"type": "number", "exclusiveMinimum": 0, "maximum": 1},
+    "mode": {"enum": ["fast", "safe"]},
+    "hosts": {"type": "array", "items": {"type": "string", "pattern": "^[a-z0-9.-]+$"}, "maxItems": 2},
+    "whitelist": {"type": "object", "additionalProperties": {"type": "object"}},
+    "name": {"anyOf": [{"type": "null"}, {"type": "string", "minLength": 1}]}
+  }
+}`
+
+func schemaConfigs(t *testing.T, values map[string]interface{}) []*Config {
+	var configs []*Config
+	for key, val := range values {
+		raw, err := json.Marshal(val)
+		require.NoError(t, err)
+		configs = append(configs, &Config{Key: key, RawValue: raw})
+	}
+	return configs
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema, err := CompileJSONSchema([]byte(testJSONSchema))
+	require.NoError(t, err)
+
+	valid := []map[string]interface{}{
+		{"timeout_secs": 5},
+		{"timeout_secs": 60, "scaling_percentage": 0.5, "mode": "safe"},
+		{"timeout_secs": 1, "hosts": []string{"a.local", "b"}, "name": nil},
+		{"timeout_secs": 1, "whitelist": map[string]interface{}{"123": map[string]interface{}{}}},
+	}
+	for _, values := range valid {
+		assert.NoError(t, schema.Validate(schemaConfigs(t, values)), "%v", values)
+	}
+
+	invalid := []map[string]interface{}{
+		{},
+		{"timeout_secs": 5.5},
+		{"timeout_secs": "5"},
+		{"timeout_secs": 61},
+		{"timeout_secs": 5, "scaling_percentage": 0},
+		{"timeout_secs": 5, "mode": "slow"},
+		{"timeout_secs": 5, "hosts": []string{"A"}},
+		{"timeout_secs": 5, "hosts": []string{"a", "b", "c"}},
+		{"timeout_secs": 5, "whitelist": map[string]interface{}{"123": true}},
+		{"timeout_secs": 5, "name": ""},
+		{"timeout_secs": 5, "unknown": 1},
+	}
+	for _, values := range invalid {
+		assert.Error(t, schema.Validate(schemaConfigs(t, values)), "%v", values)
+	}
+
+	err = schema.Validate(schemaConfigs(t, map[string]interface{}{"timeout_secs": "5"}))
+	assert.Contains(t, err.Error(), "/timeout_secs: expected integer, got string")
+
+	_, err = CompileJSONSchema([]byte(`{"type": "int"}`))
+	assert.Error(t, err)
+	_, err = CompileJSONSchema([]byte(`{"pattern": "["}`))
+	assert.Error(t, err)
+}
+
+func TestJSONSchemaUnsupportedKeywords(t *testing.T) {
+	for _, schema := range []string{
+		`{"$ref": "#/definitions/timeout"}`,
+		`{"oneOf": [{"type": "string"}, {"type": "integer"}]}`,
+		`{"properties": {"host": {"type": "string", "format": "hostname"}}}`,
+		`{"type": "object", "patternProperties": {"^t": {"type": "integer"}}}`,
+		`{"items": {"type": "array", "uniqueItems": true}}`,
+	} {
+		_, err := CompileJSONSchema([]byte(schema))
+		assert.Error(t, err, schema)
+	}
+
+	dir, done := mkTempDir(t)
+	defer done()
+	safeWriteFile(t, path.Join(dir, JSONSchemaFileName), `{"$ref": "#/definitions/configs"}`)
+	_, err := JSONSchemaLoader(dir)
+	assert.Error(t, err)
+}
+
+func TestJSONSchemaFile(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "json_schema"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `[{"key": "timeout_secs", "value": 5}]`)
+	safeWriteFile(t, path.Join(dir, ns, JSONSchemaFileName), testJSONSchema)
+
+	sm, err := NewStateManager(dir, ns, nil, obs.NullFR)
+	require.NoError(t, err)
+	defer sm.Close()
+
+	loaded := make(chan string, 10)
+	defer sm.OnReload(func() {
+		cfg, err := sm.GetKey("timeout_secs")
+		require.NoError(t, err)
+		loaded <- cfg.String()
+	})()
+
+	safeWriteFile(t, filePath, `[{"key": "timeout_secs", "value": "10"}]`)
+	safeWriteFile(t, filePath, `[{"key": "timeout_secs", "value": 20}]`)
+	for val := range loaded {
+		assert.NotEqual(t, `"10"`, val, "configs not matching the schema should not be loaded")
+		if val == "20" {
+			break
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package model
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// K8sDataKey is the key of the ConfigMap data read by the
+// StateManager returned by NewK8sStateManager. It holds
+// the same document as configs.json.
+const K8sDataKey = "configs.json"
+
+const (
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	k8sRewatchDelay      = time.Second
+)
+
+// K8sConfig locates and authenticates against the Kubernetes API server
+type K8sConfig struct {
+	// Host is the base URL of the API server,
+	// e.g. https://10.0.0.1:443
+	Host string
+	// Token is sent as a bearer token if not empty
+	Token string
+	// Client makes the requests. http.DefaultClient
+	// is used if it is nil.
+	Client *http.Client
+}
+
+// InClusterK8sConfig returns the K8sConfig of the service
+// account of the pod the process is running in
+func InClusterK8sConfig() (*K8sConfig, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, obserr.Annotate(ErrNotInCluster, "InClusterK8sConfig: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+	token, err := ioutil.ReadFile(k8sServiceAccountDir + "/token")
+	if err != nil {
+		return nil, obserr.Annotate(err, "InClusterK8sConfig: error reading the service account token")
+	}
+	ca, err := ioutil.ReadFile(k8sServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, obserr.Annotate(err, "InClusterK8sConfig: error reading the service account CA")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, obserr.Annotate(ErrNotInCluster, "InClusterK8sConfig: invalid service account CA")
+	}
+	return &K8sConfig{
+		Host:  "https://" + net.JoinHostPort(host, port),
+		Token: string(token),
+		Client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+// ErrNotInCluster is returned by InClusterK8sConfig
+// outside of a Kubernetes pod
+var ErrNotInCluster = errors.New("not running in a kubernetes cluster")
+
+type k8sConfigMap struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+type k8sWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// k8sStateManager loads the configs from a ConfigMap
+// watched through the Kubernetes API
+type k8sStateManager struct {
+	*stateManager
+
+	cfg             *K8sConfig
+	namespace, name string
+	// resourceVersion is the version of the ConfigMap last
+	// loaded, guarded by loadMu like the loads
+	resourceVersion string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewK8sStateManager returns a StateManager loading the configs from the
+// K8sDataKey of the ConfigMap namespace/name and watching it through the
+// Kubernetes API, so that updates do not wait for the kubelet to sync a
+// mounted volume. The configs are kept if the ConfigMap is deleted. scope
+// names the expvar map of the configs like with NewStateManager.
+func NewK8sStateManager(cfg *K8sConfig, namespace, name, scope string, fr obs.FlightRecorder, opts ...Option) (StateManager, error) {
+	ksm := &k8sStateManager{
+		stateManager: &stateManager{
+			filePath:       fmt.Sprintf("k8s:%s/%s", namespace, name),
+			updateChan:     make(chan struct{}),
+			fr:             fr.ScopeName("k8s_state_manager"),
+			startupTimeout: DefaultStartupTimeout,
+		},
+		cfg:       cfg,
+		namespace: namespace,
+		name:      name,
+	}
+	for _, opt := range opts {
+		opt(ksm.stateManager)
+	}
+	ksm.publishExpvar(fmt.Sprintf("configmanager.%s", scope))
+
+	startupCtx, cancelStartup := ksm.startupContext()
+	err := ksm.get(startupCtx)
+	cancelStartup()
+	if err != nil {
+		ksm.unpublishExpvar()
+		return nil, obserr.Annotate(err, "NewK8sStateManager: error loading the configmap").Set(
+			"namespace", namespace,
+			"name", name,
+		)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ksm.cancel = cancel
+	ksm.wg.Add(1)
+	go func() {
+		defer ksm.wg.Done()
+		ksm.run(ctx)
+	}()
+	return ksm, nil
+}
+
+func (ksm *k8sStateManager) request(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := ksm.cfg.Host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if ksm.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+ksm.cfg.Token)
+	}
+	client := ksm.cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, obserr.Annotate(fmt.Errorf("unexpected status %d", resp.StatusCode), "k8s request failed").Set("url", u)
+	}
+	return resp, nil
+}
+
+// get loads the current version of the ConfigMap
+func (ksm *k8sStateManager) get(ctx context.Context) error {
+	resp, err := ksm.request(ctx, fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", ksm.namespace, ksm.name), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var cm k8sConfigMap
+	if err := json.NewDecoder(resp.Body).Decode(&cm); err != nil {
+		return obserr.Annotate(err, "error decoding the configmap")
+	}
+	return ksm.load(&cm)
+}
+
+func (ksm *k8sStateManager) load(cm *k8sConfigMap) (err error) {
+	ksm.loadMu.Lock()
+	defer ksm.loadMu.Unlock()
+	defer ksm.startLoad(context.Background())(&err)
+
+	ksm.resourceVersion = cm.Metadata.ResourceVersion
+	data, ok := cm.Data[K8sDataKey]
+	if !ok {
+		return obserr.Annotate(ErrNotFound, "configmap has no configs").Set("data_key", K8sDataKey)
+	}
+	State, err := parseState([]byte(data))
+	if err != nil {
+		return obserr.Annotate(err, "error json unmarshal the State").Set("path", ksm.filePath)
+	}
+	return ksm.loadState(State)
+}
+
+// version returns the resource version to watch from,
+// empty if the ConfigMap must be read again
+func (ksm *k8sStateManager) version() string {
+	ksm.loadMu.Lock()
+	defer ksm.loadMu.Unlock()
+	return ksm.resourceVersion
+}
+
+func (ksm *k8sStateManager) setVersion(version string) {
+	ksm.loadMu.Lock()
+	defer ksm.loadMu.Unlock()
+	ksm.resourceVersion = version
+}
+
+// run watches the ConfigMap until ctx is done
+func (ksm *k8sStateManager) run(ctx context.Context) {
+	fs := ksm.fr.WithSpan(ctx)
+	for {
+		if err := ksm.watch(ctx); err != nil && ctx.Err() == nil {
+			fs.Warn("error_watching", "error while watching the configmap", obs.Vals{
+				"path": ksm.filePath,
+			}.WithError(err))
+		}
+		wait, timer := clock.After(ksm.clk(), k8sRewatchDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-wait:
+		}
+		if ksm.version() == "" {
+			// the watch expired, start over from the current version
+			if err := ksm.get(ctx); err != nil && ctx.Err() == nil {
+				fs.Warn("error_read", "could not read the configmap", obs.Vals{
+					"path": ksm.filePath,
+				}.WithError(err))
+			}
+		}
+	}
+}
+
+// watch applies the changes to the ConfigMap until the
+// API server closes the watch
+func (ksm *k8sStateManager) watch(ctx context.Context) error {
+	fs := ksm.fr.WithSpan(ctx)
+	resp, err := ksm.request(ctx, fmt.Sprintf("/api/v1/namespaces/%s/configmaps", ksm.namespace), url.Values{
+		"watch":           {"1"},
+		"fieldSelector":   {"metadata.name=" + ksm.name},
+		"resourceVersion": {ksm.version()},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event k8sWatchEvent
+		if err := dec.Decode(&event); err != nil {
+			return obserr.Annotate(err, "error decoding the watch event")
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var cm k8sConfigMap
+			if err := json.Unmarshal(event.Object, &cm); err != nil {
+				return obserr.Annotate(err, "error decoding the configmap")
+			}
+			if err := ksm.load(&cm); err != nil {
+				fs.Warn("error_read", "could not read the configmap", obs.Vals{
+					"path": ksm.filePath,
+				}.WithError(err))
+			}
+		case "DELETED":
+			fs.Warn("configmap_deleted", "configmap deleted, keeping the last configs", obs.Vals{
+				"path": ksm.filePath,
+			})
+		case "ERROR":
+			// most likely 410 Gone: the resource version is too old
+			ksm.setVersion("")
+			return obserr.Annotate(fmt.Errorf("%s", event.Object), "watch failed")
+		}
+	}
+}
+
+// Reload gets the ConfigMap again, without waiting for a watch event
+func (ksm *k8sStateManager) Reload() error {
+	return ksm.get(context.Background())
+}
+
+func (ksm *k8sStateManager) Close() {
+	ksm.cancel()
+	ksm.wg.Wait()
+	ksm.stateManager.Close()
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func k8sConfigMapJSON(t *testing.T, version, configs string) []byte {
+	var cm k8sConfigMap
+	cm.Metadata.ResourceVersion = version
+	cm.Data = map[string]string{K8sDataKey: configs}
+	data, err := json.Marshal(cm)
+	require.NoError(t, err)
+	return data
+}
+
+func TestK8sStateManager(t *testing.T) {
+	events := make(chan []byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/api/v1/namespaces/ns/configmaps/cm":
+			w.Write(k8sConfigMapJSON(t, "1", `[{"key": "foo", "value": 1}]`))
+		case "/api/v1/namespaces/ns/configmaps":
+			assert.Equal(t, "metadata.name=cm", r.URL.Query().Get("fieldSelector"))
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case event := <-events:
+					w.Write(event)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &K8sConfig{Host: srv.URL, Token: "secret"}
+	sm, err := NewK8sStateManager(cfg, "ns", "cm", "k8s-test", obs.NullFR)
+	require.NoError(t, err)
+	defer sm.Close()
+
+	cfgFoo, err := sm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfgFoo.String())
+
+	changed := make(chan []byte, 10)
+	defer sm.Subscribe("foo", func(_, new []byte) { changed <- new })()
+	events <- []byte(fmt.Sprintf(`{"type": "MODIFIED", "object": %s}`, k8sConfigMapJSON(t, "2", `[{"key": "foo", "value": 2}]`)))
+	assert.Equal(t, "2", string(<-changed))
+
+	// the configs are kept when the configmap is deleted
+	events <- []byte(fmt.Sprintf(`{"type": "DELETED", "object": %s}`, k8sConfigMapJSON(t, "3", "")))
+	events <- []byte(fmt.Sprintf(`{"type": "ADDED", "object": %s}`, k8sConfigMapJSON(t, "4", `[{"key": "foo", "value": 3}]`)))
+	assert.Equal(t, "3", string(<-changed))
+
+	// reloads do not race with the watch
+	require.NoError(t, sm.Reload())
+
+	_, err = NewK8sStateManager(cfg, "ns", "missing", "k8s-test-missing", obs.NullFR)
+	assert.Error(t, err)
+}
+
+func TestK8sStateManagerStartupTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cfg := &K8sConfig{Host: srv.URL}
+	_, err := NewK8sStateManager(cfg, "ns", "cm", "k8s-test-timeout", obs.NullFR, WithStartupTimeout(50*time.Millisecond))
+	assert.Error(t, err)
+}
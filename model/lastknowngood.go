@@ -0,0 +1,101 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// DefaultLastKnownGoodDir is the directory of the last
+// known good configs when WithLastKnownGood is given no directory
+const DefaultLastKnownGoodDir = "/var/cache/configmanager"
+
+// WithLastKnownGood writes the configs loaded from the configs file of
+// the scope to <dir>/<scope>.json, and loads them from there when the
+// configs file is missing or can not be loaded when the StateManager is
+// created, e.g. while a configmap is being distributed. Sensitive
+// configs are not written. Layered files such as the overrides are not
+// cached. A configs file missing at creation is loaded once it is
+// created. An empty dir uses DefaultLastKnownGoodDir.
+func WithLastKnownGood(dir string) Option {
+	return func(sm *stateManager) {
+		if dir == "" {
+			dir = DefaultLastKnownGoodDir
+		}
+		sm.lastKnownGoodDir = dir
+	}
+}
+
+// lastKnownGoodPath returns the cache file of scope,
+// or "" if there is no last known good directory
+func (sm *stateManager) lastKnownGoodPath(scope string) string {
+	if sm.lastKnownGoodDir == "" {
+		return ""
+	}
+	return path.Join(sm.lastKnownGoodDir, scope+".json")
+}
+
+// saveLastKnownGood writes the loaded State to the cache file. The
+// file is renamed in place so that a crash never leaves it truncated.
+func (sm *stateManager) saveLastKnownGood() error {
+	if sm.sensitive {
+		return nil
+	}
+	State := sm.current()
+	configs := make([]*Config, 0, len(State.Configs))
+	for _, cfg := range State.Configs {
+		if !cfg.Sensitive {
+			configs = append(configs, cfg)
+		}
+	}
+	data, err := json.Marshal(configs)
+	if err != nil {
+		return obserr.Annotate(err, "saveLastKnownGood: error marshalling the configs")
+	}
+	if err := os.MkdirAll(path.Dir(sm.lastKnownGood), 0700); err != nil {
+		return obserr.Annotate(err, "saveLastKnownGood: error creating the directory").Set("path", sm.lastKnownGood)
+	}
+	f, err := ioutil.TempFile(path.Dir(sm.lastKnownGood), path.Base(sm.lastKnownGood)+".tmp")
+	if err != nil {
+		return obserr.Annotate(err, "saveLastKnownGood: error creating the file").Set("path", sm.lastKnownGood)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), sm.lastKnownGood)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return obserr.Annotate(err, "saveLastKnownGood: error writing the file").Set("path", sm.lastKnownGood)
+	}
+	return nil
+}
+
+// loadLastKnownGood loads the State from the cache file
+func (sm *stateManager) loadLastKnownGood() error {
+	data, err := ioutil.ReadFile(sm.lastKnownGood)
+	if err != nil {
+		return obserr.Annotate(err, "loadLastKnownGood: error reading the file").Set("path", sm.lastKnownGood)
+	}
+	State, err := parseState(data)
+	if err != nil {
+		return obserr.Annotate(err, "loadLastKnownGood: error unmarshal the State").Set("path", sm.lastKnownGood)
+	}
+	if err := sm.loadState(State); err != nil {
+		return err
+	}
+	fs := sm.fr.WithSpan(context.Background())
+	fs.Incr("last_known_good_loaded")
+	fs.Warn("last_known_good_loaded", "could not load the configs, loaded the last known good configs", obs.Vals{
+		"path":            sm.filePath,
+		"last_known_good": sm.lastKnownGood,
+	})
+	return nil
+}
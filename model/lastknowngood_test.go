@@ -0,0 +1,55 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastKnownGood(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	cacheDir := path.Join(dir, "cache")
+	ns := "last_known_good"
+	safeWriteFile(t, path.Join(dir, ns, "configs.json"), `[{"key": "foo", "value": 1}, {"key": "secret", "value": 2, "sensitive": true}]`)
+
+	sm, err := NewStateManager(dir, ns, nil, obs.NullFR, WithLastKnownGood(cacheDir))
+	require.NoError(t, err)
+	sm.Close()
+	cached, err := ioutil.ReadFile(path.Join(cacheDir, ns+".json"))
+	require.NoError(t, err)
+
+	// the expvar map of a scope can only be created once, copy the cache
+	for _, tc := range []struct {
+		ns      string
+		configs string
+	}{
+		{"last_known_good_unparsable", `[{"key": "foo", "val`},
+		{"last_known_good_missing", ""},
+	} {
+		if tc.configs != "" {
+			safeWriteFile(t, path.Join(dir, tc.ns, "configs.json"), tc.configs)
+		}
+		require.NoError(t, ioutil.WriteFile(path.Join(cacheDir, tc.ns+".json"), cached, 0600))
+		sm, err := NewStateManager(dir, tc.ns, nil, obs.NullFR, WithLastKnownGood(cacheDir))
+		require.NoError(t, err, tc.ns)
+		cfg, err := sm.GetKey("foo")
+		require.NoError(t, err, tc.ns)
+		assert.Equal(t, "1", cfg.String(), tc.ns)
+		// sensitive configs are not cached
+		_, err = sm.GetKey("secret")
+		assert.Equal(t, ErrNotFound, err, tc.ns)
+		sm.Close()
+	}
+
+	_, err = NewStateManager(dir, "last_known_good_none", nil, obs.NullFR, WithLastKnownGood(cacheDir))
+	assert.Error(t, err)
+	_, err = os.Stat(path.Join(cacheDir, "last_known_good_none.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,207 @@
+package model
+
+import (
+	"path"
+	"sync/atomic"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// layeredStateManager merges the States of several StateManagers.
+// Layers are ordered from the lowest to the highest precedence so
+// a key found in a later layer shadows the same key in earlier
+// layers. The merged State is rebuilt every time a layer reloads.
+type layeredStateManager struct {
+	// layers and the cancels of their subscriptions
+	// are guarded by rebuildMu, see setLayers
+	layers  []StateManager
+	cancels []func()
+
+	// rebuildMu serializes rebuilds triggered by layers
+	// reloading concurrently, the listeners are notified
+	// once it is released
+	rebuildMu loadMutex
+
+	// state holds the merged *State
+	state atomic.Value
+
+	listeners reloadListeners
+}
+
+// NewLayeredStateManager returns a StateManager merging the configs
+// of layers, ordered from the lowest to the highest precedence. Closing
+// it closes all the layers.
+func NewLayeredStateManager(layers ...StateManager) StateManager {
+	return newLayeredStateManager(layers)
+}
+
+// NewCompositeStateManager returns a StateManager resolving every key
+// from the first of sources that has it, e.g. the Kubernetes API for
+// flags, then a file for static configs. Reloads of any source are
+// notified. Closing it closes all the sources.
+func NewCompositeStateManager(sources ...StateManager) StateManager {
+	layers := make([]StateManager, len(sources))
+	for i, source := range sources {
+		layers[len(sources)-1-i] = source
+	}
+	return newLayeredStateManager(layers)
+}
+
+func newLayeredStateManager(layers []StateManager) *layeredStateManager {
+	lsm := &layeredStateManager{layers: layers}
+	lsm.rebuild()
+	for _, layer := range layers {
+		lsm.cancels = append(lsm.cancels, layer.OnReload(lsm.rebuild))
+	}
+	return lsm
+}
+
+// NewMultiScopeStateManager returns a StateManager that loads several
+// scopes under dirPath and resolves keys in the order of the scopes:
+// a key in a later scope shadows the same key in the earlier ones,
+// e.g. []string{"global", "ingest", "ingest-canary"}.
+func NewMultiScopeStateManager(dirPath string, scopes []string, fr obs.FlightRecorder, opts ...Option) (StateManager, error) {
+	layers := make([]StateManager, 0, len(scopes))
+	for _, scope := range scopes {
+		sm, err := NewStateManager(dirPath, scope, nil, fr, opts...)
+		if err != nil {
+			for _, layer := range layers {
+				layer.Close()
+			}
+			return nil, obserr.Annotate(err, "Error creating the state manager for scope").Set(
+				"path", path.Join(dirPath, scope),
+			)
+		}
+		layers = append(layers, sm)
+	}
+	return newLayeredStateManager(layers), nil
+}
+
+func (lsm *layeredStateManager) rebuild() {
+	lsm.rebuildMu.Lock()
+	defer lsm.rebuildMu.Unlock()
+
+	state := &State{}
+	state.buildCache()
+	for _, layer := range lsm.layers {
+		snap := layer.Snapshot()
+		for _, key := range snap.Keys() {
+			cfg, err := snap.GetKey(key)
+			if err != nil {
+				continue
+			}
+			state.cache[key] = cfg
+		}
+	}
+	for _, key := range state.keys() {
+		state.Configs = append(state.Configs, state.cache[key])
+	}
+
+	// the configs of the layers that did not
+	// reload keep their parsed values
+	old := lsm.current()
+	state.inheritParsed(old)
+	lsm.state.Store(state)
+	lsm.rebuildMu.fireAfter(func() { lsm.listeners.fire(newReload(old, state)) })
+}
+
+// setLayers replaces the layers by layers and rebuilds the merged
+// State. The layers that are not in layers anymore are closed.
+func (lsm *layeredStateManager) setLayers(layers []StateManager) {
+	lsm.rebuildMu.Lock()
+	cancels := make(map[StateManager]func(), len(lsm.layers))
+	for i, layer := range lsm.layers {
+		cancels[layer] = lsm.cancels[i]
+	}
+	lsm.cancels = make([]func(), 0, len(layers))
+	for _, layer := range layers {
+		cancel, ok := cancels[layer]
+		if !ok {
+			cancel = layer.OnReload(lsm.rebuild)
+		}
+		delete(cancels, layer)
+		lsm.cancels = append(lsm.cancels, cancel)
+	}
+	lsm.layers = layers
+	lsm.rebuildMu.Unlock()
+
+	// the removed layers are closed outside of rebuildMu
+	// since they wait for their rebuilds in flight
+	for layer, cancel := range cancels {
+		cancel()
+		layer.Close()
+	}
+	lsm.rebuild()
+}
+
+// currentLayers returns the layers and the cancels of their subscriptions
+func (lsm *layeredStateManager) currentLayers() ([]StateManager, []func()) {
+	lsm.rebuildMu.Lock()
+	defer lsm.rebuildMu.Unlock()
+	return lsm.layers, lsm.cancels
+}
+
+// current returns the merged State, nil before the first rebuild
+func (lsm *layeredStateManager) current() *State {
+	state, _ := lsm.state.Load().(*State)
+	return state
+}
+
+func (lsm *layeredStateManager) GetKey(key string) (*Config, error) {
+	return lsm.current().get(key)
+}
+
+func (lsm *layeredStateManager) Keys() []string {
+	return lsm.current().keys()
+}
+
+func (lsm *layeredStateManager) GetParsedValue(cfg *Config) interface{} {
+	return lsm.current().parsedValue(cfg)
+}
+
+func (lsm *layeredStateManager) SetParsedValue(cfg *Config, val interface{}) {
+	lsm.current().setParsedValue(cfg, val)
+}
+
+func (lsm *layeredStateManager) Snapshot() StateManager {
+	return &snapshotStateManager{
+		NullStateManager: &NullStateManager{},
+		state:            lsm.current(),
+	}
+}
+
+func (lsm *layeredStateManager) OnReload(fn func()) func() {
+	return lsm.listeners.add(onReload(fn))
+}
+
+func (lsm *layeredStateManager) Subscribe(key string, fn func(old, new []byte)) func() {
+	return lsm.listeners.add(onKeyChange(key, fn))
+}
+
+func (lsm *layeredStateManager) OnDiff(fn func(Diff)) func() {
+	return lsm.listeners.add(onDiff(fn))
+}
+
+// Reload reloads every layer and returns the first error
+func (lsm *layeredStateManager) Reload() error {
+	var first error
+	layers, _ := lsm.currentLayers()
+	for _, layer := range layers {
+		if err := layer.Reload(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (lsm *layeredStateManager) Close() {
+	layers, cancels := lsm.currentLayers()
+	for _, cancel := range cancels {
+		cancel()
+	}
+	for _, layer := range layers {
+		layer.Close()
+	}
+	lsm.listeners.close()
+}
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// reload is the swap of the old State by the new
+// one. The Diff is computed once on first use.
+type reload struct {
+	old, new *State
+
+	diffOnce sync.Once
+	diff     Diff
+}
+
+func newReload(old, new *State) *reload {
+	return &reload{old: old, new: new}
+}
+
+func (r *reload) Diff() Diff {
+	r.diffOnce.Do(func() {
+		r.diff = DiffStates(r.old, r.new)
+	})
+	return r.diff
+}
+
+// reloadListeners keeps track of the callbacks called
+// on every reload, in the order they were registered
+type reloadListeners struct {
+	mu     sync.Mutex
+	nextID int
+	fns    map[int]func(*reload)
+
+	// closed is set by close, inFlight counts the fires running
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+func (r *reloadListeners) add(fn func(*reload)) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fns == nil {
+		r.fns = make(map[int]func(*reload))
+	}
+	id := r.nextID
+	r.nextID++
+	r.fns[id] = fn
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.fns, id)
+	}
+}
+
+func (r *reloadListeners) fire(rl *reload) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.inFlight.Add(1)
+	defer r.inFlight.Done()
+	ids := make([]int, 0, len(r.fns))
+	for id := range r.fns {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	fns := make([]func(*reload), 0, len(ids))
+	for _, id := range ids {
+		fns = append(fns, r.fns[id])
+	}
+	r.mu.Unlock()
+	for _, fn := range fns {
+		fn(rl)
+	}
+}
+
+// close unregisters all the callbacks and waits for the ones
+// running to return. It must not be called from a callback.
+func (r *reloadListeners) close() {
+	r.mu.Lock()
+	r.closed = true
+	r.fns = nil
+	r.mu.Unlock()
+	r.inFlight.Wait()
+}
+
+func onReload(fn func()) func(*reload) {
+	return func(*reload) {
+		fn()
+	}
+}
+
+// onKeyChange only calls fn when the raw value of key differs
+// between the old and the new State
+func onKeyChange(key string, fn func(old, new []byte)) func(*reload) {
+	return func(r *reload) {
+		ov, nv := r.old.raw(key), r.new.raw(key)
+		if (ov == nil) == (nv == nil) && bytes.Equal(ov, nv) {
+			return
+		}
+		fn(ov, nv)
+	}
+}
+
+func onDiff(fn func(Diff)) func(*reload) {
+	return func(r *reload) {
+		if d := r.Diff(); !d.Empty() {
+			fn(d)
+		}
+	}
+}
+
+// loadMutex serializes the loads of a StateManager. The notifications
+// of the reloads are queued while it is held and fired by Unlock once it
+// is released, so that the callbacks may call Reload. The notifications
+// are fired one at a time in the order of the loads: an Unlock while
+// another one fires, e.g. the one of a Reload from a callback, leaves
+// its notifications to the firing one.
+type loadMutex struct {
+	sync.Mutex
+
+	queueMu sync.Mutex
+	queue   []func()
+	firing  bool
+}
+
+// fireAfter queues fn until Unlock, it must be called with m held
+func (m *loadMutex) fireAfter(fn func()) {
+	m.queueMu.Lock()
+	m.queue = append(m.queue, fn)
+	m.queueMu.Unlock()
+}
+
+func (m *loadMutex) Unlock() {
+	m.queueMu.Lock()
+	fire := !m.firing && len(m.queue) > 0
+	m.firing = m.firing || fire
+	m.queueMu.Unlock()
+	m.Mutex.Unlock()
+	if !fire {
+		return
+	}
+	for {
+		m.queueMu.Lock()
+		if len(m.queue) == 0 {
+			m.firing = false
+			m.queueMu.Unlock()
+			return
+		}
+		fn := m.queue[0]
+		m.queue = m.queue[1:]
+		m.queueMu.Unlock()
+		fn()
+	}
+}
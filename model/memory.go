@@ -0,0 +1,86 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// MemoryStateManager is a StateManager holding configs pushed by the
+// application, e.g. received from its own control plane. Unlike the
+// DummyStateManager it has the same reload semantics as the file
+// StateManager: each Push replaces all the configs and notifies the
+// listeners with the diff.
+type MemoryStateManager struct {
+	*stateManager
+}
+
+// NewMemoryStateManager returns a MemoryStateManager holding configs.
+// scope names the expvar map of the configs like with NewStateManager.
+func NewMemoryStateManager(scope string, configs []*Config, fr obs.FlightRecorder, opts ...Option) *MemoryStateManager {
+	msm := &MemoryStateManager{
+		stateManager: &stateManager{
+			filePath:   fmt.Sprintf("memory:%s", scope),
+			updateChan: make(chan struct{}),
+			fr:         fr.ScopeName("memory_state_manager"),
+		},
+	}
+	for _, opt := range opts {
+		opt(msm.stateManager)
+	}
+	msm.publishExpvar(fmt.Sprintf("configmanager.%s", scope))
+	if err := msm.Push(configs); err != nil {
+		msm.fr.WithSpan(context.Background()).Warn("error_push", "initial configs rejected", obs.Vals{
+			"path": msm.filePath,
+		}.WithError(err))
+	}
+	return msm
+}
+
+// Reload does nothing, the configs are only replaced by Push
+func (msm *MemoryStateManager) Reload() error {
+	return nil
+}
+
+// Push replaces all the configs with configs. The configs are
+// copied so the caller may reuse them. It is safe to call
+// concurrently with the getters and with other pushes. The
+// configs are kept if the new ones are rejected, e.g. for
+// duplicate keys, and the error is returned. Values failing
+// validation or their type keep their previous value, the
+// other ones are loaded and ErrInvalidValues is returned. The
+// result is passed to the WithOnLoad funcs like the loads of the
+// other sources.
+func (msm *MemoryStateManager) Push(configs []*Config) (err error) {
+	State := &State{
+		Configs: make([]*Config, 0, len(configs)),
+		cache:   make(map[string]*Config),
+	}
+	for _, cfg := range configs {
+		State.Configs = append(State.Configs, &Config{
+			Key:        cfg.Key,
+			RawValue:   append([]byte(nil), cfg.RawValue...),
+			Sensitive:  cfg.Sensitive,
+			Type:       cfg.Type,
+			Deprecated: cfg.Deprecated,
+		})
+	}
+
+	// loadMu orders the notifications of concurrent pushes
+	msm.loadMu.Lock()
+	defer msm.loadMu.Unlock()
+	defer msm.startLoad(context.Background())(&err)
+	invalid, err := msm.swapState(State)
+	if err != nil {
+		return obserr.Annotate(err, "Error pushing the configs").Set("path", msm.filePath)
+	}
+	if len(invalid) > 0 {
+		return obserr.Annotate(ErrInvalidValues, "pushed configs with invalid values, keeping their previous values").Set(
+			"path", msm.filePath,
+			"keys", invalid,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStateManager(t *testing.T) {
+	configs := []*Config{{Key: "foo", RawValue: json.RawMessage("1")}}
+	msm := NewMemoryStateManager("memory-test", configs, obs.NullFR)
+	defer msm.Close()
+
+	// pushed configs are copied
+	configs[0].RawValue = json.RawMessage("2")
+	cfg, err := msm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfg.String())
+
+	var diffs []Diff
+	defer msm.OnDiff(func(d Diff) { diffs = append(diffs, d) })()
+	require.NoError(t, msm.Push([]*Config{{Key: "bar", RawValue: json.RawMessage("3")}}))
+	assert.Equal(t, []string{"bar"}, msm.Keys())
+	require.Len(t, diffs, 1)
+	assert.Equal(t, []string{"bar"}, changeKeys(diffs[0].Added))
+	assert.Equal(t, []string{"foo"}, changeKeys(diffs[0].Removed))
+}
+
+func TestMemoryStateManagerRejectedPush(t *testing.T) {
+	configs := []*Config{{Key: "foo", RawValue: json.RawMessage("1")}}
+	var loads []error
+	msm := NewMemoryStateManager("memory-rejected-test", configs, obs.NullFR, WithoutExpvar(),
+		WithDuplicateKeys(DuplicateKeysError), WithOnLoad(func(err error) { loads = append(loads, err) }))
+	defer msm.Close()
+
+	err := msm.Push([]*Config{
+		{Key: "foo", RawValue: json.RawMessage("2")},
+		{Key: "foo", RawValue: json.RawMessage("3")},
+	})
+	assert.Equal(t, ErrDuplicateKeys, obserr.Original(err))
+	// the pushes are reported like loads
+	require.Len(t, loads, 2)
+	assert.NoError(t, loads[0])
+	assert.Equal(t, ErrDuplicateKeys, obserr.Original(loads[1]))
+	// the configs are kept
+	cfg, err := msm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfg.String())
+}
+
+func TestReloadReusesUnchangedConfigs(t *testing.T) {
+	var sizes []int64
+	configs := []*Config{
+		{Key: "foo", RawValue: json.RawMessage("1")},
+		{Key: "bar", RawValue: json.RawMessage(`"x"`)},
+	}
+	msm := NewMemoryStateManager("memory-reuse-test", configs, obs.NullFR, WithoutExpvar(),
+		WithOnStateSize(func(bytes int64) { sizes = append(sizes, bytes) }))
+	defer msm.Close()
+
+	foo, err := msm.GetKey("foo")
+	require.NoError(t, err)
+	bar, err := msm.GetKey("bar")
+	require.NoError(t, err)
+	msm.SetParsedValue(foo, int64(1))
+
+	require.NoError(t, msm.Push([]*Config{
+		{Key: "foo", RawValue: json.RawMessage("1")},
+		{Key: "bar", RawValue: json.RawMessage(`"y"`)},
+	}))
+	// the unchanged config is kept with its parsed value
+	newFoo, err := msm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Same(t, foo, newFoo)
+	assert.Equal(t, int64(1), msm.GetParsedValue(newFoo))
+	newBar, err := msm.GetKey("bar")
+	require.NoError(t, err)
+	assert.NotSame(t, bar, newBar)
+	assert.Equal(t, `"y"`, string(newBar.RawValue))
+
+	// a config changed to a sensitive one is not reused
+	require.NoError(t, msm.Push([]*Config{{Key: "foo", RawValue: json.RawMessage("1"), Sensitive: true}}))
+	newFoo, err = msm.GetKey("foo")
+	require.NoError(t, err)
+	assert.NotSame(t, foo, newFoo)
+	assert.Nil(t, msm.GetParsedValue(newFoo))
+
+	// foo 1 bar "x", foo 1 bar "y", foo 1
+	assert.Equal(t, []int64{10, 10, 4}, sizes)
+}
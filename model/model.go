@@ -1,14 +1,22 @@
 package model
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"expvar"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"os"
 	"path"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/mixpanel/configmanager/clock"
 	"github.com/mixpanel/configmanager/configmap"
 
 	"github.com/mixpanel/obs"
@@ -23,9 +31,119 @@ var (
 // the configuration to be. When the file configs.json
 // is parsed, State manager expects an array of this struct.
 type Config struct {
-	Key         string          `json:"key"`
-	RawValue    json.RawMessage `json:"value"`
-	parsedValue interface{}
+	Key      string          `json:"key"`
+	RawValue json.RawMessage `json:"value"`
+	// Sensitive configs are not published to
+	// expvar and their values are never logged
+	Sensitive bool `json:"sensitive,omitempty"`
+	// Type, if set, is checked when the config is loaded
+	// and when it is read by the typed getters
+	Type ConfigType `json:"type,omitempty"`
+	// Deprecated, if set, explains what to use instead of
+	// the config. Reads of deprecated configs are reported.
+	Deprecated string `json:"deprecated,omitempty"`
+	// scalar holds the *scalarValue of the scalar getters, it
+	// only depends on RawValue so it is shared by the States
+	scalar atomic.Value
+}
+
+// scalarValue is the value parsed by the scalar getters, typed
+// so that reads neither box it nor switch on its type
+type scalarValue struct {
+	typ ConfigType
+	b   bool
+	i   int64
+	f   float64
+	s   string
+}
+
+func (c *Config) cachedScalar(typ ConfigType) (*scalarValue, bool) {
+	sv, _ := c.scalar.Load().(*scalarValue)
+	if sv == nil || sv.typ != typ {
+		return nil, false
+	}
+	return sv, true
+}
+
+// CachedScalar returns the value cached by the scalar
+// getters in an interface{}, nil if none, e.g. for debugging
+func (c *Config) CachedScalar() interface{} {
+	sv, _ := c.scalar.Load().(*scalarValue)
+	if sv == nil {
+		return nil
+	}
+	switch sv.typ {
+	case TypeBool:
+		return sv.b
+	case TypeInt64:
+		return sv.i
+	case TypeFloat64:
+		return sv.f
+	default:
+		return sv.s
+	}
+}
+
+// CachedBool returns the bool set by CacheBool, if any
+func (c *Config) CachedBool() (bool, bool) {
+	sv, ok := c.cachedScalar(TypeBool)
+	if !ok {
+		return false, false
+	}
+	return sv.b, true
+}
+
+// CacheBool caches the parsed bool value of the config
+func (c *Config) CacheBool(val bool) {
+	c.scalar.Store(&scalarValue{typ: TypeBool, b: val})
+}
+
+// CachedInt64 returns the int64 set by CacheInt64, if any
+func (c *Config) CachedInt64() (int64, bool) {
+	sv, ok := c.cachedScalar(TypeInt64)
+	if !ok {
+		return 0, false
+	}
+	return sv.i, true
+}
+
+// CacheInt64 caches the parsed int64 value of the config
+func (c *Config) CacheInt64(val int64) {
+	c.scalar.Store(&scalarValue{typ: TypeInt64, i: val})
+}
+
+// CachedFloat64 returns the float64 set by CacheFloat64, if any
+func (c *Config) CachedFloat64() (float64, bool) {
+	sv, ok := c.cachedScalar(TypeFloat64)
+	if !ok {
+		return 0, false
+	}
+	return sv.f, true
+}
+
+// CacheFloat64 caches the parsed float64 value of the config
+func (c *Config) CacheFloat64(val float64) {
+	c.scalar.Store(&scalarValue{typ: TypeFloat64, f: val})
+}
+
+// CachedString returns the string set by CacheString, if any
+func (c *Config) CachedString() (string, bool) {
+	sv, ok := c.cachedScalar(TypeString)
+	if !ok {
+		return "", false
+	}
+	return sv.s, true
+}
+
+// CacheString caches the parsed string value of the config
+func (c *Config) CacheString(val string) {
+	c.scalar.Store(&scalarValue{typ: TypeString, s: val})
+}
+
+// ResetScalar drops the value cached by the scalar getters,
+// e.g. when the config is decoded differently from now on
+func (c *Config) ResetScalar() {
+	c.scalar.Store((*scalarValue)(nil))
 }
 
 func (c *Config) String() string {
@@ -37,6 +155,98 @@ func (c *Config) String() string {
 type State struct {
 	Configs []*Config
 	cache   map[string]*Config
+
+	// parsed holds the parsedValue of the values parsed from the
+	// configs of the State by key. The keys are set once per reload
+	// and read many times, which is what sync.Map is made for.
+	parsed sync.Map
+}
+
+// parsedValue is the value parsed from cfg
+type parsedValue struct {
+	cfg *Config
+	val interface{}
+}
+
+// parsedValue returns the value set by setParsedValue for cfg, nil
+// if none or if cfg is not the config of its key in the State
+func (s *State) parsedValue(cfg *Config) interface{} {
+	if s == nil {
+		return nil
+	}
+	v, ok := s.parsed.Load(cfg.Key)
+	if !ok {
+		return nil
+	}
+	pv := v.(parsedValue)
+	if pv.cfg != cfg {
+		return nil
+	}
+	return pv.val
+}
+
+// setParsedValue sets the value parsed from cfg, it is dropped
+// if cfg is not the config of its key in the State, e.g. when
+// it was read from the State before a reload
+func (s *State) setParsedValue(cfg *Config, val interface{}) {
+	if s == nil || s.cache[cfg.Key] != cfg {
+		return
+	}
+	s.parsed.Store(cfg.Key, parsedValue{cfg: cfg, val: val})
+}
+
+// inheritParsed sets the values parsed from the configs
+// of old that are still the configs of their keys in s
+func (s *State) inheritParsed(old *State) {
+	if s == nil || old == nil {
+		return
+	}
+	old.parsed.Range(func(key, v interface{}) bool {
+		if pv := v.(parsedValue); s.cache[key.(string)] == pv.cfg {
+			s.parsed.Store(key, pv)
+		}
+		return true
+	})
+}
+
+// reuse replaces the configs of s that did not change since old with
+// the ones of old, and the keys of the other configs with the same
+// strings of old, so that reloads do not keep several copies of
+// the unchanged keys and values, and they keep their parsed values
+func (s *State) reuse(old *State) {
+	if old == nil {
+		return
+	}
+	for i, cfg := range s.Configs {
+		prev, ok := old.lookup(cfg.Key)
+		if !ok {
+			continue
+		}
+		if sameConfig(cfg, prev) {
+			s.Configs[i] = prev
+			continue
+		}
+		cfg.Key = prev.Key
+	}
+}
+
+// sameConfig returns true if a and b only differ by their parsed values
+func sameConfig(a, b *Config) bool {
+	return a.Key == b.Key &&
+		a.Sensitive == b.Sensitive &&
+		a.Type == b.Type &&
+		a.Deprecated == b.Deprecated &&
+		bytes.Equal(a.RawValue, b.RawValue)
+}
+
+// size returns the number of bytes of the keys and the values of the
+// configs of the State, the memory it holds besides the parsed values
+func (s *State) size() int64 {
+	var size int64
+	for _, cfg := range s.Configs {
+		size += int64(len(cfg.Key) + len(cfg.RawValue) + len(cfg.Type) + len(cfg.Deprecated))
+	}
+	return size
 }
 
 func (s *State) buildCache() {
@@ -48,6 +258,35 @@ func (s *State) buildCache() {
 	}
 }
 
+// keys returns the sorted keys in the state
+func (s *State) keys() []string {
+	keys := make([]string, 0, len(s.cache))
+	for key := range s.cache {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lookup is get that is safe on a nil State
+func (s *State) lookup(key string) (*Config, bool) {
+	if s == nil {
+		return nil, false
+	}
+	cfg, ok := s.cache[key]
+	return cfg, ok
+}
+
+// raw returns the raw value of key or nil
+// if the key is missing
+func (s *State) raw(key string) []byte {
+	cfg, ok := s.lookup(key)
+	if !ok {
+		return nil
+	}
+	return cfg.RawValue
+}
+
 func (s *State) get(key string) (*Config, error) {
 	cfg, ok := s.cache[key]
 	if !ok {
@@ -56,18 +295,128 @@ func (s *State) get(key string) (*Config, error) {
 	return cfg, nil
 }
 
+// snapshotStateManager serves a State that is never swapped.
+// Parsed values are kept on the State so they are shared by
+// the snapshots of the State and the StateManager serving it.
+type snapshotStateManager struct {
+	*NullStateManager
+	state *State
+}
+
+func (s *snapshotStateManager) GetKey(key string) (*Config, error) {
+	return s.state.get(key)
+}
+
+func (s *snapshotStateManager) Keys() []string {
+	return s.state.keys()
+}
+
+func (s *snapshotStateManager) GetParsedValue(cfg *Config) interface{} {
+	return s.state.parsedValue(cfg)
+}
+
+func (s *snapshotStateManager) SetParsedValue(cfg *Config, val interface{}) {
+	s.state.setParsedValue(cfg, val)
+}
+
+func (s *snapshotStateManager) Snapshot() StateManager {
+	return s
+}
+
 type stateManager struct {
 	filePath string
 
+	// mu serializes the writes of the State and guards lastHash,
+	// cond is broadcast after loads. state holds the *State and is
+	// read without locks on the path of the getters.
 	mu    sync.RWMutex
 	cond  *sync.Cond
-	State *State
+	state atomic.Value
 
 	updateChan chan struct{}
 
 	watcher *configmap.CmWatcher
 
-	emap *expvar.Map
+	// emap publishes the configs as emapName, nil with noExpvar
+	// or once closed, guarded by publishMu
+	emap     *expvar.Map
+	emapName string
+	noExpvar bool
+	fr       obs.FlightRecorder
+
+	listeners reloadListeners
+	debounce  debouncer
+
+	overrides     bool
+	overridesPath string
+	environment   string
+
+	// sensitive marks all the configs as Sensitive
+	sensitive bool
+	// jsonc allows comments and trailing commas
+	jsonc bool
+
+	schemaLoader SchemaLoader
+	schema       Schema
+	validators   *Validators
+	requiredKeys []string
+
+	duplicateKeys DuplicateKeyPolicy
+
+	// lastKnownGood is the cache file of the configs,
+	// only set on the configs file of a scope
+	lastKnownGoodDir string
+	lastKnownGood    string
+
+	// lenientStart starts with an empty State when the file is missing
+	lenientStart bool
+	// optional is lenientStart for the files that are normally missing,
+	// like the overrides file: the missing file is not reported and the
+	// configs of the file are dropped once it is removed
+	optional bool
+
+	// startupCtx and startupTimeout bound the wait for the initial load,
+	// initErr is the error of the last load before the State is loaded
+	startupCtx     context.Context
+	startupTimeout time.Duration
+	initErr        error
+
+	// resyncInterval is the interval of the reloads without file events,
+	// lastHash is the hash of the content of the file last loaded, which
+	// is not kept so that large files are not held in memory twice
+	resyncInterval time.Duration
+	lastHash       *[sha256.Size]byte
+
+	// partialLoad skips the invalid entries of the configs
+	partialLoad    bool
+	onInvalidEntry func(err error)
+
+	// loadMu serializes the loads of the watcher, or of
+	// the poller of other sources, with Reload. The State
+	// is swapped with loadMu held and the listeners are
+	// notified once it is released.
+	loadMu loadMutex
+
+	// onLoad is called with the result of every load,
+	// traceLoad when a load starts
+	onLoad    func(source string, err error)
+	traceLoad func(source string) func(err error)
+	// onStateSize is called with the size of every State loaded
+	onStateSize func(bytes int64)
+
+	// clock is the clock of WithClock, nil for the time package
+	clock clock.Clock
+
+	// auditLog logs the values of every change
+	auditLog bool
+}
+
+// redacted is published to expvar
+// in place of sensitive values
+type redacted struct{}
+
+func (redacted) String() string {
+	return `"<redacted>"`
 }
 
 // Statemanager is responsible for managing
@@ -75,8 +424,30 @@ type stateManager struct {
 // with Statemanager to get raw configs
 type StateManager interface {
 	GetKey(string) (*Config, error)
+	// Keys returns the sorted keys currently loaded
+	Keys() []string
 	GetParsedValue(*Config) interface{}
 	SetParsedValue(*Config, interface{})
+	// Snapshot returns a StateManager pinned to the
+	// currently loaded State
+	Snapshot() StateManager
+	// OnReload registers fn to be called every time a new
+	// State is loaded. The returned func unregisters it. The
+	// callbacks of a reload are called in the order they were
+	// registered, including the ones of Subscribe and OnDiff,
+	// once the load is done so that they may call Reload.
+	OnReload(fn func()) (cancel func())
+	// Subscribe registers fn to be called with the old and
+	// new raw values every time a reload changes the value
+	// of key. A missing value is nil.
+	Subscribe(key string, fn func(old, new []byte)) (cancel func())
+	// OnDiff registers fn to be called with the changes
+	// of every reload that changed anything
+	OnDiff(fn func(Diff)) (cancel func())
+	// Reload synchronously reads the configs from the source
+	// again, loads them if they changed and returns the error
+	// of the load, if any
+	Reload() error
 	Close()
 }
 
@@ -87,6 +458,10 @@ func (n *NullStateManager) GetKey(string) (*Config, error) {
 	return nil, ErrNotFound
 }
 
+func (n *NullStateManager) Keys() []string {
+	return nil
+}
+
 func (n *NullStateManager) GetParsedValue(*Config) interface{} {
 	return nil
 }
@@ -94,27 +469,182 @@ func (n *NullStateManager) GetParsedValue(*Config) interface{} {
 func (n *NullStateManager) SetParsedValue(*Config, interface{}) {
 }
 
+func (n *NullStateManager) Snapshot() StateManager {
+	return n
+}
+
+func (n *NullStateManager) OnReload(fn func()) func() {
+	return func() {}
+}
+
+func (n *NullStateManager) Subscribe(string, func(old, new []byte)) func() {
+	return func() {}
+}
+
+func (n *NullStateManager) OnDiff(func(Diff)) func() {
+	return func() {}
+}
+
+func (n *NullStateManager) Reload() error {
+	return nil
+}
+
 func (n *NullStateManager) Close() {
 }
 
 // NewStateManager returns the State manager which is used
 // by the configmanager client. State manager watches the file
 // for config changes and loads the State in memory.
-func NewStateManager(dirPath string, scope string, updateChan chan struct{}, fr obs.FlightRecorder) (StateManager, error) {
+//
+// configs.yaml is loaded if the scope has no configs.json. It holds
+// either the same list as configs.json or a map of keys to values.
+// Otherwise configs.properties or configs.env is loaded, with a
+// KEY=value line per string config.
+//
+// The configs of defaults.json in the scope, if any, are the defaults
+// of the keys: configs.json and the other files shadow them.
+//
+// The json and yaml files in the configs.d directory of the scope, if any,
+// are merged on top of configs.json in the order of their names:
+// a key in a later file shadows the same key in earlier files.
+// Every file is watched, and so is the directory: the files added to
+// configs.d are loaded and the configs of the files removed are dropped.
+//
+// Unless another schema is given with WithSchema, configs.json is
+// validated against the configs.schema.json of the scope, if any.
+// Configs that do not match it are not loaded.
+func NewStateManager(dirPath string, scope string, updateChan chan struct{}, fr obs.FlightRecorder, opts ...Option) (StateManager, error) {
 	fr = fr.ScopeName("state_manager")
 
+	mainOpts := opts
+	loader := optionsOf(opts).schemaLoader
+	if loader == nil {
+		loader = JSONSchemaLoader
+	}
+	// the schema is loaded first since the
+	// initial load must be validated too
+	schema, err := loader(path.Join(dirPath, scope))
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error loading the schema").Set("path", path.Join(dirPath, scope))
+	}
+	if schema != nil {
+		mainOpts = append(opts[:len(opts):len(opts)], func(sm *stateManager) {
+			sm.schema = schema
+		})
+	}
+
+	if lastKnownGood := optionsOf(opts).lastKnownGoodPath(scope); lastKnownGood != "" {
+		mainOpts = append(mainOpts[:len(mainOpts):len(mainOpts)], func(sm *stateManager) {
+			sm.lastKnownGood = lastKnownGood
+		})
+	}
+
+	filePath := path.Join(dirPath, scope, "configs.json")
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		for _, name := range []string{YAMLFileName, PropertiesFileName, EnvFileName} {
+			if _, err := os.Stat(path.Join(dirPath, scope, name)); err == nil {
+				filePath = path.Join(dirPath, scope, name)
+				break
+			}
+		}
+	}
+	sm, err := newFileStateManager(filePath, fmt.Sprintf("configmanager.%s", scope), updateChan, fr, mainOpts)
+	if err != nil {
+		return nil, err
+	}
+	layers := []StateManager{sm}
+	closeLayers := func() {
+		for _, layer := range layers {
+			layer.Close()
+		}
+	}
+
+	defaultsPath := path.Join(dirPath, scope, DefaultsFileName)
+	if _, err := os.Stat(defaultsPath); err == nil {
+		dsm, err := newFileStateManager(defaultsPath, fmt.Sprintf("configmanager.%s.defaults", scope), nil, fr, opts)
+		if err != nil {
+			closeLayers()
+			return nil, obserr.Annotate(err, "Error loading the defaults")
+		}
+		layers = append([]StateManager{dsm}, layers...)
+	}
+
+	fragmentsPath := path.Join(dirPath, scope, FragmentsDirName)
+	if info, err := os.Stat(fragmentsPath); err == nil && info.IsDir() {
+		fsm, err := newFragmentsStateManager(fragmentsPath, scope, fr, opts)
+		if err != nil {
+			closeLayers()
+			return nil, err
+		}
+		layers = append(layers, fsm)
+	}
+
+	if sm.environment != "" {
+		envPath := path.Join(dirPath, scope, fmt.Sprintf("configs.%s.json", sm.environment))
+		if _, err := os.Stat(envPath); err == nil {
+			esm, err := newFileStateManager(envPath, fmt.Sprintf("configmanager.%s.%s", scope, sm.environment), nil, fr, opts)
+			if err != nil {
+				closeLayers()
+				return nil, obserr.Annotate(err, "Error loading the environment configs")
+			}
+			layers = append(layers, esm)
+		}
+	}
+
+	if sm.overrides {
+		overridesPath := sm.overridesPath
+		if overridesPath == "" {
+			overridesPath = path.Join(dirPath, scope, OverridesFileName)
+		}
+		// the overrides file usually only exists during incidents
+		overridesOpts := append(opts[:len(opts):len(opts)], func(sm *stateManager) {
+			sm.optional = true
+		})
+		osm, err := newFileStateManager(overridesPath, fmt.Sprintf("configmanager.%s.overrides", scope), nil, fr, overridesOpts)
+		if err != nil {
+			closeLayers()
+			return nil, obserr.Annotate(err, "Error loading the overrides")
+		}
+		layers = append(layers, osm)
+	}
+
+	if len(layers) == 1 {
+		return sm, nil
+	}
+	return newLayeredStateManager(layers), nil
+}
+
+func newFileStateManager(filePath, emapName string, updateChan chan struct{}, fr obs.FlightRecorder, opts []Option) (*stateManager, error) {
 	sm := &stateManager{
-		filePath: path.Join(dirPath, scope, "configs.json"),
-		emap:     expvar.NewMap(fmt.Sprintf("configmanager.%s", scope)),
+		filePath:       filePath,
+		updateChan:     updateChan,
+		startupTimeout: DefaultStartupTimeout,
+	}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	sm.publishExpvar(emapName)
+
+	// secrets may be mounted readable by their owner only,
+	// which the watcher would not report until the first read
+	if f, err := os.Open(sm.filePath); os.IsPermission(err) {
+		sm.unpublishExpvar()
+		return nil, obserr.Annotate(err, "Config file is not readable, check the defaultMode of the mounted volume").Set("path", sm.filePath)
+	} else if err == nil {
+		f.Close()
 	}
 
 	cmWatcher, err := configmap.NewCmWatcher(sm.filePath, sm.loadConfig, fr)
 	if err != nil {
+		sm.unpublishExpvar()
 		return nil, obserr.Annotate(err, "Error making cm watcher for the config manager").Set("path", sm.filePath)
 	}
+	cmWatcher.ResyncInterval = sm.resyncInterval
+	cmWatcher.Clock = sm.clk()
 	sm.watcher = cmWatcher
 
 	if err := sm.init(fr); err != nil {
+		sm.unpublishExpvar()
 		return nil, obserr.Annotate(err, "init failed")
 	}
 
@@ -122,6 +652,7 @@ func NewStateManager(dirPath string, scope string, updateChan chan struct{}, fr
 }
 
 func (sm *stateManager) init(fr obs.FlightRecorder) error {
+	sm.fr = fr
 	if sm.updateChan == nil {
 		// just make a dummy chan
 		sm.updateChan = make(chan struct{})
@@ -129,57 +660,343 @@ func (sm *stateManager) init(fr obs.FlightRecorder) error {
 	sm.cond = sync.NewCond(&sm.mu)
 
 	if err := sm.watcher.Start(); err != nil {
-		return obserr.Annotate(err, "error starting cm watcher")
+		if _, serr := os.Stat(sm.filePath); !os.IsNotExist(serr) {
+			return obserr.Annotate(err, "error starting cm watcher")
+		}
+		if serr := sm.startMissing(); serr != nil {
+			return obserr.Annotate(err, "error starting cm watcher")
+		}
+		if sm.optional {
+			sm.reportLoad(nil)
+			return nil
+		}
+		// the configs served were not loaded from the file
+		sm.reportLoad(obserr.Annotate(err, "config file is missing").Set("path", sm.filePath))
+		return nil
 	}
 
 	// wait for the initial loadConfig
+	ctx, cancel := sm.startupContext()
+	defer cancel()
+	waited := make(chan struct{})
+	defer close(waited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// the lock makes sure the waiter either sees
+			// the error or is waiting for the broadcast
+			sm.cond.L.Lock()
+			sm.cond.Broadcast()
+			sm.cond.L.Unlock()
+		case <-waited:
+		}
+	}()
+
 	sm.cond.L.Lock()
-	for sm.State == nil {
+	for sm.current() == nil && ctx.Err() == nil {
 		sm.cond.Wait()
 	}
+	loaded, initErr := sm.current() != nil, sm.initErr
 	sm.cond.L.Unlock()
+	if !loaded {
+		sm.watcher.Stop()
+		err := obserr.Annotate(ctx.Err(), "configs were not loaded before the startup deadline").Set("path", sm.filePath, "timeout", sm.startupTimeout)
+		if initErr != nil {
+			err = err.Set("load_error", initErr.Error())
+		}
+		return err
+	}
 	return nil
 }
 
-func (sm *stateManager) GetParsedValue(cfg *Config) interface{} {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+// startupContext returns the context bounding the initial load by
+// the startup context and the startup timeout of the StateManager
+func (sm *stateManager) startupContext() (context.Context, context.CancelFunc) {
+	ctx := sm.startupCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if sm.startupTimeout > 0 {
+		return context.WithTimeout(ctx, sm.startupTimeout)
+	}
+	return context.WithCancel(ctx)
+}
 
-	return cfg.parsedValue
+// startMissing starts from the last known good configs or, with
+// WithLenientStart, from an empty State when the file is missing,
+// and watches the parent directory to load the file once it is created
+func (sm *stateManager) startMissing() error {
+	sm.loadMu.Lock()
+	loaded := sm.lastKnownGood != "" && sm.loadLastKnownGood() == nil
+	sm.loadMu.Unlock()
+	if !loaded {
+		if !sm.lenientStart && !sm.optional {
+			return fmt.Errorf("no configs to start from")
+		}
+		// the empty State is not validated, required keys
+		// and schemas apply once the file is created
+		State := &State{}
+		State.buildCache()
+		sm.mu.Lock()
+		sm.state.Store(State)
+		sm.mu.Unlock()
+		if !sm.optional {
+			fs := sm.fr.WithSpan(context.Background())
+			fs.Incr("lenient_start")
+			fs.Warn("lenient_start", "config file is missing, starting with no configs", obs.Vals{
+				"path": sm.filePath,
+			})
+		}
+	}
+	if err := sm.watcher.StartLenient(); err != nil {
+		// the configs are served, they are only not reloaded
+		sm.fr.WithSpan(context.Background()).Warn("error_watching", "could not watch the directory of the config file", obs.Vals{
+			"path": sm.filePath,
+		}.WithError(err))
+	}
+	return nil
+}
+
+// current returns the State served, nil before the initial load
+func (sm *stateManager) current() *State {
+	State, _ := sm.state.Load().(*State)
+	return State
+}
+
+func (sm *stateManager) GetParsedValue(cfg *Config) interface{} {
+	return sm.current().parsedValue(cfg)
 }
 
 func (sm *stateManager) SetParsedValue(cfg *Config, val interface{}) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	cfg.parsedValue = val
+	sm.current().setParsedValue(cfg, val)
 }
 
-func (sm *stateManager) loadConfig(filePath string) error {
+func (sm *stateManager) loadConfig(filePath string) (err error) {
+	sm.loadMu.Lock()
+	defer sm.loadMu.Unlock()
 	defer sm.cond.Broadcast()
+	defer sm.startLoad(context.Background())(&err)
+
+	changed, err := sm.loadFile(filePath)
+	if err != nil {
+		sm.mu.Lock()
+		loaded := sm.current() != nil
+		if !loaded {
+			sm.initErr = err
+		}
+		sm.mu.Unlock()
+		if !loaded && sm.lastKnownGood != "" {
+			sm.loadLastKnownGood()
+		}
+		return err
+	}
+	if changed && sm.lastKnownGood != "" {
+		if err := sm.saveLastKnownGood(); err != nil {
+			fs := sm.fr.WithSpan(context.Background())
+			fs.Incr("error_last_known_good")
+			fs.Warn("error_last_known_good", "could not save the last known good configs", obs.Vals{
+				"path": sm.lastKnownGood,
+			}.WithError(err))
+		}
+	}
+	return nil
+}
+
+// clk returns the clock of WithClock or the real one
+func (sm *stateManager) clk() clock.Clock {
+	if sm.clock == nil {
+		return clock.Real
+	}
+	return sm.clock
+}
+
+// reportLoad passes the result of a load to the WithOnLoad funcs
+func (sm *stateManager) reportLoad(err error) {
+	if sm.onLoad != nil {
+		sm.onLoad(sm.filePath, err)
+	}
+}
+
+// startLoad calls the WithLoadTrace func and returns the func
+// to defer with the error of the load, which ends the trace and
+// reports the load unless ctx is done, i.e. the load was canceled
+func (sm *stateManager) startLoad(ctx context.Context) func(err *error) {
+	var end func(err error)
+	if sm.traceLoad != nil {
+		end = sm.traceLoad(sm.filePath)
+	}
+	return func(err *error) {
+		if end != nil {
+			end(*err)
+		}
+		if ctx.Err() == nil {
+			sm.reportLoad(*err)
+		}
+	}
+}
 
-	data, err := ioutil.ReadFile(filePath)
+// loadFile loads the configs in filePath, unless the file did not
+// change since the last load, and returns whether they were loaded
+func (sm *stateManager) loadFile(filePath string) (bool, error) {
+	raw, err := readFile(filePath)
+	missing := err != nil && sm.optional && os.IsNotExist(err)
+	if err != nil && !missing {
+		return false, obserr.Annotate(err, "Error reading the config file").Set("path", filePath)
+	}
+	hash := sha256.Sum256(raw)
+	sm.mu.RLock()
+	unchanged := sm.lastHash != nil && *sm.lastHash == hash
+	sm.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	data := raw
+	parse := parseState
+	if isYAML(filePath) {
+		parse = parseYAMLState
+	} else if isProperties(filePath) {
+		parse = parsePropertiesState
+	} else if sm.jsonc {
+		data = stripJSONC(data)
+	}
+	if sm.partialLoad && !isYAML(filePath) && !isProperties(filePath) {
+		parse = sm.parsePartialState
+	}
+	if missing {
+		// the optional file was removed, its configs are dropped
+		parse = parseMissing
+	}
+	State, err := parse(data)
 	if err != nil {
-		return obserr.Annotate(err, "Error reading the config file").Set("path", filePath)
+		return false, obserr.Annotate(err, "error unmarshal the State").Set("path", filePath)
 	}
+	if err := sm.loadState(State); err != nil {
+		return false, err
+	}
+	sm.mu.Lock()
+	sm.lastHash = &hash
+	sm.mu.Unlock()
+	return true, nil
+}
+
+// parseMissing returns the empty State of a missing optional file
+func parseMissing([]byte) (*State, error) {
+	return &State{cache: make(map[string]*Config)}, nil
+}
+
+// parseState parses the contents of a configs.json file: either
+// a list of Config or an object mapping the keys to their values
+func parseState(data []byte) (*State, error) {
 	State := &State{
 		cache: make(map[string]*Config),
 	}
-	if err := json.Unmarshal(data, &(State.Configs)); err != nil {
-		return obserr.Annotate(err, "error json unmarshal the State").Set("path", filePath)
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		if err := json.Unmarshal(data, &(State.Configs)); err != nil {
+			return nil, err
+		}
+		return State, nil
 	}
-	return sm.loadState(State)
+
+	// the object is streamed rather than unmarshalled
+	// into a map to keep the duplicate keys
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+		State.Configs = append(State.Configs, &Config{Key: tok.(string), RawValue: val})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid data after the configs object")
+	}
+	// stable to keep the order of the duplicate keys
+	sort.SliceStable(State.Configs, func(i, j int) bool {
+		return State.Configs[i].Key < State.Configs[j].Key
+	})
+	return State, nil
 }
 
 func (sm *stateManager) loadState(State *State) error {
+	_, err := sm.swapState(State)
+	return err
+}
+
+// swapState is loadState returning the keys whose invalid
+// values were not loaded. It must be called with loadMu held.
+func (sm *stateManager) swapState(State *State) ([]string, error) {
+	prev := sm.current()
+	// the configs are marked before they are
+	// compared to the ones of the previous State
+	if sm.sensitive {
+		for _, cfg := range State.Configs {
+			cfg.Sensitive = true
+		}
+	}
+	// nothing replaces the loaded configs before
+	// the new ones are fully validated
+	invalid, err := sm.validateState(prev, State)
+	if err != nil {
+		return nil, err
+	}
+	State.reuse(prev)
 	State.buildCache()
+	State.inheritParsed(prev)
 	sm.mu.Lock()
-	sm.State = State
+	old := sm.current()
+	sm.state.Store(State)
 	sm.mu.Unlock()
 	sm.notify()
-	for _, cfg := range State.Configs {
-		sm.emap.Set(cfg.Key, cfg)
+	sm.publishState(old, State)
+	if sm.onStateSize != nil {
+		sm.onStateSize(State.size())
 	}
-	return nil
+	if sm.debounce.window > 0 {
+		sm.debounce.reloaded(sm.clk(), sm.flushReload)
+		return invalid, nil
+	}
+	sm.loadMu.fireAfter(func() { sm.fireReload(old, State) })
+	return invalid, nil
+}
+
+func (sm *stateManager) fireReload(old, new *State) {
+	r := newReload(old, new)
+	sm.logDiff(r.Diff())
+	sm.audit(old, new, r.Diff())
+	sm.listeners.fire(r)
+}
+
+// flushReload notifies the listeners once the
+// debounce window passed without reloads
+func (sm *stateManager) flushReload() {
+	sm.debounce.flushMu.Lock()
+	defer sm.debounce.flushMu.Unlock()
+	old, new, ok := sm.debounce.take(sm.current)
+	if ok {
+		sm.fireReload(old, new)
+	}
+}
+
+func (sm *stateManager) logDiff(d Diff) {
+	if d.Empty() {
+		return
+	}
+	sm.fr.WithSpan(context.Background()).Info("configs reloaded", obs.Vals{
+		"path":    sm.filePath,
+		"added":   changeKeys(d.Added),
+		"removed": changeKeys(d.Removed),
+		"changed": changeKeys(d.Changed),
+	})
 }
 
 func (sm *stateManager) notify() {
@@ -190,13 +1007,47 @@ func (sm *stateManager) notify() {
 }
 
 func (sm *stateManager) GetKey(key string) (*Config, error) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	return sm.State.get(key)
+	return sm.current().get(key)
+}
+
+func (sm *stateManager) Snapshot() StateManager {
+	return &snapshotStateManager{
+		NullStateManager: &NullStateManager{},
+		state:            sm.current(),
+	}
+}
+
+func (sm *stateManager) OnReload(fn func()) func() {
+	return sm.listeners.add(onReload(fn))
+}
+
+func (sm *stateManager) Subscribe(key string, fn func(old, new []byte)) func() {
+	return sm.listeners.add(onKeyChange(key, fn))
+}
+
+func (sm *stateManager) OnDiff(fn func(Diff)) func() {
+	return sm.listeners.add(onDiff(fn))
+}
+
+func (sm *stateManager) Keys() []string {
+	return sm.current().keys()
+}
+
+// Reload reads the file again, without waiting for a file event
+func (sm *stateManager) Reload() error {
+	return sm.loadConfig(sm.filePath)
 }
 
+// Close stops the watcher and waits for the loads and the
+// callbacks in flight. It must not be called from a callback.
 func (sm *stateManager) Close() {
 	if sm.watcher != nil {
 		sm.watcher.Stop()
 	}
+	sm.debounce.stop()
+	// wait for a Reload in flight
+	sm.loadMu.Lock()
+	sm.unpublishExpvar()
+	sm.loadMu.Unlock()
+	sm.listeners.close()
 }
@@ -2,13 +2,15 @@ package model
 
 import (
 	"encoding/json"
-	"expvar"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/mixpanel/configmanager/configmap"
 
@@ -24,40 +26,25 @@ func mkTempDir(t *testing.T) (string, func()) {
 	return name, func() { os.RemoveAll(name) }
 }
 
-func fillRawValues(t *testing.T, persist *State) {
-	for _, cfg := range persist.Configs {
-		data, err := json.Marshal(cfg.parsedValue)
-		assert.NoError(t, err)
-		cfg.RawValue = json.RawMessage(data)
-		cfg.parsedValue = nil
+// parsedConfig returns a config of key whose raw value is val
+func parsedConfig(key string, val interface{}) *Config {
+	data, err := json.Marshal(val)
+	if err != nil {
+		panic(err)
 	}
+	return &Config{Key: key, RawValue: data}
 }
 
 func getMarshalledState(t *testing.T, s *State) ([]byte, error) {
-	persist := &State{Configs: make([]*Config, len(s.Configs))}
-	for i, c := range s.Configs {
-		tmp := *c
-		persist.Configs[i] = &tmp
-	}
-	fillRawValues(t, persist)
-	return json.Marshal(persist.Configs)
+	return json.Marshal(s.Configs)
 }
 
 func TestConfigLoadAndUpdate(t *testing.T) {
 	persist := &State{
 		Configs: []*Config{
-			{
-				Key:         "foo",
-				parsedValue: 1,
-			},
-			{
-				Key:         "bar",
-				parsedValue: 3,
-			},
-			{
-				Key:         "baz",
-				parsedValue: 4,
-			},
+			parsedConfig("foo", 1),
+			parsedConfig("bar", 3),
+			parsedConfig("baz", 4),
 		},
 	}
 	dir, done := mkTempDir(t)
@@ -88,7 +75,7 @@ func TestConfigLoadAndUpdate(t *testing.T) {
 	assertConfigNoError("bar", "3")
 	assertConfigNoError("baz", "4")
 
-	persist.Configs[0].parsedValue = 2
+	persist.Configs[0] = parsedConfig("foo", 2)
 	persist.Configs = persist.Configs[:len(persist.Configs)-1]
 	data, err = getMarshalledState(t, persist)
 	require.NoError(t, err)
@@ -101,14 +88,18 @@ func TestConfigLoadAndUpdate(t *testing.T) {
 	assert.Equal(t, err, ErrNotFound)
 }
 
-func newStateManagerForTest(t *testing.T, root, scope string, ch chan struct{}) *stateManager {
+func newStateManagerForTest(t *testing.T, root, scope string, ch chan struct{}, opts ...Option) *stateManager {
 	sm := &stateManager{
 		filePath: path.Join(root, scope, "configs.json"),
-		emap:     expvar.NewMap(fmt.Sprintf("configmanager.%s.%s", root, scope)),
 	}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	sm.publishExpvar(fmt.Sprintf("configmanager.%s.%s", root, scope))
 
 	w, err := configmap.NewCmWatcherForTest(sm.filePath, sm.loadConfig, obs.NullFR)
 	require.NoError(t, err)
+	w.ResyncInterval = sm.resyncInterval
 	sm.watcher = w
 
 	require.NoError(t, sm.init(obs.NullFR))
@@ -128,3 +119,348 @@ func safeWriteFile(t *testing.T, destPath, contents string) {
 	require.NoError(t, tf.Close())
 	require.NoError(t, os.Rename(tf.Name(), destPath))
 }
+
+func TestOnReload(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "test"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 1}]`)
+
+	sm := newStateManagerForTest(t, dir, ns, nil)
+	defer sm.Close()
+	sm.watcher.NotifyCounter.Wait(1)
+
+	seen := make(chan string, 100)
+	cancel := sm.OnReload(func() {
+		cfg, err := sm.GetKey("foo")
+		require.NoError(t, err)
+		seen <- cfg.String()
+	})
+
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 2}]`)
+	assert.Equal(t, "2", <-seen)
+
+	cancel()
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 3}]`)
+	for {
+		cfg, err := sm.GetKey("foo")
+		require.NoError(t, err)
+		if cfg.String() == "3" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(seen)
+	for v := range seen {
+		assert.Equal(t, "2", v, "listener should not be called after cancel")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "test"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 1}, {"key": "bar", "value": 2}]`)
+
+	sm := newStateManagerForTest(t, dir, ns, nil)
+	defer sm.Close()
+	sm.watcher.NotifyCounter.Wait(1)
+
+	snap := sm.Snapshot()
+	reloaded := make(chan struct{}, 10)
+	defer sm.OnReload(func() { reloaded <- struct{}{} })()
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 3}]`)
+	for len(sm.Keys()) != 1 {
+		<-reloaded
+	}
+
+	cfg, err := snap.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfg.String())
+	assert.Equal(t, []string{"bar", "foo"}, snap.Keys())
+
+	cfg, err = sm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "3", cfg.String())
+	assert.Equal(t, []string{"foo"}, sm.Keys())
+}
+
+func TestSubscribe(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "test"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 1}, {"key": "bar", "value": 2}]`)
+
+	sm := newStateManagerForTest(t, dir, ns, nil)
+	defer sm.Close()
+	sm.watcher.NotifyCounter.Wait(1)
+
+	changes := make(chan [2]string, 10)
+	defer sm.Subscribe("bar", func(old, new []byte) {
+		changes <- [2]string{string(old), string(new)}
+	})()
+
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 3}, {"key": "bar", "value": 2}]`)
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 3}]`)
+	assert.Equal(t, [2]string{"2", ""}, <-changes)
+	assert.Len(t, changes, 0)
+}
+
+func TestDebounce(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "test"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 1}]`)
+
+	sm := newStateManagerForTest(t, dir, ns, nil, WithDebounce(200*time.Millisecond))
+	defer sm.Close()
+
+	diffs := make(chan Diff, 10)
+	defer sm.OnDiff(func(d Diff) { diffs <- d })()
+	// the initial load is delivered after the window too
+	d := <-diffs
+	require.Len(t, d.Added, 1)
+
+	for i := 2; i <= 4; i++ {
+		safeWriteFile(t, filePath, fmt.Sprintf(`[{"key": "foo", "value": %d}]`, i))
+	}
+	d = <-diffs
+	assert.Equal(t, []KeyChange{{
+		Key: "foo",
+		Old: json.RawMessage("1"),
+		New: json.RawMessage("4"),
+	}}, d.Changed)
+
+	time.Sleep(400 * time.Millisecond)
+	assert.Len(t, diffs, 0)
+}
+
+func TestLayeredStateManager(t *testing.T) {
+	base := NewDummyStateManager()
+	base.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("1")})
+	base.SetConfig(&Config{Key: "bar", RawValue: json.RawMessage("2")})
+	top := NewDummyStateManager()
+
+	lsm := newLayeredStateManager([]StateManager{base, top})
+	defer lsm.Close()
+
+	var changes []string
+	defer lsm.Subscribe("foo", func(old, new []byte) {
+		changes = append(changes, string(new))
+	})()
+
+	top.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("3")})
+	cfg, err := lsm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "3", cfg.String())
+
+	// shadowed changes are not visible
+	base.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("4")})
+	cfg, err = lsm.GetKey("bar")
+	require.NoError(t, err)
+	assert.Equal(t, "2", cfg.String())
+
+	assert.Equal(t, []string{"3"}, changes)
+	assert.Equal(t, []string{"bar", "foo"}, lsm.Keys())
+}
+
+func TestCompositeStateManager(t *testing.T) {
+	flags := NewDummyStateManager()
+	flags.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("1")})
+	static := NewDummyStateManager()
+	static.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("2")})
+	static.SetConfig(&Config{Key: "bar", RawValue: json.RawMessage("3")})
+
+	csm := NewCompositeStateManager(flags, static)
+	defer csm.Close()
+
+	cfg, err := csm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfg.String())
+	cfg, err = csm.GetKey("bar")
+	require.NoError(t, err)
+	assert.Equal(t, "3", cfg.String())
+
+	var changes []string
+	defer csm.Subscribe("bar", func(old, new []byte) {
+		changes = append(changes, string(new))
+	})()
+	flags.SetConfig(&Config{Key: "bar", RawValue: json.RawMessage("4")})
+	assert.Equal(t, []string{"4"}, changes)
+}
+
+func TestSensitive(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "sensitive"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `[{"key": "password", "value": "hunter2", "sensitive": true}, {"key": "port", "value": 5432}]`)
+
+	sm := newStateManagerForTest(t, dir, ns, nil)
+	defer sm.Close()
+	sm.watcher.NotifyCounter.Wait(1)
+
+	cfg, err := sm.GetKey("password")
+	require.NoError(t, err)
+	assert.Equal(t, `"hunter2"`, cfg.String())
+	assert.Equal(t, `"<redacted>"`, sm.emap.Get("password").String())
+	assert.Equal(t, "5432", sm.emap.Get("port").String())
+
+	// whole scopes can be sensitive
+	ns = "secret"
+	safeWriteFile(t, path.Join(dir, ns, "configs.json"), `[{"key": "port", "value": 5432}]`)
+	sm = newStateManagerForTest(t, dir, ns, nil, WithSensitive())
+	defer sm.Close()
+	sm.watcher.NotifyCounter.Wait(1)
+	assert.Equal(t, `"<redacted>"`, sm.emap.Get("port").String())
+}
+
+func TestParseStateObject(t *testing.T) {
+	State, err := parseState([]byte(` {"timeout_secs": 5, "whitelist": {"123": {}}}`))
+	require.NoError(t, err)
+	State.buildCache()
+	assert.Equal(t, []string{"timeout_secs", "whitelist"}, State.keys())
+	assert.Equal(t, `{"123": {}}`, string(State.raw("whitelist")))
+
+	State, err = parseState([]byte(`[{"key": "timeout_secs", "value": 5}]`))
+	require.NoError(t, err)
+	State.buildCache()
+	assert.Equal(t, "5", string(State.raw("timeout_secs")))
+}
+
+func TestLenientStart(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	require.NoError(t, os.MkdirAll(path.Join(dir, "strict"), 0700))
+	_, err := NewStateManager(dir, "strict", nil, obs.NullFR)
+	require.Error(t, err)
+
+	ns := "lenient"
+	require.NoError(t, os.MkdirAll(path.Join(dir, ns), 0700))
+
+	sm, err := NewStateManager(dir, ns, nil, obs.NullFR, WithLenientStart())
+	require.NoError(t, err)
+	defer sm.Close()
+	_, err = sm.GetKey("foo")
+	assert.Equal(t, ErrNotFound, err)
+
+	reloaded := make(chan struct{}, 10)
+	sm.OnReload(func() { reloaded <- struct{}{} })
+	safeWriteFile(t, path.Join(dir, ns, "configs.json"), `[{"key": "foo", "value": 1}]`)
+	<-reloaded
+	cfg, err := sm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfg.String())
+
+	safeWriteFile(t, path.Join(dir, ns, "configs.json"), `[{"key": "foo", "value": 2}]`)
+	<-reloaded
+	cfg, err = sm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "2", cfg.String())
+}
+
+func TestStartupTimeout(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "startup_timeout"
+	safeWriteFile(t, path.Join(dir, ns, "configs.json"), `[{"key": "foo", "val`)
+
+	start := time.Now()
+	_, err := NewStateManager(dir, ns, nil, obs.NullFR, WithStartupTimeout(50*time.Millisecond))
+	require.Error(t, err)
+	assert.True(t, time.Since(start) < DefaultStartupTimeout)
+}
+
+func TestResync(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "resync"
+	safeWriteFile(t, path.Join(dir, ns, "configs.json"), `[{"key": "foo", "value": 1}]`)
+
+	sm := newStateManagerForTest(t, dir, ns, nil, WithResyncInterval(5*time.Millisecond))
+	defer sm.Close()
+	var reloads int32
+	sm.OnReload(func() { atomic.AddInt32(&reloads, 1) })
+
+	// the file is re-read without events but not reloaded
+	sm.watcher.NotifyCounter.Wait(5)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&reloads))
+}
+
+func TestConfigScalarCache(t *testing.T) {
+	cfg := &Config{Key: "foo", RawValue: []byte("1")}
+	_, ok := cfg.CachedInt64()
+	assert.False(t, ok)
+	assert.Nil(t, cfg.CachedScalar())
+
+	cfg.CacheInt64(1)
+	val, ok := cfg.CachedInt64()
+	assert.True(t, ok)
+	assert.EqualValues(t, 1, val)
+	assert.Equal(t, int64(1), cfg.CachedScalar())
+
+	// the value is cached for one type only
+	_, ok = cfg.CachedFloat64()
+	assert.False(t, ok)
+	cfg.CacheFloat64(1)
+	f, ok := cfg.CachedFloat64()
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, f)
+	_, ok = cfg.CachedInt64()
+	assert.False(t, ok)
+}
+
+func TestParsedValuesPerState(t *testing.T) {
+	dm := NewDummyStateManager()
+	dm.SetConfig(parsedConfig("foo", 1))
+	dm.SetConfig(parsedConfig("bar", 2))
+	sm := NewLayeredStateManager(dm)
+	defer sm.Close()
+
+	foo, err := sm.GetKey("foo")
+	require.NoError(t, err)
+	bar, err := sm.GetKey("bar")
+	require.NoError(t, err)
+	sm.SetParsedValue(foo, int64(1))
+	sm.SetParsedValue(bar, int64(2))
+	snap := sm.Snapshot()
+	assert.Equal(t, int64(1), snap.GetParsedValue(foo))
+
+	// the unchanged configs keep their parsed values
+	dm.SetConfig(parsedConfig("foo", 3))
+	assert.Nil(t, sm.GetParsedValue(foo))
+	assert.Equal(t, int64(2), sm.GetParsedValue(bar))
+	// the values parsed from the old configs are dropped
+	sm.SetParsedValue(foo, int64(1))
+	newFoo, err := sm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Nil(t, sm.GetParsedValue(newFoo))
+	// the snapshots keep their State
+	assert.Equal(t, int64(1), snap.GetParsedValue(foo))
+
+	// concurrent reads, parses and reloads, for -race
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cfg, err := sm.GetKey("foo")
+				if err != nil {
+					continue
+				}
+				if sm.GetParsedValue(cfg) == nil {
+					sm.SetParsedValue(cfg, j)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		dm.SetConfig(parsedConfig("foo", i))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,51 @@
+package model
+
+// observedStateManager calls a function on every GetKey
+type observedStateManager struct {
+	StateManager
+	onGet func(key string, cfg *Config, err error)
+}
+
+// NewObservedStateManager returns a view of base calling onGet with
+// the result of every GetKey, e.g. to report the reads of deprecated
+// keys. onGet is called on the hot path and must be cheap. Closing
+// the view closes base.
+func NewObservedStateManager(base StateManager, onGet func(key string, cfg *Config, err error)) StateManager {
+	return &observedStateManager{
+		StateManager: base,
+		onGet:        onGet,
+	}
+}
+
+// unobservedGetter is implemented by the observed StateManagers
+// and by the views that may be layered on top of them
+type unobservedGetter interface {
+	getKeyUnobserved(key string) (*Config, error)
+}
+
+// GetKeyUnobserved is sm.GetKey without calling the onGet of the
+// observed StateManagers of sm, e.g. for the lookups of a client
+// that are not reads of its caller
+func GetKeyUnobserved(sm StateManager, key string) (*Config, error) {
+	if u, ok := sm.(unobservedGetter); ok {
+		return u.getKeyUnobserved(key)
+	}
+	return sm.GetKey(key)
+}
+
+func (o *observedStateManager) getKeyUnobserved(key string) (*Config, error) {
+	return GetKeyUnobserved(o.StateManager, key)
+}
+
+func (o *observedStateManager) GetKey(key string) (*Config, error) {
+	cfg, err := o.StateManager.GetKey(key)
+	o.onGet(key, cfg, err)
+	return cfg, err
+}
+
+func (o *observedStateManager) Snapshot() StateManager {
+	return &observedStateManager{
+		StateManager: o.StateManager.Snapshot(),
+		onGet:        o.onGet,
+	}
+}
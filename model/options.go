@@ -0,0 +1,191 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+)
+
+// OverridesFileName is the file in the scope directory
+// read by WithOverridesFile when no path is given
+const OverridesFileName = "overrides.json"
+
+// DefaultsFileName is the file in the scope directory holding
+// the default values of the keys, shadowed by configs.json
+const DefaultsFileName = "defaults.json"
+
+// FragmentsDirName is the directory in the scope directory
+// holding config fragments merged on top of configs.json
+const FragmentsDirName = "configs.d"
+
+// DefaultStartupTimeout bounds the wait for the initial
+// load of the configs when creating the StateManager
+const DefaultStartupTimeout = time.Minute
+
+// Option configures optional behaviour of the StateManager
+type Option func(*stateManager)
+
+// optionsOf returns a stateManager with opts applied,
+// to read the options before creating the StateManager
+func optionsOf(opts []Option) *stateManager {
+	sm := &stateManager{}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	return sm
+}
+
+// WithDebounce delays reload notifications until no reload
+// happened for window, so that a burst of file events results
+// in a single notification with the final State. Reads always
+// see the latest State right away.
+func WithDebounce(window time.Duration) Option {
+	return func(sm *stateManager) {
+		sm.debounce.window = window
+	}
+}
+
+// WithOverridesFile layers the configs of the file at filePath on top of
+// configs.json: keys in the overrides file shadow the same keys in
+// configs.json. The file has the same format as configs.json and is
+// watched independently. An empty filePath uses overrides.json in
+// the scope directory. The directory of the file must exist, the file
+// may be missing: it is loaded once created and its configs are
+// dropped once it is removed.
+func WithOverridesFile(filePath string) Option {
+	return func(sm *stateManager) {
+		sm.overrides = true
+		sm.overridesPath = filePath
+	}
+}
+
+// WithEnvironment layers the configs of configs.<environment>.json
+// in the scope directory on top of configs.json, so that only the keys
+// that differ per environment have to be rendered per environment.
+// The overlay is optional and is only watched if it exists when the
+// StateManager is created.
+func WithEnvironment(environment string) Option {
+	return func(sm *stateManager) {
+		sm.environment = environment
+	}
+}
+
+// WithLenientStart starts with an empty State when the file is missing
+// instead of failing, e.g. when a sidecar writes the configmap after the
+// service started, and loads the file as soon as it is created. The
+// directory of the file must exist.
+func WithLenientStart() Option {
+	return func(sm *stateManager) {
+		sm.lenientStart = true
+	}
+}
+
+// WithStartupTimeout bounds the wait for the initial load of the
+// configs, DefaultStartupTimeout by default. The StateManager is not
+// created if the configs can not be loaded in time, e.g. because the
+// file is invalid. A timeout of 0 waits until the configs are loaded.
+func WithStartupTimeout(timeout time.Duration) Option {
+	return func(sm *stateManager) {
+		sm.startupTimeout = timeout
+	}
+}
+
+// WithStartupContext stops waiting for the initial load of the
+// configs when ctx is done, in addition to the startup timeout
+func WithStartupContext(ctx context.Context) Option {
+	return func(sm *stateManager) {
+		sm.startupCtx = ctx
+	}
+}
+
+// WithResyncInterval re-reads the files every interval even without
+// file events, in case events are missed, e.g. when inotify runs out of
+// watches. The configs are only reloaded if the content of a file changed.
+func WithResyncInterval(interval time.Duration) Option {
+	return func(sm *stateManager) {
+		sm.resyncInterval = interval
+	}
+}
+
+// WithOnLoad calls fn with the result of every load of the configs
+// from their source, nil when the configs were loaded or did not
+// change, e.g. to export the time of the last successful load. fn
+// is called after the funcs of the previous WithOnLoad options.
+func WithOnLoad(fn func(err error)) Option {
+	return WithOnSourceLoad(func(source string, err error) {
+		fn(err)
+	})
+}
+
+// WithOnSourceLoad is WithOnLoad with the source of the load, e.g. the
+// path of the file, since the layers of a StateManager, like the
+// overrides file, are loaded independently.
+func WithOnSourceLoad(fn func(source string, err error)) Option {
+	return func(sm *stateManager) {
+		prev := sm.onLoad
+		if prev == nil {
+			sm.onLoad = fn
+			return
+		}
+		sm.onLoad = func(source string, err error) {
+			prev(source, err)
+			fn(source, err)
+		}
+	}
+}
+
+// WithClock makes the StateManager use clk instead of the time package
+// for the resyncs of WithResyncInterval, the debouncing of WithDebounce,
+// the polls and rewatches of the remote sources and the times of the
+// audit log, e.g. to test them with a clock.Fake. The retries of the
+// reads of the files use the time package.
+func WithClock(clk clock.Clock) Option {
+	return func(sm *stateManager) {
+		sm.clock = clk
+	}
+}
+
+// WithOnStateSize calls fn with the size in bytes of the keys and the
+// values of the configs after every load that changed them, e.g. to
+// export the memory held by scopes with large configs
+func WithOnStateSize(fn func(bytes int64)) Option {
+	return func(sm *stateManager) {
+		sm.onStateSize = fn
+	}
+}
+
+// WithLoadTrace calls start with the path of the source before every
+// load of the configs, and the func it returns with the result of the
+// load, e.g. to trace the loads. The funcs of the previous WithLoadTrace
+// options are not called.
+func WithLoadTrace(start func(source string) (end func(err error))) Option {
+	return func(sm *stateManager) {
+		sm.traceLoad = start
+	}
+}
+
+// WithSensitive marks all the configs as Sensitive, e.g.
+// for a scope mounted from a Kubernetes Secret
+func WithSensitive() Option {
+	return func(sm *stateManager) {
+		sm.sensitive = true
+	}
+}
+
+// WithJSONC allows comments and trailing commas in the json files,
+// so that hand-edited files such as overrides can explain their keys
+func WithJSONC() Option {
+	return func(sm *stateManager) {
+		sm.jsonc = true
+	}
+}
+
+// WithSchema validates every load of configs.json against the
+// Schema returned by loader for the scope directory. Configs that do
+// not match the schema are not loaded: the previous configs are kept.
+func WithSchema(loader SchemaLoader) Option {
+	return func(sm *stateManager) {
+		sm.schemaLoader = loader
+	}
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// overrideStateManager shadows the configs of base with a fixed set
+// of values that never change, e.g. from the environment or from the
+// command line. name maps a key to the name it is overridden by.
+type overrideStateManager struct {
+	StateManager
+	overrides map[string]*Config
+	name      func(key string) string
+	// state holds the overrides by name so that the values parsed
+	// from them are kept, base only keeps the ones of its configs
+	state *State
+	// listed is true when the names of the overrides are keys
+	// that can be listed by Keys
+	listed bool
+}
+
+// NewOverrideStateManager returns a StateManager where the values of
+// overrides take precedence over the configs of base. Values that are
+// valid JSON are used as is and any other value is used as a JSON string.
+func NewOverrideStateManager(base StateManager, overrides map[string]string) StateManager {
+	raw := make(map[string]json.RawMessage, len(overrides))
+	for key, val := range overrides {
+		raw[key] = overrideValue(val)
+	}
+	return NewRawOverrideStateManager(base, raw)
+}
+
+// NewRawOverrideStateManager is NewOverrideStateManager
+// for values that are already JSON
+func NewRawOverrideStateManager(base StateManager, overrides map[string]json.RawMessage) StateManager {
+	osm := &overrideStateManager{
+		StateManager: base,
+		overrides:    make(map[string]*Config),
+		name:         func(key string) string { return key },
+		listed:       true,
+	}
+	for key, raw := range overrides {
+		osm.overrides[key] = &Config{Key: key, RawValue: raw}
+	}
+	osm.buildState()
+	return osm
+}
+
+// NewEnvStateManager returns a StateManager where environment variables
+// like CONFIGMANAGER_MY_SERVICE_TIMEOUT_SECS, for a prefix of
+// CONFIGMANAGER_, a scope of my-service and a key of timeout_secs, take
+// precedence over the configs of base. The scope and the key are upper
+// cased and every character that is not a letter or a digit is replaced
+// by an underscore. Values are read like in NewOverrideStateManager.
+// The environment is read once when the StateManager is created.
+// Keys only lists the keys of base: a variable for a key that is
+// missing from base can be read but is not listed.
+func NewEnvStateManager(base StateManager, prefix string, scope string) StateManager {
+	return newEnvStateManager(base, prefix, scope, os.Environ())
+}
+
+func newEnvStateManager(base StateManager, prefix string, scope string, environ []string) *overrideStateManager {
+	envPrefix := prefix + EnvName(scope) + "_"
+	osm := &overrideStateManager{
+		StateManager: base,
+		overrides:    make(map[string]*Config),
+		name:         EnvName,
+	}
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], envPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(parts[0], envPrefix)
+		osm.overrides[name] = &Config{Key: name, RawValue: overrideValue(parts[1])}
+	}
+	osm.buildState()
+	return osm
+}
+
+func (o *overrideStateManager) buildState() {
+	o.state = &State{}
+	for _, cfg := range o.overrides {
+		o.state.Configs = append(o.state.Configs, cfg)
+	}
+	o.state.buildCache()
+}
+
+// EnvName is how scopes and keys are spelled in
+// environment variable names
+func EnvName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return '_'
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+func overrideValue(val string) json.RawMessage {
+	raw := json.RawMessage(val)
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(val)
+	}
+	return raw
+}
+
+func (o *overrideStateManager) override(key string) (*Config, bool) {
+	cfg, ok := o.overrides[o.name(key)]
+	return cfg, ok
+}
+
+func (o *overrideStateManager) GetKey(key string) (*Config, error) {
+	if cfg, ok := o.override(key); ok {
+		return cfg, nil
+	}
+	return o.StateManager.GetKey(key)
+}
+
+func (o *overrideStateManager) getKeyUnobserved(key string) (*Config, error) {
+	if cfg, ok := o.override(key); ok {
+		return cfg, nil
+	}
+	return GetKeyUnobserved(o.StateManager, key)
+}
+
+// isOverride returns true if cfg is one of the overrides
+func (o *overrideStateManager) isOverride(cfg *Config) bool {
+	override, ok := o.state.lookup(cfg.Key)
+	return ok && override == cfg
+}
+
+func (o *overrideStateManager) GetParsedValue(cfg *Config) interface{} {
+	if o.isOverride(cfg) {
+		return o.state.parsedValue(cfg)
+	}
+	return o.StateManager.GetParsedValue(cfg)
+}
+
+func (o *overrideStateManager) SetParsedValue(cfg *Config, val interface{}) {
+	if o.isOverride(cfg) {
+		o.state.setParsedValue(cfg, val)
+		return
+	}
+	o.StateManager.SetParsedValue(cfg, val)
+}
+
+func (o *overrideStateManager) Keys() []string {
+	keys := o.StateManager.Keys()
+	if !o.listed {
+		return keys
+	}
+	for key := range o.overrides {
+		if _, err := o.StateManager.GetKey(key); err != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (o *overrideStateManager) Snapshot() StateManager {
+	snap := *o
+	snap.StateManager = o.StateManager.Snapshot()
+	return &snap
+}
+
+// Subscribe does not call fn for overridden
+// keys since they never change
+func (o *overrideStateManager) Subscribe(key string, fn func(old, new []byte)) func() {
+	if _, ok := o.override(key); ok {
+		return func() {}
+	}
+	return o.StateManager.Subscribe(key, fn)
+}
+
+func (o *overrideStateManager) OnDiff(fn func(Diff)) func() {
+	return o.StateManager.OnDiff(func(d Diff) {
+		d = Diff{
+			Added:   o.notOverridden(d.Added),
+			Removed: o.notOverridden(d.Removed),
+			Changed: o.notOverridden(d.Changed),
+		}
+		if !d.Empty() {
+			fn(d)
+		}
+	})
+}
+
+func (o *overrideStateManager) notOverridden(changes []KeyChange) []KeyChange {
+	var res []KeyChange
+	for _, c := range changes {
+		if _, ok := o.override(c.Key); !ok {
+			res = append(res, c)
+		}
+	}
+	return res
+}
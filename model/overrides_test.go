@@ -0,0 +1,87 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvStateManager(t *testing.T) {
+	base := NewDummyStateManager()
+	base.SetConfig(&Config{Key: "timeout_secs", RawValue: json.RawMessage("5")})
+	base.SetConfig(&Config{Key: "region", RawValue: json.RawMessage(`"us"`)})
+
+	esm := newEnvStateManager(base, "CONFIGMANAGER_", "my-service", []string{
+		"CONFIGMANAGER_MY_SERVICE_TIMEOUT_SECS=10",
+		"CONFIGMANAGER_MY_SERVICE_FEATURE_ENABLED=true",
+		"CONFIGMANAGER_MY_SERVICE_NAME=hello",
+		"CONFIGMANAGER_OTHER_REGION=eu",
+		"PATH=/bin",
+	})
+
+	assertRaw := func(key, expected string) {
+		cfg, err := esm.GetKey(key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, cfg.String())
+	}
+	assertRaw("timeout_secs", "10")
+	assertRaw("feature-enabled", "true")
+	assertRaw("name", `"hello"`)
+	assertRaw("region", `"us"`)
+
+	var changed []string
+	defer esm.Subscribe("timeout_secs", func(_, new []byte) {
+		changed = append(changed, string(new))
+	})()
+	base.SetConfig(&Config{Key: "timeout_secs", RawValue: json.RawMessage("6")})
+	assert.Empty(t, changed)
+	assertRaw("timeout_secs", "10")
+}
+
+func TestOverrideStateManager(t *testing.T) {
+	base := NewDummyStateManager()
+	base.SetConfig(&Config{Key: "foo", RawValue: json.RawMessage("1")})
+
+	osm := NewOverrideStateManager(base, map[string]string{
+		"foo": "2",
+		"bar": "baz",
+	})
+	cfg, err := osm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "2", cfg.String())
+	cfg, err = osm.GetKey("bar")
+	require.NoError(t, err)
+	assert.Equal(t, `"baz"`, cfg.String())
+	assert.Equal(t, []string{"bar", "foo"}, osm.Keys())
+}
+
+func TestOverrideStateManagerParsedValues(t *testing.T) {
+	base := NewMemoryStateManager("overrides_parsed", []*Config{
+		{Key: "foo", RawValue: json.RawMessage("1")},
+		{Key: "bar", RawValue: json.RawMessage("2")},
+	}, obs.NullFR, WithoutExpvar())
+	defer base.Close()
+
+	for _, osm := range []StateManager{
+		NewOverrideStateManager(base, map[string]string{"foo": "3"}),
+		newEnvStateManager(base, "CONFIGMANAGER_", "my-service", []string{
+			"CONFIGMANAGER_MY_SERVICE_FOO=3",
+		}),
+	} {
+		override, err := osm.GetKey("foo")
+		require.NoError(t, err)
+		osm.SetParsedValue(override, 3)
+		assert.Equal(t, 3, osm.GetParsedValue(override))
+		assert.Equal(t, 3, osm.Snapshot().GetParsedValue(override))
+
+		cfg, err := osm.GetKey("bar")
+		require.NoError(t, err)
+		osm.SetParsedValue(cfg, 2)
+		assert.Equal(t, 2, osm.GetParsedValue(cfg))
+		assert.Equal(t, 2, base.GetParsedValue(cfg))
+	}
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// ErrInvalidEntry is reported for the entries of the
+// configs skipped with WithPartialLoad
+var ErrInvalidEntry = errors.New("invalid config entry")
+
+// WithPartialLoad loads the valid entries of a configs.json list when
+// some entries can not be unmarshalled or have no key, instead of not
+// loading the file, so that a typo in one config does not keep the
+// others of a shared scope from loading. The skipped entries are counted
+// in the invalid_entry metric, logged and passed to onInvalid, if not nil.
+// The file must still be valid JSON.
+func WithPartialLoad(onInvalid func(err error)) Option {
+	return func(sm *stateManager) {
+		sm.partialLoad = true
+		sm.onInvalidEntry = onInvalid
+	}
+}
+
+// parsePartialState is parseState, skipping the
+// invalid entries of the list form
+func (sm *stateManager) parsePartialState(data []byte) (*State, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '[' {
+		return parseState(data)
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	State := &State{
+		cache:   make(map[string]*Config),
+		Configs: make([]*Config, 0, len(entries)),
+	}
+	for i, entry := range entries {
+		cfg := &Config{}
+		err := json.Unmarshal(entry, cfg)
+		if err == nil && cfg.Key == "" {
+			err = ErrInvalidEntry
+		}
+		if err != nil {
+			sm.reportInvalidEntry(i, cfg, err)
+			continue
+		}
+		State.Configs = append(State.Configs, cfg)
+	}
+	return State, nil
+}
+
+// reportInvalidEntry reports the entry at index i
+// of the configs, skipped by parsePartialState
+func (sm *stateManager) reportInvalidEntry(i int, cfg *Config, err error) {
+	fs := sm.fr.WithSpan(context.Background())
+	fs.Incr("invalid_entry")
+	fs.Warn("invalid_entry", "invalid config entry, loading the other configs", obs.Vals{
+		"path":  sm.filePath,
+		"index": i,
+		"key":   cfg.Key,
+	}.WithError(err))
+	if sm.onInvalidEntry != nil {
+		sm.onInvalidEntry(obserr.Annotate(err, "invalid config entry").Set(
+			"path", sm.filePath,
+			"index", i,
+			"key", cfg.Key,
+		))
+	}
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartialLoad(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "partial_load"
+	safeWriteFile(t, path.Join(dir, ns, "configs.json"), `[
+		{"key": "foo", "value": 1},
+		{"key": 2, "value": 2},
+		{"value": 3},
+		"bar",
+		{"key": "baz", "value": 4}
+	]`)
+
+	var invalid []error
+	sm, err := NewStateManager(dir, ns, nil, obs.NullFR, WithPartialLoad(func(err error) {
+		invalid = append(invalid, err)
+	}))
+	require.NoError(t, err)
+	defer sm.Close()
+
+	assert.Equal(t, []string{"baz", "foo"}, sm.Keys())
+	require.Len(t, invalid, 3)
+	assert.Equal(t, ErrInvalidEntry, obserr.Original(invalid[1]))
+}
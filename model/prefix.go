@@ -0,0 +1,78 @@
+package model
+
+import (
+	"strings"
+)
+
+// prefixStateManager is a view of the keys of base starting with
+// prefix, with the prefix trimmed. Closing the view does not close
+// base.
+type prefixStateManager struct {
+	StateManager
+	prefix string
+}
+
+// NewPrefixStateManager returns a view of base where key resolves
+// to prefix+key in base. Close is a no-op on the view.
+func NewPrefixStateManager(base StateManager, prefix string) StateManager {
+	return &prefixStateManager{
+		StateManager: base,
+		prefix:       prefix,
+	}
+}
+
+func (p *prefixStateManager) GetKey(key string) (*Config, error) {
+	return p.StateManager.GetKey(p.prefix + key)
+}
+
+func (p *prefixStateManager) getKeyUnobserved(key string) (*Config, error) {
+	return GetKeyUnobserved(p.StateManager, p.prefix+key)
+}
+
+func (p *prefixStateManager) Keys() []string {
+	var keys []string
+	for _, key := range p.StateManager.Keys() {
+		if strings.HasPrefix(key, p.prefix) {
+			keys = append(keys, strings.TrimPrefix(key, p.prefix))
+		}
+	}
+	return keys
+}
+
+func (p *prefixStateManager) Snapshot() StateManager {
+	return &prefixStateManager{
+		StateManager: p.StateManager.Snapshot(),
+		prefix:       p.prefix,
+	}
+}
+
+func (p *prefixStateManager) Subscribe(key string, fn func(old, new []byte)) func() {
+	return p.StateManager.Subscribe(p.prefix+key, fn)
+}
+
+func (p *prefixStateManager) OnDiff(fn func(Diff)) func() {
+	return p.StateManager.OnDiff(func(d Diff) {
+		d = Diff{
+			Added:   p.trim(d.Added),
+			Removed: p.trim(d.Removed),
+			Changed: p.trim(d.Changed),
+		}
+		if !d.Empty() {
+			fn(d)
+		}
+	})
+}
+
+func (p *prefixStateManager) trim(changes []KeyChange) []KeyChange {
+	var res []KeyChange
+	for _, c := range changes {
+		if strings.HasPrefix(c.Key, p.prefix) {
+			c.Key = strings.TrimPrefix(c.Key, p.prefix)
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func (p *prefixStateManager) Close() {
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PropertiesFileName is loaded when the scope
+	// has neither configs.json nor configs.yaml
+	PropertiesFileName = "configs.properties"
+	// EnvFileName is loaded when the scope has none
+	// of the other config files
+	EnvFileName = "configs.env"
+)
+
+// isProperties returns true if filePath should
+// be parsed with parsePropertiesState
+func isProperties(filePath string) bool {
+	ext := path.Ext(filePath)
+	return ext == ".properties" || ext == ".env"
+}
+
+// parsePropertiesState parses KEY=value lines into string configs.
+// Blank lines and lines starting with # or ! are skipped, a leading
+// export is ignored and quoted values are unquoted.
+func parsePropertiesState(data []byte) (*State, error) {
+	State := &State{
+		cache: make(map[string]*Config),
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNum)
+		}
+		key, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+			unquoted, err := strconv.Unquote(val)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			val = unquoted
+		} else if len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'' {
+			val = val[1 : len(val)-1]
+		}
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		State.Configs = append(State.Configs, &Config{Key: key, RawValue: raw})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return State, nil
+}
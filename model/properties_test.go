@@ -0,0 +1,44 @@
+package model
+
+import (
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePropertiesState(t *testing.T) {
+	State, err := parsePropertiesState([]byte(`
+# legacy service settings
+export DB_HOST=db.internal
+GREETING = "hello\tworld"
+QUOTED='a=b'
+EMPTY=
+`))
+	require.NoError(t, err)
+	State.buildCache()
+	assert.Equal(t, []string{"DB_HOST", "EMPTY", "GREETING", "QUOTED"}, State.keys())
+	assert.Equal(t, `"db.internal"`, string(State.raw("DB_HOST")))
+	assert.Equal(t, `"hello\tworld"`, string(State.raw("GREETING")))
+	assert.Equal(t, `"a=b"`, string(State.raw("QUOTED")))
+	assert.Equal(t, `""`, string(State.raw("EMPTY")))
+
+	_, err = parsePropertiesState([]byte("NOVALUE"))
+	assert.Error(t, err)
+}
+
+func TestPropertiesFile(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	safeWriteFile(t, path.Join(dir, "properties", PropertiesFileName), "timeout_secs=5\n")
+
+	sm, err := NewStateManager(dir, "properties", nil, obs.NullFR)
+	require.NoError(t, err)
+	defer sm.Close()
+	cfg, err := sm.GetKey("timeout_secs")
+	require.NoError(t, err)
+	assert.Equal(t, `"5"`, cfg.String())
+}
@@ -0,0 +1,157 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+const redisResubscribeDelay = time.Second
+
+// RedisClient is the subset of a Redis client used by
+// NewRedisStateManager, so that any client library can be
+// adapted to it
+type RedisClient interface {
+	// HGetAll returns the fields and values of the hash at key
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	// Subscribe calls fn with the payload of every message published
+	// on channel. It blocks until ctx is done or the subscription
+	// fails. subscribed is called once the subscription is active.
+	Subscribe(ctx context.Context, channel string, subscribed func(), fn func(payload string)) error
+}
+
+// RedisKey is the hash holding the configs of scope:
+// the fields are the keys of the configs and the
+// values their JSON values
+func RedisKey(scope string) string {
+	return fmt.Sprintf("configmanager:%s", scope)
+}
+
+// RedisChannel is the channel on which a message
+// is published after the hash of scope changed
+func RedisChannel(scope string) string {
+	return fmt.Sprintf("configmanager:%s:invalidate", scope)
+}
+
+// redisStateManager loads the configs from a Redis hash
+// reloaded on every invalidation message
+type redisStateManager struct {
+	*stateManager
+
+	client       RedisClient
+	key, channel string
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRedisStateManager returns a StateManager loading the configs of
+// scope from the hash at RedisKey(scope) and reloading them every time
+// a message is published on RedisChannel(scope), for sub-second
+// propagation without watching files. The configs are reloaded after
+// every resubscription so invalidations missed meanwhile are not lost.
+func NewRedisStateManager(client RedisClient, scope string, fr obs.FlightRecorder, opts ...Option) (StateManager, error) {
+	rsm := &redisStateManager{
+		stateManager: &stateManager{
+			filePath:   fmt.Sprintf("redis:%s", RedisKey(scope)),
+			updateChan: make(chan struct{}),
+			fr:         fr.ScopeName("redis_state_manager"),
+		},
+		client:  client,
+		key:     RedisKey(scope),
+		channel: RedisChannel(scope),
+	}
+	for _, opt := range opts {
+		opt(rsm.stateManager)
+	}
+	rsm.publishExpvar(fmt.Sprintf("configmanager.%s", scope))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rsm.cancel = cancel
+	if err := rsm.load(ctx); err != nil {
+		cancel()
+		rsm.unpublishExpvar()
+		return nil, obserr.Annotate(err, "NewRedisStateManager: error loading the configs").Set("key", rsm.key)
+	}
+	rsm.wg.Add(1)
+	go func() {
+		defer rsm.wg.Done()
+		rsm.run(ctx)
+	}()
+	return rsm, nil
+}
+
+func (rsm *redisStateManager) load(ctx context.Context) (err error) {
+	rsm.loadMu.Lock()
+	defer rsm.loadMu.Unlock()
+	defer rsm.startLoad(ctx)(&err)
+
+	fields, err := rsm.client.HGetAll(ctx, rsm.key)
+	if err != nil {
+		return obserr.Annotate(err, "Error reading the configs hash").Set("key", rsm.key)
+	}
+	State := &State{
+		cache: make(map[string]*Config),
+	}
+	for key, val := range fields {
+		if !json.Valid([]byte(val)) {
+			rsm.fr.WithSpan(ctx).Warn("invalid_value", "skipping config that is not valid JSON", obs.Vals{
+				"key":       key,
+				"redis_key": rsm.key,
+			})
+			continue
+		}
+		State.Configs = append(State.Configs, &Config{Key: key, RawValue: json.RawMessage(val)})
+	}
+	sort.Slice(State.Configs, func(i, j int) bool {
+		return State.Configs[i].Key < State.Configs[j].Key
+	})
+	return rsm.loadState(State)
+}
+
+// run reloads the configs on every invalidation until ctx is done
+func (rsm *redisStateManager) run(ctx context.Context) {
+	fs := rsm.fr.WithSpan(ctx)
+	reload := func() {
+		if err := rsm.load(ctx); err != nil && ctx.Err() == nil {
+			fs.Warn("error_read", "could not reload the configs", obs.Vals{
+				"key": rsm.key,
+			}.WithError(err))
+		}
+	}
+	for {
+		err := rsm.client.Subscribe(ctx, rsm.channel, reload, func(string) { reload() })
+		if ctx.Err() != nil {
+			return
+		}
+		fs.Warn("error_subscribing", "subscription to the invalidations failed", obs.Vals{
+			"channel": rsm.channel,
+		}.WithError(err))
+		wait, timer := clock.After(rsm.clk(), redisResubscribeDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-wait:
+		}
+	}
+}
+
+// Reload reads the hash again, without waiting for an invalidation
+func (rsm *redisStateManager) Reload() error {
+	return rsm.load(context.Background())
+}
+
+func (rsm *redisStateManager) Close() {
+	rsm.cancel()
+	rsm.wg.Wait()
+	rsm.stateManager.Close()
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRedis struct {
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	messages chan string
+}
+
+func (r *fakeRedis) HGetAll(_ context.Context, key string) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fields := make(map[string]string)
+	for field, val := range r.hashes[key] {
+		fields[field] = val
+	}
+	return fields, nil
+}
+
+func (r *fakeRedis) Subscribe(ctx context.Context, _ string, subscribed func(), fn func(string)) error {
+	subscribed()
+	for {
+		select {
+		case msg := <-r.messages:
+			fn(msg)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *fakeRedis) hset(key, field, val string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hashes[key][field] = val
+}
+
+func TestRedisStateManager(t *testing.T) {
+	r := &fakeRedis{
+		hashes: map[string]map[string]string{
+			RedisKey("redis-test"): {"foo": "1", "bad": "{"},
+		},
+		messages: make(chan string),
+	}
+	sm, err := NewRedisStateManager(r, "redis-test", obs.NullFR)
+	require.NoError(t, err)
+	defer sm.Close()
+
+	cfg, err := sm.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "1", cfg.String())
+	assert.Equal(t, []string{"foo"}, sm.Keys())
+
+	changed := make(chan []byte, 10)
+	defer sm.Subscribe("foo", func(_, new []byte) { changed <- new })()
+	r.hset(RedisKey("redis-test"), "foo", "2")
+	r.messages <- ""
+	assert.Equal(t, "2", string(<-changed))
+}
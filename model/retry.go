@@ -0,0 +1,51 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// readAttempts bounds the reads of a file
+	// failing with a transient error
+	readAttempts = 4
+	// readRetryDelay is the delay before the first retry,
+	// doubled before every other retry
+	readRetryDelay = 10 * time.Millisecond
+)
+
+// readFile reads filePath, retrying transient errors such as the
+// file missing while Kubernetes swaps the ..data symlink, since
+// another file event may never come
+func readFile(filePath string) ([]byte, error) {
+	delay := readRetryDelay
+	for attempt := 1; ; attempt++ {
+		data, err := ioutil.ReadFile(filePath)
+		if err == nil || attempt == readAttempts || !isTransient(filePath, err) {
+			return data, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransient returns true for the read errors of filePath that may
+// not happen again, e.g. during an update of the file. A missing file
+// is only retried if it is a symlink, like the ones of the mounted
+// ConfigMaps, whose target is missing: a file that is really missing,
+// e.g. because its key was removed from the ConfigMap, is not retried.
+func isTransient(filePath string, err error) bool {
+	if os.IsNotExist(err) {
+		info, lerr := os.Lstat(filePath)
+		return lerr == nil && info.Mode()&os.ModeSymlink != 0
+	}
+	if os.IsPermission(err) {
+		return true
+	}
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err == syscall.EINTR || pathErr.Err == syscall.EAGAIN
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFileRetry(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	filePath := path.Join(dir, "configs.json")
+	require.NoError(t, os.Symlink(path.Join("..data", "configs.json"), filePath))
+
+	// the target of the symlink appears during the retries, the
+	// directory is renamed so that the file is never read empty
+	created := make(chan struct{})
+	go func() {
+		defer close(created)
+		time.Sleep(readRetryDelay / 2)
+		tmpDir := path.Join(dir, "..data_tmp")
+		os.Mkdir(tmpDir, 0700)
+		ioutil.WriteFile(path.Join(tmpDir, "configs.json"), []byte(`[]`), 0600)
+		os.Rename(tmpDir, path.Join(dir, "..data"))
+	}()
+	data, err := readFile(filePath)
+	<-created
+	require.NoError(t, err)
+	assert.Equal(t, `[]`, string(data))
+
+	// files that are really missing are not retried
+	start := time.Now()
+	_, err = readFile(path.Join(dir, "missing.json"))
+	assert.True(t, os.IsNotExist(err))
+	assert.True(t, time.Since(start) < readRetryDelay)
+
+	// directories are not retried
+	start = time.Now()
+	_, err = readFile(dir)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < readRetryDelay)
+}
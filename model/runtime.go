@@ -0,0 +1,196 @@
+package model
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+)
+
+// RuntimeOverrides is a StateManager holding in-process overrides
+// that are never persisted and optionally expire. Layer it on top
+// of another StateManager with NewLayeredStateManager.
+type RuntimeOverrides struct {
+	NullStateManager
+
+	mu       sync.RWMutex
+	state    *State
+	expiries map[string]expiry
+	lastGen  uint64
+
+	listeners reloadListeners
+	clock     clock.Clock
+}
+
+// expiry is the timer clearing an override at at. gen
+// tells apart the successive overrides of the same key.
+type expiry struct {
+	timer clock.Timer
+	gen   uint64
+	at    time.Time
+}
+
+// RuntimeOverride is an override of RuntimeOverrides.
+// ExpiresAt is zero if the override does not expire.
+type RuntimeOverride struct {
+	Key       string
+	Value     json.RawMessage
+	ExpiresAt time.Time
+}
+
+// NewRuntimeOverrides returns RuntimeOverrides without any override
+func NewRuntimeOverrides() *RuntimeOverrides {
+	return NewRuntimeOverridesWithClock(clock.Real)
+}
+
+// NewRuntimeOverridesWithClock returns RuntimeOverrides
+// without any override expiring the overrides with clk
+func NewRuntimeOverridesWithClock(clk clock.Clock) *RuntimeOverrides {
+	state := &State{}
+	state.buildCache()
+	return &RuntimeOverrides{
+		state:    state,
+		expiries: make(map[string]expiry),
+		clock:    clk,
+	}
+}
+
+// Set overrides key with raw. The override is cleared after ttl,
+// or never if ttl is not positive.
+func (r *RuntimeOverrides) Set(key string, raw json.RawMessage, ttl time.Duration) {
+	r.update([]string{key}, 0, func(cache map[string]*Config) {
+		r.set(cache, key, raw, ttl)
+	})
+}
+
+// SetMany is Set for several keys at once: the listeners
+// are notified once, of all the overrides
+func (r *RuntimeOverrides) SetMany(overrides map[string]json.RawMessage, ttl time.Duration) {
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	r.update(keys, 0, func(cache map[string]*Config) {
+		for key, raw := range overrides {
+			r.set(cache, key, raw, ttl)
+		}
+	})
+}
+
+// set sets the override of key in cache, with r.mu held
+func (r *RuntimeOverrides) set(cache map[string]*Config, key string, raw json.RawMessage, ttl time.Duration) {
+	cache[key] = &Config{Key: key, RawValue: raw}
+	if ttl > 0 {
+		r.lastGen++
+		gen := r.lastGen
+		r.expiries[key] = expiry{
+			timer: r.clock.AfterFunc(ttl, func() { r.expire(key, gen) }),
+			gen:   gen,
+			at:    r.clock.Now().Add(ttl),
+		}
+	}
+}
+
+// Clear removes the override of key
+func (r *RuntimeOverrides) Clear(key string) {
+	r.update([]string{key}, 0, func(cache map[string]*Config) {
+		delete(cache, key)
+	})
+}
+
+func (r *RuntimeOverrides) expire(key string, gen uint64) {
+	r.update([]string{key}, gen, func(cache map[string]*Config) {
+		delete(cache, key)
+	})
+}
+
+// update swaps in a copy of the State modified by fn, which updates
+// keys. If gen is not zero the update is skipped unless gen is the
+// current expiry of the key, so that an expiry does not clear a
+// newer override.
+func (r *RuntimeOverrides) update(keys []string, gen uint64, fn func(cache map[string]*Config)) {
+	r.mu.Lock()
+	if gen != 0 && r.expiries[keys[0]].gen != gen {
+		r.mu.Unlock()
+		return
+	}
+	old := r.state
+	state := &State{}
+	state.buildCache()
+	for k, cfg := range old.cache {
+		state.cache[k] = cfg
+	}
+	for _, key := range keys {
+		if e, ok := r.expiries[key]; ok {
+			e.timer.Stop()
+			delete(r.expiries, key)
+		}
+	}
+	fn(state.cache)
+	for _, k := range state.keys() {
+		state.Configs = append(state.Configs, state.cache[k])
+	}
+	r.state = state
+	r.mu.Unlock()
+	r.listeners.fire(newReload(old, state))
+}
+
+// List returns the overrides sorted by key
+func (r *RuntimeOverrides) List() []RuntimeOverride {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	overrides := make([]RuntimeOverride, 0, len(r.state.Configs))
+	for _, cfg := range r.state.Configs {
+		overrides = append(overrides, RuntimeOverride{
+			Key:       cfg.Key,
+			Value:     cfg.RawValue,
+			ExpiresAt: r.expiries[cfg.Key].at,
+		})
+	}
+	return overrides
+}
+
+func (r *RuntimeOverrides) GetKey(key string) (*Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.state.get(key)
+}
+
+func (r *RuntimeOverrides) Keys() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.state.keys()
+}
+
+func (r *RuntimeOverrides) Snapshot() StateManager {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &snapshotStateManager{
+		NullStateManager: &NullStateManager{},
+		state:            r.state,
+	}
+}
+
+func (r *RuntimeOverrides) OnReload(fn func()) func() {
+	return r.listeners.add(onReload(fn))
+}
+
+func (r *RuntimeOverrides) Subscribe(key string, fn func(old, new []byte)) func() {
+	return r.listeners.add(onKeyChange(key, fn))
+}
+
+func (r *RuntimeOverrides) OnDiff(fn func(Diff)) func() {
+	return r.listeners.add(onDiff(fn))
+}
+
+// Close stops the expiry timers and waits for the callbacks in flight
+func (r *RuntimeOverrides) Close() {
+	r.mu.Lock()
+	for key, e := range r.expiries {
+		e.timer.Stop()
+		delete(r.expiries, key)
+	}
+	r.mu.Unlock()
+	r.listeners.close()
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeOverridesExpiry(t *testing.T) {
+	r := NewRuntimeOverrides()
+	defer r.Close()
+
+	r.Set("foo", json.RawMessage("1"), 20*time.Millisecond)
+	// setting again replaces the expiry
+	r.Set("foo", json.RawMessage("2"), time.Hour)
+	time.Sleep(50 * time.Millisecond)
+
+	cfg, err := r.GetKey("foo")
+	require.NoError(t, err)
+	assert.Equal(t, "2", cfg.String())
+
+	cleared := make(chan struct{})
+	defer r.Subscribe("bar", func(old, new []byte) {
+		if new == nil {
+			close(cleared)
+		}
+	})()
+	r.Set("bar", json.RawMessage("3"), time.Millisecond)
+	<-cleared
+	_, err = r.GetKey("bar")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestRuntimeOverridesList(t *testing.T) {
+	r := NewRuntimeOverrides()
+	defer r.Close()
+
+	r.Set("foo", json.RawMessage("1"), time.Hour)
+	r.Set("bar", json.RawMessage("2"), 0)
+	overrides := r.List()
+	require.Len(t, overrides, 2)
+	assert.Equal(t, RuntimeOverride{Key: "bar", Value: json.RawMessage("2")}, overrides[0])
+	assert.Equal(t, "foo", overrides[1].Key)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), overrides[1].ExpiresAt, time.Minute)
+}
+
+func TestRuntimeOverridesSetMany(t *testing.T) {
+	r := NewRuntimeOverrides()
+	defer r.Close()
+
+	var diffs []Diff
+	defer r.OnDiff(func(d Diff) { diffs = append(diffs, d) })()
+	r.SetMany(map[string]json.RawMessage{
+		"foo": json.RawMessage("1"),
+		"bar": json.RawMessage("2"),
+	}, 0)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, []string{"bar", "foo"}, changeKeys(diffs[0].Added))
+	assert.Equal(t, []string{"bar", "foo"}, r.Keys())
+}
+
+func TestRuntimeOverridesClock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	r := NewRuntimeOverridesWithClock(clk)
+	defer r.Close()
+
+	r.Set("foo", json.RawMessage("1"), time.Hour)
+	assert.Equal(t, start.Add(time.Hour), r.List()[0].ExpiresAt)
+	clk.Advance(59 * time.Minute)
+	_, err := r.GetKey("foo")
+	require.NoError(t, err)
+	clk.Advance(time.Minute)
+	_, err = r.GetKey("foo")
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,11 @@
+package model
+
+// Schema validates the configs of a scope
+// before they replace the loaded ones
+type Schema interface {
+	Validate(configs []*Config) error
+}
+
+// SchemaLoader returns the Schema of the scope
+// in scopeDir, or nil if the scope has none
+type SchemaLoader func(scopeDir string) (Schema, error)
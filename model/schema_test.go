@@ -0,0 +1,57 @@
+package model
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requiredKeySchema requires a config with its key
+type requiredKeySchema string
+
+func (s requiredKeySchema) Validate(configs []*Config) error {
+	for _, cfg := range configs {
+		if cfg.Key == string(s) {
+			return nil
+		}
+	}
+	return errors.New("missing " + string(s))
+}
+
+func TestSchema(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "schema"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 1}]`)
+
+	var loadedFrom string
+	loader := func(scopeDir string) (Schema, error) {
+		loadedFrom = scopeDir
+		return requiredKeySchema("foo"), nil
+	}
+	sm, err := NewStateManager(dir, ns, nil, obs.NullFR, WithSchema(loader))
+	require.NoError(t, err)
+	defer sm.Close()
+	assert.Equal(t, path.Join(dir, ns), loadedFrom)
+
+	loaded := make(chan string, 10)
+	defer sm.OnReload(func() {
+		cfg, err := sm.GetKey("foo")
+		require.NoError(t, err, "configs without foo should not be loaded")
+		loaded <- cfg.String()
+	})()
+
+	safeWriteFile(t, filePath, `[{"key": "bar", "value": 2}]`)
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 3}]`)
+	for val := range loaded {
+		if val == "3" {
+			break
+		}
+	}
+}
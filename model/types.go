@@ -0,0 +1,79 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrWrongType is returned when a config is read
+// as another type than the one it declares
+var ErrWrongType = errors.New("Config declared with another type")
+
+// ConfigType is the type a Config may declare for its value
+type ConfigType string
+
+const (
+	TypeBool    ConfigType = "bool"
+	TypeInt64   ConfigType = "int64"
+	TypeFloat64 ConfigType = "float64"
+	TypeString  ConfigType = "string"
+	// TypeProjectSet is a whitelist of projects, an object
+	// keyed by project id or with ranges and ids
+	TypeProjectSet ConfigType = "project_set"
+	// TypeTokenSet is a whitelist of tokens, an object keyed by token
+	TypeTokenSet ConfigType = "token_set"
+	// TypeJSON is any JSON value
+	TypeJSON ConfigType = "json"
+)
+
+// Check returns an error if raw is not a value of t
+func (t ConfigType) Check(raw []byte) error {
+	var err error
+	switch t {
+	case TypeBool:
+		var val bool
+		err = json.Unmarshal(raw, &val)
+	case TypeInt64:
+		var val int64
+		err = json.Unmarshal(raw, &val)
+	case TypeFloat64:
+		var val float64
+		err = json.Unmarshal(raw, &val)
+	case TypeString:
+		var val string
+		err = json.Unmarshal(raw, &val)
+	case TypeProjectSet:
+		var val map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &val); err == nil {
+			for key := range val {
+				if key == "ranges" || key == "ids" {
+					continue
+				}
+				if _, perr := strconv.ParseInt(key, 10, 64); perr != nil {
+					err = fmt.Errorf("%q is not a project id", key)
+					break
+				}
+			}
+		}
+	case TypeTokenSet:
+		var val map[string]json.RawMessage
+		err = json.Unmarshal(raw, &val)
+	case TypeJSON:
+		if !json.Valid(raw) {
+			err = errors.New("invalid JSON")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", string(t))
+	}
+	// null unmarshals into anything
+	if err == nil && t != TypeJSON && bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		err = errors.New("null value")
+	}
+	if err != nil {
+		return fmt.Errorf("value is not a %s: %v", string(t), err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigTypeCheck(t *testing.T) {
+	valid := map[ConfigType][]string{
+		TypeBool:       {`true`, `false`},
+		TypeInt64:      {`1`, `-42`},
+		TypeFloat64:    {`1`, `0.5`},
+		TypeString:     {`""`, `"a"`},
+		TypeProjectSet: {`{}`, `{"1": {}}`, `{"ranges": [[1, 2]], "ids": [3]}`},
+		TypeTokenSet:   {`{}`, `{"abc": {}}`},
+		TypeJSON:       {`null`, `[1, "a"]`, `{"a": 1}`},
+	}
+	for typ, raws := range valid {
+		for _, raw := range raws {
+			assert.NoError(t, typ.Check([]byte(raw)), "%s %s", typ, raw)
+		}
+	}
+	invalid := map[ConfigType][]string{
+		TypeBool:       {`1`, `"true"`, `null`},
+		TypeInt64:      {`0.5`, `"1"`},
+		TypeFloat64:    {`"0.5"`, `true`},
+		TypeString:     {`1`, `{}`},
+		TypeProjectSet: {`[]`, `{"abc": {}}`},
+		TypeTokenSet:   {`["abc"]`},
+		TypeJSON:       {`{`},
+		"uint8":        {`1`},
+	}
+	for typ, raws := range invalid {
+		for _, raw := range raws {
+			assert.Error(t, typ.Check([]byte(raw)), "%s %s", typ, raw)
+		}
+	}
+}
+
+func TestMemoryStateManagerTypes(t *testing.T) {
+	sm := NewMemoryStateManager("types", []*Config{
+		{Key: "ratio", RawValue: []byte(`0.5`), Type: TypeFloat64},
+		{Key: "name", RawValue: []byte(`1`), Type: TypeString},
+	}, obs.NullFR)
+	defer sm.Close()
+
+	cfg, err := sm.GetKey("ratio")
+	require.NoError(t, err)
+	assert.Equal(t, TypeFloat64, cfg.Type)
+	// values not matching their type are not loaded
+	_, err = sm.GetKey("name")
+	assert.Equal(t, ErrNotFound, err)
+
+	err = sm.Push([]*Config{
+		{Key: "ratio", RawValue: []byte(`"half"`), Type: TypeFloat64},
+	})
+	assert.Equal(t, ErrInvalidValues, obserr.Original(err))
+	cfg, err = sm.GetKey("ratio")
+	require.NoError(t, err)
+	assert.Equal(t, "0.5", cfg.String())
+}
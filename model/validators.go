@@ -0,0 +1,157 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// ErrDroppedRequiredKeys is returned when new configs do not
+// have required keys that the loaded configs have
+var ErrDroppedRequiredKeys = errors.New("required keys missing from the new configs")
+
+// ErrInvalidValues is returned by MemoryStateManager.Push when
+// values fail validation, the other values are loaded
+var ErrInvalidValues = errors.New("configs with invalid values")
+
+// Validators are validators of the values of keys, run
+// on the new value of the keys every time configs are loaded.
+// The zero value is ready to use.
+type Validators struct {
+	mu  sync.RWMutex
+	fns map[string]func(raw []byte) error
+}
+
+// Register validates the values of key with fn. Keys whose
+// new value fails validation keep their previous value.
+func (v *Validators) Register(key string, fn func(raw []byte) error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.fns == nil {
+		v.fns = make(map[string]func(raw []byte) error)
+	}
+	v.fns[key] = fn
+}
+
+func (v *Validators) get(key string) func(raw []byte) error {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.fns[key]
+}
+
+// WithValidators validates the values of the keys with
+// the validators registered in v, now or later
+func WithValidators(v *Validators) Option {
+	return func(sm *stateManager) {
+		sm.validators = v
+	}
+}
+
+// WithRequiredKeys rejects new configs missing any of keys that the
+// loaded configs have, e.g. a file truncated mid-write, keeping the
+// loaded configs. Keys that the StateManager never loaded are not
+// checked, they may be loaded by another StateManager.
+func WithRequiredKeys(keys ...string) Option {
+	return func(sm *stateManager) {
+		sm.requiredKeys = append(sm.requiredKeys, keys...)
+	}
+}
+
+// validateState validates State before it replaces old: the duplicate
+// keys, the values of the keys with validators, the required keys and
+// the schema. The configs with invalid values are replaced in State
+// and their keys are returned, any other failure is returned.
+func (sm *stateManager) validateState(old, State *State) ([]string, error) {
+	if err := sm.dedupeKeys(State); err != nil {
+		return nil, err
+	}
+	invalid := sm.validateKeys(old, State)
+	if dropped := sm.droppedRequiredKeys(old, State); len(dropped) > 0 {
+		sm.fr.WithSpan(context.Background()).Incr("dropped_required_keys")
+		return nil, obserr.Annotate(ErrDroppedRequiredKeys, "configs miss required keys, keeping the loaded configs").Set(
+			"path", sm.filePath,
+			"keys", dropped,
+		)
+	}
+	if sm.schema != nil {
+		if err := sm.schema.Validate(State.Configs); err != nil {
+			sm.fr.WithSpan(context.Background()).Incr("schema_violation")
+			return nil, obserr.Annotate(err, "configs do not match the schema, keeping the loaded configs").Set("path", sm.filePath)
+		}
+	}
+	return invalid, nil
+}
+
+// droppedRequiredKeys returns the required keys
+// in old that State does not have
+func (sm *stateManager) droppedRequiredKeys(old, State *State) []string {
+	if old == nil || len(sm.requiredKeys) == 0 {
+		return nil
+	}
+	keys := make(map[string]struct{}, len(State.Configs))
+	for _, cfg := range State.Configs {
+		keys[cfg.Key] = struct{}{}
+	}
+	var dropped []string
+	for _, key := range sm.requiredKeys {
+		if _, ok := old.cache[key]; !ok {
+			continue
+		}
+		if _, ok := keys[key]; !ok {
+			dropped = append(dropped, key)
+		}
+	}
+	return dropped
+}
+
+// validateValue checks the value of cfg against its
+// declared type and the validator of its key, if any
+func (sm *stateManager) validateValue(cfg *Config) error {
+	if cfg.Type != "" {
+		if err := cfg.Type.Check(cfg.RawValue); err != nil {
+			return err
+		}
+	}
+	if sm.validators == nil {
+		return nil
+	}
+	if fn := sm.validators.get(cfg.Key); fn != nil {
+		return fn(cfg.RawValue)
+	}
+	return nil
+}
+
+// validateKeys replaces the configs of State whose value fails
+// validation with the config of the same key in old, or removes
+// them if old does not have the key, and returns their keys
+func (sm *stateManager) validateKeys(old, State *State) []string {
+	var invalid []string
+	configs := State.Configs[:0:0]
+	for _, cfg := range State.Configs {
+		err := sm.validateValue(cfg)
+		if err == nil {
+			configs = append(configs, cfg)
+			continue
+		}
+		invalid = append(invalid, cfg.Key)
+		fs := sm.fr.WithSpan(context.Background())
+		fs.Incr("invalid_value")
+		vals := obs.Vals{"path": sm.filePath, "key": cfg.Key}
+		if !cfg.Sensitive && !sm.sensitive {
+			// validation errors may quote the value
+			vals = vals.WithError(err)
+		}
+		fs.Warn("invalid_value", "invalid value, keeping the previous value", vals)
+		if old == nil {
+			continue
+		}
+		if prev, ok := old.cache[cfg.Key]; ok {
+			configs = append(configs, prev)
+		}
+	}
+	State.Configs = configs
+	return invalid
+}
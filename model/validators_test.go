@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateState(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+	ns := "validate_state"
+	filePath := path.Join(dir, ns, "configs.json")
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 1}, {"key": "bar", "value": 1}]`)
+
+	validators := &Validators{}
+	validators.Register("bar", func(raw []byte) error {
+		if string(raw) == "0" {
+			return errors.New("bar must not be 0")
+		}
+		return nil
+	})
+	sm, err := NewStateManager(dir, ns, nil, obs.NullFR, WithValidators(validators), WithRequiredKeys("foo", "baz"))
+	require.NoError(t, err)
+	defer sm.Close()
+
+	loaded := make(chan map[string]string, 10)
+	defer sm.OnReload(func() {
+		vals := make(map[string]string)
+		for _, key := range sm.Keys() {
+			cfg, err := sm.GetKey(key)
+			require.NoError(t, err)
+			vals[key] = cfg.String()
+		}
+		loaded <- vals
+	})()
+
+	// a file dropping foo, e.g. truncated, is not loaded
+	safeWriteFile(t, filePath, `[{"key": "bar", "value": 2}]`)
+	// baz was never loaded so it is not required
+	safeWriteFile(t, filePath, `[{"key": "foo", "value": 3}, {"key": "bar", "value": 0}]`)
+	for vals := range loaded {
+		assert.Contains(t, vals, "foo", "configs without foo should not be loaded")
+		if vals["foo"] == "3" {
+			// the invalid bar keeps its value
+			assert.Equal(t, "1", vals["bar"])
+			break
+		}
+	}
+}
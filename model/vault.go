@@ -0,0 +1,253 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// DefaultVaultRefreshInterval is used when
+// VaultConfig.RefreshInterval is not set
+const DefaultVaultRefreshInterval = 5 * time.Minute
+
+// VaultConfig locates and authenticates against Vault
+type VaultConfig struct {
+	// Address is the base URL of Vault, e.g. https://vault:8200
+	Address string
+	// Token authenticates the requests. A renewable token
+	// is renewed before its lease expires.
+	Token string
+	// Mount is the path of the KV version 2 secrets
+	// engine, secret if empty
+	Mount string
+	// RefreshInterval is how often the secret is read
+	// again, DefaultVaultRefreshInterval if zero
+	RefreshInterval time.Duration
+	// Client makes the requests. DefaultHTTPClient
+	// is used if it is nil.
+	Client *http.Client
+}
+
+type vaultResponse struct {
+	Data json.RawMessage `json:"data"`
+	Auth *struct {
+		LeaseDuration int  `json:"lease_duration"`
+		Renewable     bool `json:"renewable"`
+	} `json:"auth"`
+}
+
+// vaultStateManager loads the configs from
+// a secret of the Vault KV secrets engine
+type vaultStateManager struct {
+	*stateManager
+
+	cfg  *VaultConfig
+	path string
+
+	// tokenTTL is the lease of the token
+	// or zero if it is not renewable
+	tokenTTL time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewVaultStateManager returns a StateManager loading the configs from the
+// fields of the secret at path in the KV version 2 secrets engine of Vault,
+// so that secrets are read with the same getters as the other configs. Each
+// field is a key and its value the config value. The secret is read again
+// every cfg.RefreshInterval and the token is renewed at half its lease if it
+// is renewable. Values are not published to expvar. scope names the expvar
+// map of the configs like with NewStateManager.
+func NewVaultStateManager(cfg *VaultConfig, path, scope string, fr obs.FlightRecorder, opts ...Option) (StateManager, error) {
+	vsm := &vaultStateManager{
+		stateManager: &stateManager{
+			filePath:   fmt.Sprintf("vault:%s", path),
+			updateChan: make(chan struct{}),
+			fr:         fr.ScopeName("vault_state_manager"),
+			sensitive:  true,
+		},
+		cfg:  cfg,
+		path: strings.Trim(path, "/"),
+	}
+	for _, opt := range opts {
+		opt(vsm.stateManager)
+	}
+	vsm.publishExpvar(fmt.Sprintf("configmanager.%s", scope))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	vsm.cancel = cancel
+	if err := vsm.read(ctx); err != nil {
+		cancel()
+		vsm.unpublishExpvar()
+		return nil, obserr.Annotate(err, "NewVaultStateManager: error reading the secret").Set("path", path)
+	}
+	if err := vsm.lookupToken(ctx); err != nil {
+		// the token is valid since the secret was
+		// read, it is just not going to be renewed
+		vsm.fr.WithSpan(ctx).Warn("error_token_lookup", "could not look up the vault token, not renewing it", obs.Vals{}.WithError(err))
+	}
+	vsm.wg.Add(1)
+	go func() {
+		defer vsm.wg.Done()
+		vsm.run(ctx)
+	}()
+	return vsm, nil
+}
+
+func (vsm *vaultStateManager) request(ctx context.Context, method, path string, body []byte) (*vaultResponse, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(vsm.cfg.Address, "/")+"/v1/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Vault-Token", vsm.cfg.Token)
+	client := vsm.cfg.Client
+	if client == nil {
+		client = DefaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, obserr.Annotate(fmt.Errorf("unexpected status %d", resp.StatusCode), "vault request failed").Set("path", path)
+	}
+	var vr vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
+		return nil, obserr.Annotate(err, "error decoding the vault response").Set("path", path)
+	}
+	return &vr, nil
+}
+
+func (vsm *vaultStateManager) read(ctx context.Context) (err error) {
+	vsm.loadMu.Lock()
+	defer vsm.loadMu.Unlock()
+	defer vsm.startLoad(ctx)(&err)
+
+	mount := vsm.cfg.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	vr, err := vsm.request(ctx, http.MethodGet, fmt.Sprintf("%s/data/%s", strings.Trim(mount, "/"), vsm.path), nil)
+	if err != nil {
+		return err
+	}
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(vr.Data, &secret); err != nil {
+		return obserr.Annotate(err, "error json unmarshal the secret")
+	}
+	State := &State{
+		cache: make(map[string]*Config),
+	}
+	for key, val := range secret.Data {
+		State.Configs = append(State.Configs, &Config{Key: key, RawValue: val})
+	}
+	sort.Slice(State.Configs, func(i, j int) bool {
+		return State.Configs[i].Key < State.Configs[j].Key
+	})
+	return vsm.loadState(State)
+}
+
+func (vsm *vaultStateManager) lookupToken(ctx context.Context) error {
+	vr, err := vsm.request(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+	if err != nil {
+		return err
+	}
+	var token struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	}
+	if err := json.Unmarshal(vr.Data, &token); err != nil {
+		return obserr.Annotate(err, "error json unmarshal the token")
+	}
+	if token.Renewable {
+		vsm.tokenTTL = time.Duration(token.TTL) * time.Second
+	}
+	return nil
+}
+
+func (vsm *vaultStateManager) renewToken(ctx context.Context) error {
+	vr, err := vsm.request(ctx, http.MethodPost, "auth/token/renew-self", []byte("{}"))
+	if err != nil {
+		return err
+	}
+	if vr.Auth == nil || !vr.Auth.Renewable {
+		vsm.tokenTTL = 0
+		return nil
+	}
+	vsm.tokenTTL = time.Duration(vr.Auth.LeaseDuration) * time.Second
+	return nil
+}
+
+// run reads the secret and renews the token until ctx is done
+func (vsm *vaultStateManager) run(ctx context.Context) {
+	fs := vsm.fr.WithSpan(ctx)
+	refresh := vsm.cfg.RefreshInterval
+	if refresh <= 0 {
+		refresh = DefaultVaultRefreshInterval
+	}
+	clk := vsm.clk()
+	nextRead := clk.Now().Add(refresh)
+	var nextRenew time.Time
+	if vsm.tokenTTL > 0 {
+		nextRenew = clk.Now().Add(vsm.tokenTTL / 2)
+	}
+	for {
+		next := nextRead
+		if !nextRenew.IsZero() && nextRenew.Before(next) {
+			next = nextRenew
+		}
+		wait, timer := clock.After(clk, next.Sub(clk.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-wait:
+		}
+
+		if !nextRenew.IsZero() && !clk.Now().Before(nextRenew) {
+			if err := vsm.renewToken(ctx); err != nil && ctx.Err() == nil {
+				fs.Warn("error_token_renew", "could not renew the vault token", obs.Vals{}.WithError(err))
+				fs.Incr("token_renew_failed")
+			}
+			nextRenew = time.Time{}
+			if vsm.tokenTTL > 0 {
+				nextRenew = clk.Now().Add(vsm.tokenTTL / 2)
+			}
+		}
+		if !clk.Now().Before(nextRead) {
+			if err := vsm.read(ctx); err != nil && ctx.Err() == nil {
+				fs.Warn("error_read", "could not read the secret, keeping the last configs", obs.Vals{
+					"path": vsm.filePath,
+				}.WithError(err))
+			}
+			nextRead = clk.Now().Add(refresh)
+		}
+	}
+}
+
+// Reload reads the secret again, without waiting for the refresh
+func (vsm *vaultStateManager) Reload() error {
+	return vsm.read(context.Background())
+}
+
+func (vsm *vaultStateManager) Close() {
+	vsm.cancel()
+	vsm.wg.Wait()
+	vsm.stateManager.Close()
+}
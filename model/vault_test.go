@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultStateManager(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		password = `"hunter2"`
+		renewals int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/my-service":
+			fmt.Fprintf(w, `{"data": {"data": {"password": %s, "port": 5432}}}`, password)
+		case "/v1/auth/token/lookup-self":
+			fmt.Fprint(w, `{"data": {"ttl": 1, "renewable": true}}`)
+		case "/v1/auth/token/renew-self":
+			renewals++
+			fmt.Fprint(w, `{"auth": {"lease_duration": 1, "renewable": true}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &VaultConfig{
+		Address:         srv.URL,
+		Token:           "token",
+		Mount:           "kv",
+		RefreshInterval: 10 * time.Millisecond,
+	}
+	sm, err := NewVaultStateManager(cfg, "my-service", "vault-test", obs.NullFR)
+	require.NoError(t, err)
+	defer sm.Close()
+
+	c, err := sm.GetKey("password")
+	require.NoError(t, err)
+	assert.Equal(t, `"hunter2"`, c.String())
+	assert.Equal(t, []string{"password", "port"}, sm.Keys())
+
+	changed := make(chan []byte, 10)
+	defer sm.Subscribe("password", func(_, new []byte) { changed <- new })()
+	mu.Lock()
+	password = `"correct horse"`
+	mu.Unlock()
+	assert.Equal(t, `"correct horse"`, string(<-changed))
+
+	// the token is renewed at half its lease
+	time.Sleep(700 * time.Millisecond)
+	mu.Lock()
+	assert.True(t, renewals > 0)
+	mu.Unlock()
+
+	denied := *cfg
+	denied.Token = "wrong"
+	_, err = NewVaultStateManager(&denied, "my-service", "vault-test-denied", obs.NullFR)
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/mixpanel/obs/obserr"
+
+	yaml "gopkg.in/yaml.v1"
+)
+
+// YAMLFileName is loaded instead of configs.json
+// when the scope has no configs.json
+const YAMLFileName = "configs.yaml"
+
+// isYAML returns true if filePath should
+// be parsed with parseYAMLState
+func isYAML(filePath string) bool {
+	ext := path.Ext(filePath)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// parseYAMLState parses either a list of key and value
+// like configs.json or a map of the keys to their values
+func parseYAMLState(data []byte) (*State, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	switch doc := jsonValue(doc).(type) {
+	case nil:
+		return parseState([]byte("[]"))
+	case []interface{}:
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		return parseState(data)
+	case map[string]interface{}:
+		State := &State{
+			cache: make(map[string]*Config),
+		}
+		for _, key := range sortedKeys(doc) {
+			raw, err := json.Marshal(doc[key])
+			if err != nil {
+				return nil, obserr.Annotate(err, "error json marshal the value").Set("key", key)
+			}
+			State.Configs = append(State.Configs, &Config{Key: key, RawValue: raw})
+		}
+		return State, nil
+	default:
+		return nil, fmt.Errorf("yaml configs must be a list or a map, got %T", doc)
+	}
+}
+
+// jsonValue converts the maps decoded by yaml,
+// which may have any keys, to maps json can encode
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = jsonValue(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = jsonValue(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYAML(t *testing.T) {
+	dir, done := mkTempDir(t)
+	defer done()
+
+	safeWriteFile(t, path.Join(dir, "yaml-map", YAMLFileName), `
+timeout_secs: 5
+whitelist:
+  123: {}
+`)
+	sm, err := NewStateManager(dir, "yaml-map", nil, obs.NullFR)
+	require.NoError(t, err)
+	defer sm.Close()
+	assert.Equal(t, []string{"timeout_secs", "whitelist"}, sm.Keys())
+	cfg, err := sm.GetKey("whitelist")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"123": {}}`, cfg.String())
+
+	safeWriteFile(t, path.Join(dir, "yaml-list", YAMLFileName), `
+- key: timeout_secs
+  value: 5
+`)
+	sm, err = NewStateManager(dir, "yaml-list", nil, obs.NullFR)
+	require.NoError(t, err)
+	defer sm.Close()
+	cfg, err = sm.GetKey("timeout_secs")
+	require.NoError(t, err)
+	assert.Equal(t, "5", cfg.String())
+}
@@ -0,0 +1,72 @@
+package configmanager
+
+import (
+	"github.com/mixpanel/obs/obserr"
+)
+
+// MustClient wraps a Client and panics instead of
+// returning a default value when a key is missing or
+// can not be parsed. It is meant for startup-critical
+// configs where running with a default is worse than
+// crashing, e.g.
+//
+//	shards := configmanager.Must(cm).GetInt64("shard_count")
+type MustClient struct {
+	c Client
+}
+
+// Must returns a MustClient reading from c
+func Must(c Client) *MustClient {
+	return &MustClient{c: c}
+}
+
+func mustNotFail(err error, key string) {
+	if err == nil {
+		return
+	}
+	reason := "config could not be parsed"
+	if IsNotFound(err) {
+		reason = "config is missing"
+	}
+	panic(obserr.Annotate(err, "configmanager: "+reason).Set("key", key))
+}
+
+func (m *MustClient) Unmarshal(key string, val interface{}) {
+	mustNotFail(m.c.Unmarshal(key, val), key)
+}
+
+func (m *MustClient) GetBoolean(key string) bool {
+	val, err := m.c.GetBooleanE(key)
+	mustNotFail(err, key)
+	return val
+}
+
+func (m *MustClient) GetInt64(key string) int64 {
+	val, err := m.c.GetInt64E(key)
+	mustNotFail(err, key)
+	return val
+}
+
+func (m *MustClient) GetByte(key string) uint8 {
+	val, err := m.c.GetByteE(key)
+	mustNotFail(err, key)
+	return val
+}
+
+func (m *MustClient) GetFloat64(key string) float64 {
+	val, err := m.c.GetFloat64E(key)
+	mustNotFail(err, key)
+	return val
+}
+
+func (m *MustClient) GetString(key string) string {
+	val, err := m.c.GetStringE(key)
+	mustNotFail(err, key)
+	return val
+}
+
+func (m *MustClient) GetRaw(key string) []byte {
+	val, err := m.c.GetRaw(key)
+	mustNotFail(err, key)
+	return val
+}
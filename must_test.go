@@ -0,0 +1,27 @@
+package configmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMust(t *testing.T) {
+	c := NewTestClient().
+		SetInt64("shards", 8).
+		SetString("name", "foo").
+		SetBoolean("enabled", true)
+	m := Must(c)
+
+	assert.EqualValues(t, 8, m.GetInt64("shards"))
+	assert.Equal(t, "foo", m.GetString("name"))
+	assert.True(t, m.GetBoolean("enabled"))
+
+	var shards int
+	m.Unmarshal("shards", &shards)
+	assert.Equal(t, 8, shards)
+
+	assert.Panics(t, func() { m.GetInt64("missing") })
+	assert.Panics(t, func() { m.GetInt64("name") })
+	assert.Panics(t, func() { m.GetRaw("missing") })
+}
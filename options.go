@@ -0,0 +1,444 @@
+package configmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/mixpanel/obs"
+)
+
+// Option configures optional behaviour of a Client
+type Option func(*options)
+
+type options struct {
+	strictTypes    bool
+	onTypeMismatch func(key string, err error)
+	requiredKeys   []string
+	onReload       []func(ReloadSummary)
+	smOpts         []model.Option
+	fallbackScopes []string
+	envPrefix      *string
+	flagOverrides  FlagOverrides
+	k8sConfig      *model.K8sConfig
+	httpClient     *http.Client
+
+	exposureHook       func(key, entity string, result bool)
+	exposureSampleRate float64
+
+	now func() time.Time
+
+	aliases map[string]string
+
+	metrics Metrics
+	onError func(err error, key string)
+
+	tracer           Tracer
+	decodeSampleRate float64
+
+	eventBuffer int
+
+	// preparseTypes are the types of WithPreparse, nil without it
+	preparseTypes map[string]ParsedType
+
+	// health records the loads of the configs for Healthy
+	health       *healthTracker
+	healthWindow time.Duration
+
+	// validators are shared by the client and its StateManager
+	validators *model.Validators
+
+	// fr is the FlightRecorder of NewClientWithOptions
+	fr obs.FlightRecorder
+
+	unmarshal func(data []byte, val interface{}) error
+
+	// clock expires the overrides, now tells the time
+	// of the rest, e.g. of the whitelists and rollouts
+	clock clock.Clock
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		exposureSampleRate: 1,
+		now:                time.Now,
+		validators:         &model.Validators{},
+		fr:                 obs.NullFR,
+		unmarshal:          json.Unmarshal,
+		clock:              clock.Real,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.health = &healthTracker{now: o.now, window: o.healthWindow, validated: o.now()}
+	o.smOpts = append(o.smOpts, model.WithValidators(o.validators), model.WithOnSourceLoad(o.health.onLoad))
+	return o
+}
+
+// WithStrictTypes makes the client treat a stored value that can not
+// be parsed into the requested type as an error instead of silently
+// returning the default value: it is logged as critical and counted
+// in the type_mismatch metric. Getters still return the default value.
+func WithStrictTypes() Option {
+	return func(o *options) {
+		o.strictTypes = true
+	}
+}
+
+// WithTypeMismatchHandler enables strict types and calls fn on every
+// type mismatch. fn may panic to crash on misconfiguration.
+func WithTypeMismatchHandler(fn func(key string, err error)) Option {
+	return func(o *options) {
+		o.strictTypes = true
+		o.onTypeMismatch = fn
+	}
+}
+
+// WithRequiredKeys makes NewClient fail if any of the keys
+// is missing from the scope. Files that drop a required key, e.g.
+// a file truncated mid-write, are not loaded. Keys missing after
+// a reload are logged and counted in the missing_required_keys
+// metric.
+func WithRequiredKeys(keys ...string) Option {
+	return func(o *options) {
+		o.requiredKeys = append(o.requiredKeys, keys...)
+		o.smOpts = append(o.smOpts, model.WithRequiredKeys(keys...))
+	}
+}
+
+// ReloadSummary describes the configs loaded by a reload
+type ReloadSummary struct {
+	// Keys are the sorted keys loaded
+	Keys     []string
+	LoadedAt time.Time
+}
+
+// WithOnReload calls fn every time the configs are reloaded so
+// that services can rebuild data derived from the configs.
+// fn is called from the goroutine watching the config file.
+func WithOnReload(fn func(ReloadSummary)) Option {
+	return func(o *options) {
+		o.onReload = append(o.onReload, fn)
+	}
+}
+
+// WithUpdateChannel sends a ReloadSummary on ch every time the configs
+// are reloaded. The summary is dropped if ch is full, so that a slow
+// reader does not block the reloads.
+func WithUpdateChannel(ch chan<- ReloadSummary) Option {
+	return WithOnReload(func(s ReloadSummary) {
+		select {
+		case ch <- s:
+		default:
+		}
+	})
+}
+
+// WithDebounce makes subscribers and OnReload hooks get at most one
+// notification per burst of reloads happening within window of each
+// other, with the final configs. Getters see new configs right away.
+func WithDebounce(window time.Duration) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithDebounce(window))
+	}
+}
+
+// WithFallbackScope makes keys missing from the scope of the client
+// resolve from scope under the same directory, e.g. a "global" scope
+// with org-wide kill switches. When given several times the fallback
+// scopes are tried in the order of the options.
+func WithFallbackScope(scope string) Option {
+	return func(o *options) {
+		o.fallbackScopes = append(o.fallbackScopes, scope)
+	}
+}
+
+// WithOverridesFile shadows the configs of the scope with the configs of
+// the file at filePath, e.g. to override a single key without
+// re-rendering the whole configmap. The file has the same format as
+// configs.json and is watched for changes. An empty filePath uses
+// overrides.json in the scope directory. The file may be missing: it
+// is loaded once created and its configs are dropped once removed.
+func WithOverridesFile(filePath string) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithOverridesFile(filePath))
+	}
+}
+
+// WithEnvOverrides makes environment variables named
+// <prefix><SCOPE>_<KEY> take precedence over the configs, e.g.
+// CONFIGMANAGER_MY_SERVICE_TIMEOUT_SECS=10 for a prefix of
+// CONFIGMANAGER_, a scope of my-service and a key of timeout_secs.
+// Scope and key are upper cased with any character other than
+// letters and digits replaced by an underscore. Values that are
+// not valid JSON are read as strings.
+func WithEnvOverrides(prefix string) Option {
+	return func(o *options) {
+		o.envPrefix = &prefix
+	}
+}
+
+// WithFlagOverrides makes the overrides parsed from the command line
+// by RegisterOverrideFlag take precedence over the configs, including
+// the ones from environment variables. The flags must be parsed before
+// the client is created.
+func WithFlagOverrides(overrides FlagOverrides) Option {
+	return func(o *options) {
+		o.flagOverrides = overrides
+	}
+}
+
+// withOverrides wraps sm with the env and flag overrides
+func (o *options) withOverrides(sm model.StateManager, scopes ...string) model.StateManager {
+	if o.envPrefix != nil {
+		for _, scope := range scopes {
+			sm = model.NewEnvStateManager(sm, *o.envPrefix, scope)
+		}
+	}
+	if len(o.flagOverrides) > 0 {
+		sm = model.NewOverrideStateManager(sm, o.flagOverrides)
+	}
+	return sm
+}
+
+// WithEnvironment layers the configs of configs.<environment>.json,
+// e.g. configs.staging.json, on top of configs.json in the scope
+// directory. The overlay file is optional.
+func WithEnvironment(environment string) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithEnvironment(environment))
+	}
+}
+
+// WithSensitive treats all the configs of the scope as sensitive:
+// their values are not published to expvar and never logged. Use it
+// for scopes mounted from a Kubernetes Secret. Single configs can be
+// marked with "sensitive": true in configs.json instead.
+func WithSensitive() Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithSensitive())
+	}
+}
+
+// WithoutExpvar does not publish the configs of the scope to expvar,
+// e.g. when /debug/vars is reachable from outside the service. Scopes
+// published more than once in a process are published as
+// configmanager.<scope>#2, configmanager.<scope>#3...
+func WithoutExpvar() Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithoutExpvar())
+	}
+}
+
+// WithJSONC allows // and /* */ comments and trailing commas
+// in the json config files, e.g. to explain why an override is set
+func WithJSONC() Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithJSONC())
+	}
+}
+
+// WithSchema refuses the reloads of configs.json that do not match the
+// schema loaded by loader from the scope directory, keeping the loaded
+// configs. Use cueschema.Loader to validate against a schema.cue file.
+func WithSchema(loader model.SchemaLoader) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithSchema(loader))
+	}
+}
+
+// WithK8sConfig makes NewClientFromK8s use cfg to reach the
+// Kubernetes API instead of the in-cluster service account
+func WithK8sConfig(cfg *model.K8sConfig) Option {
+	return func(o *options) {
+		o.k8sConfig = cfg
+	}
+}
+
+// WithHTTPClient makes NewClientFromURL fetch
+// the configs with client
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithExposureHook calls fn with the result of every evaluation of the
+// IsFeatureEnabled methods and IsEnabledForProject, so that experiment
+// analysis can record who saw which treatment. entity is the project or
+// the id the flag was evaluated for, empty for IsFeatureEnabled. fn is
+// called from the goroutine evaluating the flag and must be fast.
+func WithExposureHook(fn func(key string, entity string, result bool)) Option {
+	return func(o *options) {
+		o.exposureHook = fn
+	}
+}
+
+// WithExposureSampleRate makes the exposure hook only get
+// the given fraction of the evaluations, chosen at random
+func WithExposureSampleRate(rate float64) Option {
+	return func(o *options) {
+		o.exposureSampleRate = rate
+	}
+}
+
+// WithNow makes the client use now instead of time.Now
+// to expire whitelist entries, e.g. in tests. It is WithClock
+// with a clock that reads now and ticks with the time package.
+//
+// Deprecated: use WithClock
+func WithNow(now func() time.Time) Option {
+	return WithClock(nowClock{Clock: clock.Real, now: now})
+}
+
+// nowClock is a clock that reads the time from a func
+type nowClock struct {
+	clock.Clock
+	now func() time.Time
+}
+
+func (c nowClock) Now() time.Time {
+	return c.now()
+}
+
+// WithClock makes the client and its StateManager use clk instead of
+// the time package, e.g. a clock.Fake in tests: for the expiry of the
+// overrides and of the whitelist entries, the ramps of the rollouts,
+// the staleness of WithHealthWindow, the debouncing and the resyncs.
+func WithClock(clk clock.Clock) Option {
+	return func(o *options) {
+		o.clock = clk
+		o.now = clk.Now
+		o.smOpts = append(o.smOpts, model.WithClock(clk))
+	}
+}
+
+// WithDuplicateKeys sets what to do with configs defining the same
+// key more than once, by default the last one wins with a warning
+func WithDuplicateKeys(policy model.DuplicateKeyPolicy) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithDuplicateKeys(policy))
+	}
+}
+
+// WithAliases resolves the old keys of aliases, a map of old keys to
+// their new keys, to their new keys, so that keys can be renamed without
+// changing every caller at once. Aliases can also be given in the config
+// file, in the configmanager.aliases config. Reads of old keys are
+// reported like the reads of deprecated keys. Old keys resolve to
+// themselves while no source has the new key.
+func WithAliases(aliases map[string]string) Option {
+	return func(o *options) {
+		if o.aliases == nil {
+			o.aliases = make(map[string]string)
+		}
+		for oldKey, newKey := range aliases {
+			o.aliases[oldKey] = newKey
+		}
+	}
+}
+
+// WithLastKnownGood caches the configs of the scope in dir, or in
+// /var/cache/configmanager if dir is empty, so that NewClient can start
+// from the last configs loaded when the configs file is missing or can
+// not be loaded, e.g. during a configmap distribution hiccup
+func WithLastKnownGood(dir string) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithLastKnownGood(dir))
+	}
+}
+
+// WithLenientStart lets NewClient start with no configs when the configs
+// file of the scope is missing, e.g. when a sidecar writes the configmap
+// after the service started. The getters return their default values
+// until the file is created, which is then loaded right away.
+func WithLenientStart() Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithLenientStart())
+	}
+}
+
+// WithStartupTimeout bounds the wait for the initial load of the configs
+// in NewClient, one minute by default. NewClient fails with an error
+// instead of blocking when the configs can not be loaded in time, e.g.
+// because configs.json is invalid. A timeout of 0 waits until they load.
+func WithStartupTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithStartupTimeout(timeout))
+	}
+}
+
+// withStartupContext stops waiting for the initial load when ctx is done
+func withStartupContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithStartupContext(ctx))
+	}
+}
+
+// WithResyncInterval re-reads the configs files every interval even when
+// no file event was received, to recover from missed inotify events or
+// exhausted watches. The configs are only reloaded if a file changed.
+func WithResyncInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithResyncInterval(interval))
+	}
+}
+
+// WithPartialLoad loads the valid configs of configs.json when some of
+// its entries are invalid, e.g. a value of the wrong type for a field
+// or a missing key, instead of keeping the previous configs. The skipped
+// entries are counted in the invalid_entry metric, logged and passed
+// to onInvalid, which may be nil.
+func WithPartialLoad(onInvalid func(err error)) Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithPartialLoad(onInvalid))
+	}
+}
+
+// WithAuditLog logs every config added, removed or changed by a reload
+// with its old and new values, the time the change was applied and the
+// modification time of the file. Values of sensitive configs are redacted.
+func WithAuditLog() Option {
+	return func(o *options) {
+		o.smOpts = append(o.smOpts, model.WithAuditLog())
+	}
+}
+
+// WithUnmarshal makes the client decode the values with fn instead of
+// json.Unmarshal, e.g. to use a faster JSON package or to limit the size
+// of the values. The decoders of RegisterDecoder still take precedence.
+// fn is called concurrently by the getters.
+func WithUnmarshal(fn func(data []byte, val interface{}) error) Option {
+	return func(o *options) {
+		o.unmarshal = fn
+	}
+}
+
+// WithFlightRecorder sets the FlightRecorder the client of
+// NewClientWithOptions logs to, obs.NullFR by default
+func WithFlightRecorder(fr obs.FlightRecorder) Option {
+	return func(o *options) {
+		o.fr = fr
+	}
+}
+
+// WithErrorHandler calls fn with the errors that are otherwise only
+// logged, e.g. to report them to an error tracker or to crash on
+// misconfiguration: the errors of the getters returning their default
+// value, with the key, including missing keys (see IsNotFound), and the
+// errors loading the configs, with an empty key. Errors about sensitive
+// configs are redacted.
+func WithErrorHandler(fn func(err error, key string)) Option {
+	return func(o *options) {
+		o.onError = fn
+		o.smOpts = append(o.smOpts, model.WithOnLoad(func(err error) {
+			if err != nil {
+				fn(err, "")
+			}
+		}))
+	}
+}
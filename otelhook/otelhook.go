@@ -0,0 +1,97 @@
+// Package otelhook traces and measures the loads of the configs and
+// the decodes of their values with OpenTelemetry:
+//
+//	cm, err := configmanager.NewClient(dir, scope, fr,
+//		configmanager.WithTracer(otelhook.New(otel.GetTracerProvider(), otel.GetMeterProvider()), 0.01))
+//
+// The decodes are traced as children of the spans in the context of the
+// Ctx getters, e.g. GetStringCtx.
+package otelhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/mixpanel/configmanager"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer and the meter
+const InstrumentationName = "github.com/mixpanel/configmanager"
+
+type hook struct {
+	tracer trace.Tracer
+
+	loads           metric.Int64Counter
+	loadDuration    metric.Float64Histogram
+	decodeDuration  metric.Float64Histogram
+	metricsDisabled bool
+}
+
+// New returns a configmanager.Tracer recording spans with tp and the
+// duration of the loads and the decodes, and the count of the loads by
+// result, with mp. A nil mp only records spans.
+func New(tp trace.TracerProvider, mp metric.MeterProvider) configmanager.Tracer {
+	h := &hook{tracer: tp.Tracer(InstrumentationName)}
+	if mp == nil {
+		h.metricsDisabled = true
+		return h
+	}
+	meter := mp.Meter(InstrumentationName)
+	var errs [3]error
+	h.loads, errs[0] = meter.Int64Counter("configmanager.loads",
+		metric.WithDescription("Loads of the configs from their source, by result"))
+	h.loadDuration, errs[1] = meter.Float64Histogram("configmanager.load.duration",
+		metric.WithDescription("Duration of the loads of the configs"), metric.WithUnit("s"))
+	h.decodeDuration, errs[2] = meter.Float64Histogram("configmanager.decode.duration",
+		metric.WithDescription("Duration of the sampled decodes of the config values"), metric.WithUnit("s"))
+	for _, err := range errs {
+		if err != nil {
+			// the instruments are invalid, only record spans
+			h.metricsDisabled = true
+		}
+	}
+	return h
+}
+
+func (h *hook) StartLoad(source string) func(err error) {
+	attrs := []attribute.KeyValue{attribute.String("configmanager.source", source)}
+	ctx, span := h.tracer.Start(context.Background(), "configmanager.load",
+		trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attrs...))
+	start := time.Now()
+	return func(err error) {
+		result := "ok"
+		if err != nil {
+			result = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "error loading the configs")
+		}
+		span.End()
+		if h.metricsDisabled {
+			return
+		}
+		h.loadDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		h.loads.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String("configmanager.result", result))...))
+	}
+}
+
+func (h *hook) StartDecode(ctx context.Context, key string) func(err error) {
+	attrs := []attribute.KeyValue{attribute.String("configmanager.key", key)}
+	ctx, span := h.tracer.Start(ctx, "configmanager.decode",
+		trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attrs...))
+	start := time.Now()
+	return func(err error) {
+		if err != nil {
+			// decode errors may quote sensitive values
+			span.SetStatus(codes.Error, "error decoding the config value")
+		}
+		span.End()
+		if !h.metricsDisabled {
+			h.decodeDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		}
+	}
+}
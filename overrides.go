@@ -0,0 +1,107 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+// Overrides returns the overrides set by SetOverride, sorted by key.
+// The overrides of a view are the ones under its prefix.
+func (c *client) Overrides() []model.RuntimeOverride {
+	overrides := c.overrides.List()
+	if c.prefix == "" {
+		return overrides
+	}
+	trimmed := make([]model.RuntimeOverride, 0, len(overrides))
+	for _, o := range overrides {
+		if strings.HasPrefix(o.Key, c.prefix) && len(o.Key) > len(c.prefix) {
+			o.Key = o.Key[len(c.prefix):]
+			trimmed = append(trimmed, o)
+		}
+	}
+	return trimmed
+}
+
+// overrideRequest is the body of the POSTs to OverridesHandler
+type overrideRequest struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+	// TTL is a duration such as "30m"
+	TTL   string `json:"ttl"`
+	Clear bool   `json:"clear"`
+}
+
+// overrideResponse is an override served by OverridesHandler
+type overrideResponse struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+}
+
+// OverridesHandler lets on-call set and clear the overrides of c, e.g.
+// on an admin endpoint such as /configz/overrides. GET lists the
+// overrides. POST sets an override for a ttl:
+//
+//	{"key": "batch_size", "value": 100, "ttl": "30m"}
+//
+// or clears it:
+//
+//	{"key": "batch_size", "clear": true}
+//
+// and responds with the overrides. Every request is rejected with 403
+// unless authorize returns nil, e.g. after checking a token against the
+// ones of on-call. The overrides are lost when the process exits.
+func OverridesHandler(c Client, authorize func(r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || authorize(r) != nil {
+			http.Error(w, "not authorized", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req overrideRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.Key == "" {
+				http.Error(w, "key is required", http.StatusBadRequest)
+				return
+			}
+			if req.Clear {
+				c.ClearOverride(req.Key)
+				break
+			}
+			ttl, err := time.ParseDuration(req.TTL)
+			if err != nil || ttl <= 0 {
+				http.Error(w, "ttl must be a positive duration such as 30m", http.StatusBadRequest)
+				return
+			}
+			if len(req.Value) == 0 {
+				http.Error(w, "value is required", http.StatusBadRequest)
+				return
+			}
+			c.SetOverride(req.Key, req.Value, ttl)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		resp := []overrideResponse{}
+		for _, o := range c.Overrides() {
+			or := overrideResponse{Key: o.Key, Value: o.Value}
+			if !o.ExpiresAt.IsZero() {
+				expiresAt := o.ExpiresAt
+				or.ExpiresAt = &expiresAt
+			}
+			resp = append(resp, or)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
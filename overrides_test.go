@@ -0,0 +1,68 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverridesHandler(t *testing.T) {
+	c := NewTestClient()
+	defer c.Close()
+	c.SetInt64("kafka.batch_size", 10)
+
+	authorize := func(r *http.Request) error {
+		if r.Header.Get("Authorization") != "Bearer oncall" {
+			return errors.New("unknown token")
+		}
+		return nil
+	}
+	h := OverridesHandler(c.WithPrefix("kafka."), authorize)
+	do := func(method, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/configz/overrides", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusForbidden, do("POST", `{"key": "batch_size", "value": 1, "ttl": "1m"}`, "").Code)
+	assert.Equal(t, http.StatusForbidden, do("GET", "", "intruder").Code)
+	assert.EqualValues(t, 10, c.GetInt64("kafka.batch_size", 0))
+
+	assert.Equal(t, http.StatusBadRequest, do("POST", `{"key": "batch_size", "value": 1}`, "oncall").Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", `{"value": 1, "ttl": "1m"}`, "oncall").Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", `{"key": "batch_size", "ttl": "1m"}`, "oncall").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do("DELETE", "", "oncall").Code)
+
+	rec := do("POST", `{"key": "batch_size", "value": 100, "ttl": "30m"}`, "oncall")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.EqualValues(t, 100, c.GetInt64("kafka.batch_size", 0))
+	var overrides []overrideResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &overrides))
+	require.Len(t, overrides, 1)
+	assert.Equal(t, "batch_size", overrides[0].Key)
+	assert.Equal(t, "100", string(overrides[0].Value))
+	require.NotNil(t, overrides[0].ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), *overrides[0].ExpiresAt, time.Minute)
+	assert.Len(t, c.Overrides(), 1)
+
+	rec = do("GET", "", "oncall")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &overrides))
+	assert.Len(t, overrides, 1)
+
+	rec = do("POST", `{"key": "batch_size", "clear": true}`, "oncall")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]\n", rec.Body.String())
+	assert.EqualValues(t, 10, c.GetInt64("kafka.batch_size", 0))
+}
@@ -0,0 +1,152 @@
+package configmanager
+
+import (
+	"sync"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+// ParsedType is the type a value is parsed into by the getters
+type ParsedType int
+
+const (
+	// ParsedProjectList is parsed by IsProjectWhitelisted,
+	// IsProjectBlacklisted and GetProjectWhitelist
+	ParsedProjectList ParsedType = iota + 1
+	// ParsedMemberList is parsed by IsTokenWhitelisted,
+	// IsMemberWhitelisted, IsTokenBlacklisted and GetTokenWhitelist
+	ParsedMemberList
+	// ParsedRollout is parsed by GetRolloutFraction
+	// and the IsFeatureEnabled methods
+	ParsedRollout
+	// ParsedFlag is parsed by EvaluateFlag and IsEnabledForProject
+	ParsedFlag
+)
+
+// WithPreparse parses the values of the keys into their type in the
+// background after every reload that changes them, instead of on their
+// first read, so that large whitelists are not parsed on the path of a
+// request. The keys parsed by the getters are also parsed in the
+// background after they change, with the type they were last parsed into.
+func WithPreparse(types map[string]ParsedType) Option {
+	return func(o *options) {
+		if o.preparseTypes == nil {
+			o.preparseTypes = make(map[string]ParsedType)
+		}
+		for key, typ := range types {
+			o.preparseTypes[key] = typ
+		}
+	}
+}
+
+// preparser parses the values changed by the reloads in a goroutine
+type preparser struct {
+	mu      sync.Mutex
+	types   map[string]ParsedType
+	pending map[string]ParsedType
+	notify  chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	// parse parses the value of the full key into typ
+	parse func(key string, typ ParsedType)
+}
+
+// newPreparser starts parsing the keys of types, and then the keys of
+// types and the keys learned changed by the reloads of sm, with parse.
+// The returned func stops it.
+func newPreparser(sm model.StateManager, types map[string]ParsedType, parse func(key string, typ ParsedType)) (*preparser, func()) {
+	p := &preparser{
+		types:   make(map[string]ParsedType),
+		pending: make(map[string]ParsedType),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		parse:   parse,
+	}
+	// the keys of types are parsed from the first state too
+	for key, typ := range types {
+		p.types[key] = typ
+		p.pending[key] = typ
+	}
+	p.notify <- struct{}{}
+	unregister := sm.OnDiff(p.reloaded)
+	p.wg.Add(1)
+	go p.run()
+	return p, func() {
+		unregister()
+		close(p.done)
+		p.wg.Wait()
+	}
+}
+
+// learn records that key was parsed into typ by a getter
+func (p *preparser) learn(key string, typ ParsedType) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.types[key] = typ
+}
+
+func (p *preparser) reloaded(d model.Diff) {
+	p.mu.Lock()
+	for _, changes := range [][]model.KeyChange{d.Added, d.Changed} {
+		for _, change := range changes {
+			if typ, ok := p.types[change.Key]; ok {
+				p.pending[change.Key] = typ
+			}
+		}
+	}
+	empty := len(p.pending) == 0
+	p.mu.Unlock()
+	if empty {
+		return
+	}
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (p *preparser) run() {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.notify:
+		case <-p.done:
+			return
+		}
+		p.mu.Lock()
+		pending := p.pending
+		p.pending = make(map[string]ParsedType)
+		p.mu.Unlock()
+		for key, typ := range pending {
+			select {
+			case <-p.done:
+				return
+			default:
+			}
+			p.parse(key, typ)
+		}
+	}
+}
+
+// preparse parses the value of key into typ like the getters do, errors
+// are left for the getters to report
+func (c *client) preparse(key string, typ ParsedType) {
+	switch typ {
+	case ParsedProjectList:
+		c.getProjectList(key)
+	case ParsedMemberList:
+		c.getMemberList(key)
+	case ParsedRollout:
+		c.getRamp(key)
+	case ParsedFlag:
+		c.getFlagRule(key)
+	}
+}
+
+// learnParsed records the type key was parsed into, if preparsing
+func (c *client) learnParsed(key string, typ ParsedType) {
+	if c.preparser != nil {
+		c.preparser.learn(c.prefix+key, typ)
+	}
+}
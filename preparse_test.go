@@ -0,0 +1,75 @@
+package configmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitParsed waits until the value of key is parsed into its type
+func waitParsed(t *testing.T, c *TestClient, key string, typ interface{}) interface{} {
+	var pv interface{}
+	require.Eventually(t, func() bool {
+		config, err := c.version.sm.GetKey(key)
+		if err != nil {
+			return false
+		}
+		pv = c.version.sm.GetParsedValue(config)
+		return pv != nil
+	}, time.Second, time.Millisecond)
+	assert.IsType(t, typ, pv)
+	return pv
+}
+
+func TestPreparse(t *testing.T) {
+	c := NewTestClient(WithPreparse(map[string]ParsedType{
+		"projects": ParsedProjectList,
+		"tokens":   ParsedMemberList,
+		"rollout":  ParsedRollout,
+	}))
+	defer c.Close()
+
+	c.SetProjectsWhitelist("projects", 1, 2)
+	list := waitParsed(t, c, "projects", &projectList{}).(*projectList)
+	assert.True(t, list.contains(2, time.Now()))
+
+	c.SetMembersWhitelist("tokens", "a")
+	waitParsed(t, c, "tokens", &memberList{})
+	c.SetFloat64("rollout", 0.5)
+	waitParsed(t, c, "rollout", Ramp{})
+
+	// reads do not parse again
+	assert.True(t, c.IsProjectWhitelisted("projects", 1, false))
+	config, err := c.version.sm.GetKey("projects")
+	require.NoError(t, err)
+	assert.Same(t, list, c.version.sm.GetParsedValue(config))
+
+	// changed values are parsed again
+	c.SetProjectsWhitelist("projects", 3)
+	list = waitParsed(t, c, "projects", &projectList{}).(*projectList)
+	assert.True(t, list.contains(3, time.Now()))
+	assert.False(t, list.contains(1, time.Now()))
+}
+
+func TestPreparseLearned(t *testing.T) {
+	c := NewTestClient(WithPreparse(nil))
+	defer c.Close()
+
+	c.SetMembersWhitelist("tokens", "a")
+	assert.True(t, c.IsTokenWhitelisted("tokens", "a", false))
+
+	// the type of the last read is reused
+	c.SetMembersWhitelist("tokens", "b")
+	list := waitParsed(t, c, "tokens", &memberList{}).(*memberList)
+	assert.True(t, list.contains("b"))
+
+	// not read keys are not parsed
+	c.SetProjectsWhitelist("projects", 1)
+	c.SetProjectsWhitelist("projects", 2)
+	time.Sleep(10 * time.Millisecond)
+	config, err := c.version.sm.GetKey("projects")
+	require.NoError(t, err)
+	assert.Nil(t, c.version.sm.GetParsedValue(config))
+}
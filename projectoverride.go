@@ -0,0 +1,43 @@
+package configmanager
+
+import (
+	"encoding/json"
+
+	"github.com/mixpanel/obs/obserr"
+)
+
+// projectOverrides are the entries of a config keyed by
+// project id, kept raw until the entry of a project is read
+type projectOverrides map[int64]json.RawMessage
+
+// GetProjectOverride unmarshals the entry of projectID in key, a map
+// keyed by project id, into dst, e.g. for per-project rate limits:
+//
+//	{"123": {"events_per_sec": 1000}, "456": {"events_per_sec": 50}}
+//
+// It returns false if key has no entry for projectID. The map is
+// parsed once per value of key, only the entry is unmarshalled on
+// every call.
+func (c *client) GetProjectOverride(key string, projectID int64, dst interface{}) (bool, error) {
+	config, err := c.sm.GetKey(key)
+	if err != nil {
+		return false, obserr.Annotate(err, "GetProjectOverride: error getting the key").Set("key", key)
+	}
+	overrides, ok := c.sm.GetParsedValue(config).(projectOverrides)
+	if !ok {
+		overrides = make(projectOverrides)
+		if err := c.decode(key, config.RawValue, &overrides); err != nil {
+			return false, obserr.Annotate(err, "GetProjectOverride: error unmarshalling the key").Set("key", key)
+		}
+		c.sm.SetParsedValue(config, overrides)
+	}
+	raw, ok := overrides[projectID]
+	if !ok {
+		return false, nil
+	}
+	if err := c.unmarshalFn(raw, dst); err != nil {
+		return false, obserr.Annotate(err, "GetProjectOverride: error unmarshalling the entry").
+			Set("key", key).Set("project_id", projectID)
+	}
+	return true, nil
+}
@@ -0,0 +1,38 @@
+package configmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProjectOverride(t *testing.T) {
+	cu := &countUnmarshal{}
+	c := NewTestClient(WithUnmarshal(cu.unmarshal)).
+		SetRaw("rate_limits", []byte(`{"123": {"events_per_sec": 1000}, "456": {"events_per_sec": "many"}}`)).
+		SetRaw("invalid", []byte(`{"abc": {}}`))
+
+	var limit struct {
+		EventsPerSec int64 `json:"events_per_sec"`
+	}
+	for i := 0; i < 3; i++ {
+		ok, err := c.GetProjectOverride("rate_limits", 123, &limit)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.EqualValues(t, 1000, limit.EventsPerSec)
+	}
+	// the map is parsed once, then only the entry
+	assert.EqualValues(t, 4, cu.count())
+
+	ok, err := c.GetProjectOverride("rate_limits", 789, &limit)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = c.GetProjectOverride("rate_limits", 456, &limit)
+	assert.Error(t, err)
+	_, err = c.GetProjectOverride("invalid", 123, &limit)
+	assert.Error(t, err)
+	_, err = c.GetProjectOverride("missing", 123, &limit)
+	assert.True(t, IsNotFound(err))
+}
@@ -0,0 +1,35 @@
+// Package protoconfig reads the configs of a configmanager client into
+// protobuf messages, in its own package so that the importers of
+// configmanager do not depend on protobuf:
+//
+//	var limits pb.Limits
+//	err := protoconfig.Get(cm, "limits", &limits)
+package protoconfig
+
+import (
+	"reflect"
+
+	"github.com/mixpanel/configmanager"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Get unmarshals the value of key into msg using the JSON mapping
+// of protobuf, or the decoder registered for key if any. The parsed
+// message is cached per type of message until the value changes.
+func Get(c configmanager.RawReader, key string, msg proto.Message) error {
+	parsed, err := c.GetCached(key, reflect.TypeOf(msg), func(raw []byte, decode configmanager.DecodeFunc) (interface{}, error) {
+		parsed := msg.ProtoReflect().New().Interface()
+		if decode != nil {
+			return parsed, decode(raw, parsed)
+		}
+		return parsed, protojson.Unmarshal(raw, parsed)
+	})
+	if err != nil {
+		return err
+	}
+	proto.Reset(msg)
+	proto.Merge(msg, parsed.(proto.Message))
+	return nil
+}
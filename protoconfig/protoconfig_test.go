@@ -0,0 +1,37 @@
+package protoconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestGet(t *testing.T) {
+	c := configmanager.NewTestClient().
+		SetString("timeout", "1.5s").
+		SetRaw("limits", []byte(`{"qps": 10}`))
+
+	var timeout durationpb.Duration
+	require.NoError(t, Get(c, "timeout", &timeout))
+	assert.Equal(t, 1500*time.Millisecond, timeout.AsDuration())
+
+	// cached messages are not shared with the caller
+	timeout.Seconds = 10
+	var again durationpb.Duration
+	require.NoError(t, Get(c, "timeout", &again))
+	assert.Equal(t, 1500*time.Millisecond, again.AsDuration())
+
+	var limits structpb.Struct
+	require.NoError(t, Get(c, "limits", &limits))
+	assert.EqualValues(t, 10, limits.Fields["qps"].GetNumberValue())
+
+	assert.Error(t, Get(c, "limits", &timeout))
+	assert.True(t, configmanager.IsNotFound(Get(c, "missing", &timeout)))
+}
@@ -0,0 +1,98 @@
+package configmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mixpanel/obs/obserr"
+)
+
+// Ramp is a rollout fraction going linearly from From to To
+// over Duration starting at Start, e.g.
+// {"start": "2020-11-27T08:00:00Z", "from": 0.01, "to": 0.5, "duration": "12h"}
+type Ramp struct {
+	Start    time.Time
+	From     float64
+	To       float64
+	Duration time.Duration
+	// Salt re-randomizes the projects and ids enabled by
+	// the sticky rollouts when changed. Only the object
+	// form can have a salt, e.g. {"to": 0.5, "salt": "v2"}.
+	Salt string
+}
+
+// FractionAt returns the rollout fraction at now
+func (r Ramp) FractionAt(now time.Time) float64 {
+	if now.Before(r.Start) {
+		return r.From
+	}
+	elapsed := now.Sub(r.Start)
+	if r.Duration <= 0 || elapsed >= r.Duration {
+		return r.To
+	}
+	return r.From + (r.To-r.From)*float64(elapsed)/float64(r.Duration)
+}
+
+// UnmarshalJSON also accepts a plain number
+// for a constant rollout fraction
+func (r *Ramp) UnmarshalJSON(data []byte) error {
+	var fraction float64
+	if err := json.Unmarshal(data, &fraction); err == nil {
+		*r = Ramp{From: fraction, To: fraction}
+		return nil
+	}
+	var val struct {
+		Start    time.Time `json:"start"`
+		From     float64   `json:"from"`
+		To       *float64  `json:"to"`
+		Duration string    `json:"duration"`
+		Salt     string    `json:"salt"`
+	}
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+	if val.To == nil {
+		return errors.New("ramp without a target fraction")
+	}
+	var duration time.Duration
+	if val.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(val.Duration); err != nil {
+			return obserr.Annotate(err, "invalid ramp duration").Set("duration", val.Duration)
+		}
+	}
+	*r = Ramp{Start: val.Start, From: val.From, To: *val.To, Duration: duration, Salt: val.Salt}
+	return nil
+}
+
+func (c *client) getRamp(key string) (Ramp, error) {
+	config, err := c.sm.GetKey(key)
+	if err != nil {
+		return Ramp{}, obserr.Annotate(err, "getRamp: error getting key from sm")
+	}
+	if pv, ok := c.sm.GetParsedValue(config).(Ramp); ok {
+		return pv, nil
+	}
+	var val Ramp
+	if err := c.decode(key, config.RawValue, &val); err != nil {
+		return Ramp{}, obserr.Annotate(err, "getRamp: error unmarshaling value")
+	}
+	c.learnParsed(key, ParsedRollout)
+	c.sm.SetParsedValue(config, val)
+	return val, nil
+}
+
+// GetRolloutFraction returns the rollout fraction of key at now: either
+// a plain number or the current fraction of a Ramp. The IsFeatureEnabled
+// methods use the rollout fraction at the current time.
+func (c *client) GetRolloutFraction(key string, now time.Time, defaultVal float64) float64 {
+	fs := c.fr.ScopeName("get_rollout_fraction").WithSpan(context.Background())
+	val, err := c.getRamp(key)
+	if err != nil {
+		c.logErrGet(err, key, defaultVal, fs)
+		return defaultVal
+	}
+	return val.FractionAt(now)
+}
@@ -0,0 +1,54 @@
+package configmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRamp(t *testing.T) {
+	start := time.Date(2020, 11, 27, 8, 0, 0, 0, time.UTC)
+	c := NewTestClient().
+		SetRaw("ramp", []byte(`{"start": "2020-11-27T08:00:00Z", "from": 0.1, "to": 0.5, "duration": "4h"}`)).
+		SetFloat64("constant", 0.3).
+		SetRaw("done", []byte(`{"start": "2000-01-01T00:00:00Z", "from": 0, "to": 1, "duration": "1h"}`))
+
+	assert.Equal(t, 0.1, c.GetRolloutFraction("ramp", start.Add(-time.Hour), 0))
+	assert.Equal(t, 0.1, c.GetRolloutFraction("ramp", start, 0))
+	assert.InDelta(t, 0.2, c.GetRolloutFraction("ramp", start.Add(time.Hour), 0), 1e-9)
+	assert.Equal(t, 0.5, c.GetRolloutFraction("ramp", start.Add(5*time.Hour), 0))
+	assert.Equal(t, 0.3, c.GetRolloutFraction("constant", start, 0))
+	assert.Equal(t, 0.7, c.GetRolloutFraction("missing", start, 0.7))
+
+	// the IsFeatureEnabled methods follow the ramp
+	assert.True(t, c.IsFeatureEnabled("done", false))
+	assert.True(t, c.IsFeatureEnabledForProject("done", 1, false))
+}
+
+func TestRampWithClock(t *testing.T) {
+	start := time.Date(2020, 11, 27, 8, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	c := NewTestClient(WithClock(clk)).
+		SetRaw("ramp", []byte(`{"start": "2020-11-27T08:00:00Z", "from": 0, "to": 1, "duration": "4h"}`))
+	defer c.Close()
+
+	_, reason := c.EvaluateFlagForID("ramp", "id", false)
+	assert.Equal(t, 0.0, reason.Fraction)
+	clk.Advance(time.Hour)
+	_, reason = c.EvaluateFlagForID("ramp", "id", false)
+	assert.InDelta(t, 0.25, reason.Fraction, 1e-9)
+	clk.Advance(3 * time.Hour)
+	assert.True(t, c.IsFeatureEnabledForID("ramp", "id", false))
+
+	// the overrides expire with the clock too
+	c.SetOverride("ramp", []byte("0"), time.Minute)
+	assert.False(t, c.IsFeatureEnabledForID("ramp", "id", true))
+	clk.Advance(time.Minute)
+	enabled, reason := c.EvaluateFlagForID("ramp", "id", false)
+	require.Equal(t, ReasonRollout, reason.Kind)
+	assert.True(t, enabled)
+}
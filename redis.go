@@ -0,0 +1,26 @@
+package configmanager
+
+import (
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// NewClientFromRedis returns a client reading the configs of scope from
+// the Redis hash at model.RedisKey(scope), reloaded every time a message
+// is published on model.RedisChannel(scope). Writers must publish on the
+// channel after updating the hash.
+func NewClientFromRedis(client model.RedisClient, scope string, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	o := newOptions(opts)
+	fr = fr.ScopeName("config_manager")
+	sm, err := model.NewRedisStateManager(client, scope, fr, o.smOpts...)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating redis config manager client").Set("scope", scope)
+	}
+	c, err := newCheckedClient(o.withOverrides(sm, scope), fr, o)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating redis config manager client").Set("scope", scope)
+	}
+	return c, nil
+}
@@ -0,0 +1,44 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// reloadResult is the response of ReloadHandler
+type reloadResult struct {
+	Generation uint64    `json:"generation"`
+	Hash       string    `json:"hash"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	// Changed is true if the reload changed the configs served
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ReloadHandler reloads the configs of c on POST, e.g. on an admin
+// endpoint such as /configz/reload when a file event is suspected to be
+// missed, and responds with the Version of the configs served after the
+// reload and the error of the reload, if any, with a 500.
+func ReloadHandler(c Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		before, _, _ := c.Version()
+		err := c.Reload()
+		var res reloadResult
+		res.Generation, res.Hash, res.LoadedAt = c.Version()
+		res.Changed = res.Generation != before
+		status := http.StatusOK
+		if err != nil {
+			res.Error = err.Error()
+			status = http.StatusInternalServerError
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(res)
+	})
+}
@@ -0,0 +1,104 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+	"github.com/mixpanel/configmanager/testutil"
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadHandler(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	c, err := NewClient(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	defer c.Close()
+
+	post := func() (int, reloadResult) {
+		rec := httptest.NewRecorder()
+		ReloadHandler(c).ServeHTTP(rec, httptest.NewRequest("POST", "/configz/reload", nil))
+		var res reloadResult
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return rec.Code, res
+	}
+
+	gen, hash, _ := c.Version()
+	code, res := post()
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, res.Changed)
+	assert.Equal(t, gen, res.Generation)
+	assert.Equal(t, hash, res.Hash)
+
+	filePath := path.Join(dir, ns, "configs.json")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`[{"key": "foo", "value": 2}]`), 0777))
+	code, res = post()
+	assert.Equal(t, http.StatusOK, code)
+	// the watcher may have reloaded the file first
+	assert.True(t, res.Generation > gen)
+	assert.EqualValues(t, 2, c.GetInt64("foo", 0))
+	gen, _, _ = c.Version()
+	assert.Equal(t, gen, res.Generation)
+
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`[{"key": "foo", "val`), 0777))
+	code, res = post()
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.NotEmpty(t, res.Error)
+	assert.Equal(t, gen, res.Generation)
+
+	rec := httptest.NewRecorder()
+	ReloadHandler(c).ServeHTTP(rec, httptest.NewRequest("GET", "/configz/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestReloadFromCallback(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	c, err := NewClient(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+
+	changes := make(chan string, 10)
+	c.Subscribe("foo", func(old, new []byte) {
+		// the load that notified is done, Reload does not wait for it
+		assert.NoError(t, c.Reload())
+		changes <- string(new)
+	})
+
+	filePath := path.Join(dir, ns, "configs.json")
+	require.NoError(t, ioutil.WriteFile(filePath, []byte(`[{"key": "foo", "value": 2}]`), 0777))
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- c.Reload() }()
+	select {
+	case err := <-reloaded:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload from the callback deadlocked")
+	}
+	assert.Equal(t, "2", <-changes)
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hung")
+	}
+}
@@ -0,0 +1,47 @@
+package configmanager
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// ErrMissingRequiredKeys is returned by NewClient when
+// keys declared with WithRequiredKeys are not in the scope
+var ErrMissingRequiredKeys = errors.New("Required configs are missing")
+
+func (c *client) missingRequiredKeys() []string {
+	var missing []string
+	for _, key := range c.opts.requiredKeys {
+		if _, err := c.lookup(key); err != nil {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+func (c *client) checkRequiredKeys() error {
+	missing := c.missingRequiredKeys()
+	if len(missing) == 0 {
+		return nil
+	}
+	return obserr.Annotate(ErrMissingRequiredKeys, "checkRequiredKeys: keys not found").Set("keys", missing)
+}
+
+// watchRequiredKeys reports required keys that go
+// missing after a reload
+func (c *client) watchRequiredKeys() {
+	if len(c.opts.requiredKeys) == 0 {
+		return
+	}
+	cancel := c.sm.OnReload(func() {
+		if err := c.checkRequiredKeys(); err != nil {
+			fs := c.fr.ScopeName("required_keys").WithSpan(context.Background())
+			fs.Incr("missing_required_keys")
+			fs.Critical("config_client_missing_required_keys", "Required configs are missing after reload", obs.Vals{}.WithError(err))
+		}
+	})
+	c.onClose = append(c.onClose, cancel)
+}
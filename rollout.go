@@ -0,0 +1,75 @@
+package configmanager
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+)
+
+// bucket hashes key, salt and id into [0, 1). The same key,
+// salt and id always land in the same bucket, and the buckets
+// of the ids of a key are independent of the ones of other
+// keys or salts. An empty salt is not hashed.
+func bucket(key, salt, id string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	if salt != "" {
+		h.Write([]byte(salt))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(id))
+	// fnv barely mixes the last bytes into the high bits,
+	// finish with the finalizer of murmur3
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return float64(x>>11) / (1 << 53)
+}
+
+// rollSticky is rollDie with the die replaced by the bucket of id
+func (c *client) rollSticky(key, id string, enabledByDefault bool) bool {
+	defaultValue := float64(0)
+	if enabledByDefault {
+		defaultValue = 1.0
+	}
+	ramp, err := c.getRamp(key)
+	if err != nil {
+		fs := c.fr.ScopeName("get_rollout_fraction").WithSpan(context.Background())
+		c.logErrGet(err, key, defaultValue, fs)
+		ramp = Ramp{From: defaultValue, To: defaultValue}
+	}
+	result := bucket(key, ramp.Salt, id) < ramp.FractionAt(c.opts.now())
+	c.expose(key, id, result)
+	return result
+}
+
+// expose calls the exposure hook, if any, for
+// the sampled evaluations
+func (c *client) expose(key, entity string, result bool) {
+	if c.opts.exposureHook == nil {
+		return
+	}
+	if rate := c.opts.exposureSampleRate; rate < 1 && c.rng.Float64() >= rate {
+		return
+	}
+	c.opts.exposureHook(key, entity, result)
+}
+
+// IsFeatureEnabledForProject returns true for the fraction of the
+// projects configured in key, like IsFeatureEnabled, but always with
+// the same result for a project as long as the fraction does not
+// change. Raising the fraction only enables more projects.
+func (c *client) IsFeatureEnabledForProject(key string, projectID int64, enabledByDefault bool) bool {
+	return c.rollSticky(key, strconv.FormatInt(projectID, 10), enabledByDefault)
+}
+
+// IsFeatureEnabledForID is IsFeatureEnabledForProject for any id, so
+// that rollouts can be sticky per user, token or device. Projects and
+// ids with the same digits land in the same bucket.
+func (c *client) IsFeatureEnabledForID(key string, id string, enabledByDefault bool) bool {
+	return c.rollSticky(key, id, enabledByDefault)
+}
@@ -0,0 +1,175 @@
+package configmanager
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFeatureEnabledForProject(t *testing.T) {
+	c := NewTestClient().
+		SetFloat64("half", 0.5).
+		SetFloat64("off", 0).
+		SetFloat64("on", 1)
+
+	enabled := 0
+	for projectID := int64(0); projectID < 10000; projectID++ {
+		flag := c.IsFeatureEnabledForProject("half", projectID, false)
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, flag, c.IsFeatureEnabledForProject("half", projectID, false))
+		}
+		if flag {
+			enabled++
+		}
+		assert.False(t, c.IsFeatureEnabledForProject("off", projectID, true))
+		assert.True(t, c.IsFeatureEnabledForProject("on", projectID, false))
+	}
+	assert.InDelta(t, 5000, enabled, 300)
+
+	assert.True(t, c.IsFeatureEnabledForProject("missing", 1, true))
+	assert.False(t, c.IsFeatureEnabledForProject("missing", 1, false))
+
+	// raising the fraction keeps the enabled projects
+	var before []int64
+	for projectID := int64(0); projectID < 1000; projectID++ {
+		if c.IsFeatureEnabledForProject("half", projectID, false) {
+			before = append(before, projectID)
+		}
+	}
+	c.SetFloat64("half", 0.7)
+	for _, projectID := range before {
+		assert.True(t, c.IsFeatureEnabledForProject("half", projectID, false))
+	}
+}
+
+func TestIsFeatureEnabledForID(t *testing.T) {
+	c := NewTestClient().SetFloat64("half", 0.5)
+
+	enabled := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("user-%d", i)
+		flag := c.IsFeatureEnabledForID("half", id, false)
+		assert.Equal(t, flag, c.IsFeatureEnabledForID("half", id, false))
+		if flag {
+			enabled++
+		}
+	}
+	assert.InDelta(t, 5000, enabled, 300)
+	assert.Equal(t, c.IsFeatureEnabledForProject("half", 42, false), c.IsFeatureEnabledForID("half", "42", false))
+}
+
+func TestExposureHook(t *testing.T) {
+	type exposure struct {
+		key, entity string
+		result      bool
+	}
+	var exposures []exposure
+	c := NewTestClient(WithExposureHook(func(key, entity string, result bool) {
+		exposures = append(exposures, exposure{key, entity, result})
+	})).SetFloat64("on", 1).SetRaw("composite", []byte(`{"blacklist": [1]}`))
+
+	c.IsFeatureEnabled("on", false)
+	c.IsFeatureEnabledForProject("on", 42, false)
+	c.IsFeatureEnabledForID("on", "user-1", false)
+	c.IsEnabledForProject("composite", 1, true)
+	c.EvaluateFlag("composite", 1, true)
+	assert.Equal(t, []exposure{
+		{"on", "", true},
+		{"on", "42", true},
+		{"on", "user-1", true},
+		{"composite", "1", false},
+	}, exposures)
+
+	sampled := 0
+	c = NewTestClient(WithExposureSampleRate(0.1), WithExposureHook(func(string, string, bool) {
+		sampled++
+	})).SetFloat64("on", 1)
+	for i := 0; i < 10000; i++ {
+		c.IsFeatureEnabled("on", false)
+	}
+	assert.InDelta(t, 1000, sampled, 200)
+}
+
+// TestExposureHookConcurrent draws the sampling of the exposures from
+// concurrent evaluations, go test -race catches an unguarded source
+func TestExposureHookConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	sampled := 0
+	c := NewTestClient(WithExposureSampleRate(0.5), WithExposureHook(func(string, string, bool) {
+		mu.Lock()
+		sampled++
+		mu.Unlock()
+	})).SetFloat64("on", 1)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				c.IsFeatureEnabledForProject("on", int64(g*500+i), false)
+				c.IsFeatureEnabled("on", false)
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.InDelta(t, 4000, sampled, 400)
+}
+
+func TestBucketingSalt(t *testing.T) {
+	c := NewTestClient().
+		SetFloat64("a", 0.5).
+		SetRaw("salted", []byte(`{"to": 0.5, "salt": "v2"}`)).
+		SetRaw("composite", []byte(`{"percent": 0.5, "salt": "v2"}`))
+
+	same := 0
+	for projectID := int64(0); projectID < 1000; projectID++ {
+		salted := c.IsFeatureEnabledForProject("salted", projectID, false)
+		if salted == c.IsFeatureEnabledForProject("a", projectID, false) {
+			same++
+		}
+		_, reason := c.EvaluateFlag("composite", projectID, false)
+		assert.Equal(t, bucket("composite", "v2", strconv.FormatInt(projectID, 10)), reason.Bucket)
+	}
+	// independent populations agree about half of the time
+	assert.InDelta(t, 500, same, 100)
+}
+
+// lockedRnd is a single source guarded by a mutex, like
+// the evaluations used before the pooled sources
+type lockedRnd struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func (l *lockedRnd) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rnd.Float64()
+}
+
+// BenchmarkIsFeatureEnabledParallel compares the evaluations with the
+// default source to the ones with a locked source, with -cpu 1,8,64
+func BenchmarkIsFeatureEnabledParallel(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		rng  rnd
+	}{
+		{"pooled", pooledRnd{}},
+		{"locked", &lockedRnd{rnd: rand.New(rand.NewSource(1))}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c := NewTestClient().SetFloat64("half", 0.5)
+			c.rng = bc.rng
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					c.IsFeatureEnabled("half", false)
+				}
+			})
+		})
+	}
+}
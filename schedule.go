@@ -0,0 +1,74 @@
+package configmanager
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mixpanel/obs/obserr"
+)
+
+// ScheduledFlag is the value of a flag that is only active
+// between Start and End. A zero Start or End is unbounded.
+type ScheduledFlag struct {
+	Enabled bool      `json:"enabled"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+// ActiveAt returns true if the flag is enabled and now
+// is within [Start, End)
+func (f ScheduledFlag) ActiveAt(now time.Time) bool {
+	if !f.Enabled {
+		return false
+	}
+	if !f.Start.IsZero() && now.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && !now.Before(f.End) {
+		return false
+	}
+	return true
+}
+
+// UnmarshalJSON also accepts a plain boolean
+// for a flag without a schedule
+func (f *ScheduledFlag) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*f = ScheduledFlag{Enabled: enabled}
+		return nil
+	}
+	type scheduledFlag ScheduledFlag
+	return json.Unmarshal(data, (*scheduledFlag)(f))
+}
+
+func (c *client) getScheduledFlag(key string) (ScheduledFlag, error) {
+	config, err := c.sm.GetKey(key)
+	if err != nil {
+		return ScheduledFlag{}, obserr.Annotate(err, "getScheduledFlag: error getting key from sm")
+	}
+	if pv, ok := c.sm.GetParsedValue(config).(ScheduledFlag); ok {
+		return pv, nil
+	}
+	var val ScheduledFlag
+	if err := c.decode(key, config.RawValue, &val); err != nil {
+		return ScheduledFlag{}, obserr.Annotate(err, "getScheduledFlag: error unmarshaling value")
+	}
+	c.sm.SetParsedValue(config, val)
+	return val, nil
+}
+
+// IsFeatureActive returns true if the flag in key is enabled and now is
+// within its schedule, e.g. {"enabled": true, "start": "2020-11-27T08:00:00Z",
+// "end": "2020-11-28T08:00:00Z"} for a maintenance window. Start and end are
+// RFC 3339 times and are both optional. A plain boolean is also accepted.
+func (c *client) IsFeatureActive(key string, now time.Time, defaultVal bool) bool {
+	fs := c.fr.ScopeName("is_feature_active").WithSpan(context.Background())
+	val, err := c.getScheduledFlag(key)
+	if err != nil {
+		c.logErrGet(err, key, defaultVal, fs)
+		return defaultVal
+	}
+	return val.ActiveAt(now)
+}
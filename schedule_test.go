@@ -0,0 +1,27 @@
+package configmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFeatureActive(t *testing.T) {
+	c := NewTestClient().
+		SetRaw("maintenance", []byte(`{"enabled": true, "start": "2020-11-27T08:00:00Z", "end": "2020-11-28T08:00:00Z"}`)).
+		SetRaw("launch", []byte(`{"enabled": true, "start": "2020-11-27T08:00:00Z"}`)).
+		SetRaw("disabled", []byte(`{"enabled": false}`)).
+		SetBoolean("plain", true).
+		SetString("invalid", "yes")
+
+	start := time.Date(2020, 11, 27, 8, 0, 0, 0, time.UTC)
+	assert.False(t, c.IsFeatureActive("maintenance", start.Add(-time.Second), false))
+	assert.True(t, c.IsFeatureActive("maintenance", start, false))
+	assert.False(t, c.IsFeatureActive("maintenance", start.Add(24*time.Hour), true))
+	assert.True(t, c.IsFeatureActive("launch", start.Add(365*24*time.Hour), false))
+	assert.False(t, c.IsFeatureActive("disabled", start, true))
+	assert.True(t, c.IsFeatureActive("plain", start, false))
+	assert.True(t, c.IsFeatureActive("invalid", start, true))
+	assert.False(t, c.IsFeatureActive("missing", start, false))
+}
@@ -0,0 +1,110 @@
+package configmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+var errNotStructPtr = errors.New("UnmarshalScope expects a non-nil pointer to a struct")
+
+// UnmarshalScope fills the fields of the struct pointed to by dst.
+// Fields are mapped to config keys with the `config:"key"` tag and
+// fields without the tag are left untouched. When a key is missing
+// the field is set from the `default:"..."` tag, which is taken
+// verbatim for string fields and parsed as JSON otherwise. dst is
+// only written once every tagged field was bound successfully.
+//
+//	type myConfigs struct {
+//		Timeout int64  `config:"timeout_secs" default:"5"`
+//		Region  string `config:"region" default:"us"`
+//	}
+func (c *client) UnmarshalScope(dst interface{}) error {
+	return c.bindScope(dst, nopLocker{})
+}
+
+// bindScope binds a copy of *dst and swaps it in holding mu
+func (c *client) bindScope(dst interface{}, mu sync.Locker) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errNotStructPtr
+	}
+	mu.Lock()
+	nv := reflect.New(v.Elem().Type()).Elem()
+	nv.Set(v.Elem())
+	mu.Unlock()
+	if err := c.bindStruct(nv); err != nil {
+		return err
+	}
+	mu.Lock()
+	v.Elem().Set(nv)
+	mu.Unlock()
+	return nil
+}
+
+type nopLocker struct{}
+
+func (nopLocker) Lock()   {}
+func (nopLocker) Unlock() {}
+
+func (c *client) bindStruct(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, ok := field.Tag.Lookup("config")
+		if !ok || key == "" || key == "-" || field.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		fv.Set(reflect.Zero(field.Type))
+		if err := c.bindField(key, field, fv); err != nil {
+			return obserr.Annotate(err, "UnmarshalScope: error binding field").Set(
+				"key", key,
+				"field", field.Name,
+			)
+		}
+	}
+	return nil
+}
+
+func (c *client) bindField(key string, field reflect.StructField, fv reflect.Value) error {
+	err := c.Unmarshal(key, fv.Addr().Interface())
+	if err == nil {
+		return nil
+	}
+	if !IsNotFound(err) {
+		return err
+	}
+	def, ok := field.Tag.Lookup("default")
+	if !ok {
+		return nil
+	}
+	if fv.Kind() == reflect.String {
+		fv.SetString(def)
+		return nil
+	}
+	return json.Unmarshal([]byte(def), fv.Addr().Interface())
+}
+
+// BindScope does UnmarshalScope on dst and then keeps re-binding it
+// every time the configs are reloaded. mu is held while dst is written
+// so readers holding mu always see a fully bound struct. Errors on
+// reload are logged and leave dst unchanged. Call cancel to stop
+// re-binding.
+func (c *client) BindScope(dst interface{}, mu sync.Locker) (func(), error) {
+	if err := c.bindScope(dst, mu); err != nil {
+		return nil, err
+	}
+	cancel := c.sm.OnReload(func() {
+		if err := c.bindScope(dst, mu); err != nil {
+			fs := c.fr.ScopeName("bind_scope").WithSpan(context.Background())
+			fs.Warn("config_client_bind_scope", "Error re-binding scope on reload", obs.Vals{}.WithError(err))
+		}
+	})
+	return cancel, nil
+}
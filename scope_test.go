@@ -0,0 +1,75 @@
+package configmanager
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scopeStruct struct {
+	Timeout  int64            `config:"timeout_secs" default:"5"`
+	Region   string           `config:"region" default:"us"`
+	Ratio    float64          `config:"ratio"`
+	Projects map[int64]string `config:"projects"`
+	Ignored  string
+}
+
+func TestUnmarshalScope(t *testing.T) {
+	persist := &model.State{
+		Configs: []*model.Config{
+			cfg(t, "timeout_secs", 10),
+			cfg(t, "ratio", 0.5),
+			cfg(t, "projects", map[int64]string{3: "three"}),
+		},
+	}
+	withFixture(t, persist, func(f *fixture) {
+		dst := &scopeStruct{Ignored: "keep"}
+		require.NoError(t, f.c.UnmarshalScope(dst))
+		assert.Equal(t, scopeStruct{
+			Timeout:  10,
+			Region:   "us",
+			Ratio:    0.5,
+			Projects: map[int64]string{3: "three"},
+			Ignored:  "keep",
+		}, *dst)
+	})
+}
+
+func TestUnmarshalScopeErrors(t *testing.T) {
+	c := NewTestClient().SetString("timeout_secs", "not an int")
+
+	dst := &scopeStruct{Region: "eu"}
+	assert.Error(t, c.UnmarshalScope(dst))
+	assert.Equal(t, scopeStruct{Region: "eu"}, *dst, "dst should not be partially written")
+
+	assert.Error(t, c.UnmarshalScope(scopeStruct{}))
+	assert.Error(t, c.UnmarshalScope((*scopeStruct)(nil)))
+}
+
+func TestBindScope(t *testing.T) {
+	c := NewTestClient().SetInt64("timeout_secs", 1)
+
+	var mu sync.Mutex
+	dst := &scopeStruct{}
+	cancel, err := c.BindScope(dst, &mu)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, dst.Timeout)
+
+	c.SetInt64("timeout_secs", 2).SetString("region", "eu")
+	mu.Lock()
+	assert.EqualValues(t, 2, dst.Timeout)
+	assert.Equal(t, "eu", dst.Region)
+	mu.Unlock()
+
+	// a bad value on reload keeps the last good binding
+	c.SetString("timeout_secs", "bad")
+	assert.EqualValues(t, 2, dst.Timeout)
+
+	cancel()
+	c.SetInt64("timeout_secs", 3)
+	assert.EqualValues(t, 2, dst.Timeout)
+}
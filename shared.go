@@ -0,0 +1,90 @@
+package configmanager
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/mixpanel/obs"
+)
+
+// sharedClients are the clients of Shared by directory and scope
+var sharedClients = struct {
+	mu      sync.Mutex
+	clients map[sharedKey]*sharedClient
+}{clients: make(map[sharedKey]*sharedClient)}
+
+type sharedKey struct {
+	dirPath string
+	scope   string
+}
+
+// sharedClient is a client of Shared and its number of references
+type sharedClient struct {
+	key sharedKey
+	// ready is closed once client or err is set
+	ready  chan struct{}
+	client Client
+	err    error
+	refs   int
+}
+
+// sharedRef is a reference to a sharedClient, closing it releases the
+// reference and closes the client once all the references are closed
+type sharedRef struct {
+	Client
+	shared *sharedClient
+	once   sync.Once
+}
+
+// Shared returns the client of scope in dirPath shared by the process,
+// created by the first call with NewClient and the default options, e.g.
+// for libraries embedded in the same binary that read the same scope.
+// The client is closed once all the clients returned by Shared are closed,
+// and Done is only closed then. fr is only used by the call creating the
+// client. Failures to create the client are not shared.
+func Shared(dirPath, scope string, fr obs.FlightRecorder) (Client, error) {
+	key := sharedKey{dirPath: filepath.Clean(dirPath), scope: scope}
+	sharedClients.mu.Lock()
+	sc, ok := sharedClients.clients[key]
+	if !ok {
+		sc = &sharedClient{key: key, ready: make(chan struct{})}
+		sharedClients.clients[key] = sc
+	}
+	sc.refs++
+	sharedClients.mu.Unlock()
+
+	if ok {
+		<-sc.ready
+	} else {
+		sc.client, sc.err = NewClient(dirPath, scope, fr)
+		if sc.err != nil {
+			sharedClients.mu.Lock()
+			if sharedClients.clients[key] == sc {
+				delete(sharedClients.clients, key)
+			}
+			sharedClients.mu.Unlock()
+		}
+		close(sc.ready)
+	}
+	if sc.err != nil {
+		return nil, sc.err
+	}
+	return &sharedRef{Client: sc.client, shared: sc}, nil
+}
+
+// Close releases the reference, the shared client
+// is closed once all its references are closed
+func (r *sharedRef) Close() {
+	r.once.Do(func() {
+		sharedClients.mu.Lock()
+		r.shared.refs--
+		last := r.shared.refs == 0
+		if last && sharedClients.clients[r.shared.key] == r.shared {
+			delete(sharedClients.clients, r.shared.key)
+		}
+		sharedClients.mu.Unlock()
+		if last {
+			r.shared.client.Close()
+		}
+	})
+}
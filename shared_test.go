@@ -0,0 +1,60 @@
+package configmanager
+
+import (
+	"testing"
+
+	"github.com/mixpanel/configmanager/model"
+	"github.com/mixpanel/configmanager/testutil"
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShared(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	c1, err := Shared(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	c2, err := Shared(dir+"/", ns, obs.NullFR)
+	require.NoError(t, err)
+	assert.Same(t, c1.(*sharedRef).shared, c2.(*sharedRef).shared)
+	assert.EqualValues(t, 1, c2.GetInt64("foo", 0))
+
+	// the client is closed with the last reference
+	c1.Close()
+	c1.Close()
+	select {
+	case <-c2.Done():
+		t.Fatal("the shared client was closed with references left")
+	default:
+	}
+	assert.EqualValues(t, 1, c2.GetInt64("foo", 0))
+	c2.Close()
+	<-c2.Done()
+
+	c3, err := Shared(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	defer c3.Close()
+	assert.NotSame(t, c2.(*sharedRef).shared, c3.(*sharedRef).shared)
+	assert.EqualValues(t, 1, c3.GetInt64("foo", 0))
+}
+
+func TestSharedError(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	_, err := Shared(dir, ns, obs.NullFR)
+	require.Error(t, err)
+
+	// the failure is not shared
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1)}}, dir, ns)
+	c, err := Shared(dir, ns, obs.NullFR)
+	require.NoError(t, err)
+	defer c.Close()
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+}
@@ -0,0 +1,142 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/clock"
+	"github.com/mixpanel/configmanager/model"
+)
+
+const (
+	// diffStreamBuffer is the number of diffs buffered per stream,
+	// the stream is ended if the receiver falls further behind
+	diffStreamBuffer = 64
+	// diffStreamKeepalive is the interval of the comments
+	// keeping idle streams open through proxies
+	diffStreamKeepalive = 30 * time.Second
+)
+
+// streamedChange is a KeyChange sent by DiffStreamHandler
+type streamedChange struct {
+	Key string          `json:"key"`
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// streamedDiff is a Diff sent by DiffStreamHandler
+type streamedDiff struct {
+	Added   []streamedChange `json:"added"`
+	Removed []streamedChange `json:"removed"`
+	Changed []streamedChange `json:"changed"`
+	Time    time.Time        `json:"time"`
+}
+
+func newStreamedDiff(d model.Diff, now time.Time) streamedDiff {
+	return streamedDiff{
+		Added:   streamedChanges(d.Added),
+		Removed: streamedChanges(d.Removed),
+		Changed: streamedChanges(d.Changed),
+		Time:    now,
+	}
+}
+
+// streamedChanges redacts the values of the sensitive changes
+func streamedChanges(changes []model.KeyChange) []streamedChange {
+	res := make([]streamedChange, 0, len(changes))
+	for _, change := range changes {
+		sc := streamedChange{Key: change.Key, Old: change.Old, New: change.New}
+		if change.Sensitive {
+			if sc.Old != nil {
+				sc.Old = redactedValue
+			}
+			if sc.New != nil {
+				sc.New = redactedValue
+			}
+		}
+		res = append(res, sc)
+	}
+	return res
+}
+
+// clocksOf returns the clock and the now func of the options of c,
+// the ones of the time package if c was not made by this package
+func clocksOf(c Client) (clock.Clock, func() time.Time) {
+	if cc, ok := c.(interface {
+		clocks() (clock.Clock, func() time.Time)
+	}); ok {
+		return cc.clocks()
+	}
+	return clock.Real, time.Now
+}
+
+func (c *client) clocks() (clock.Clock, func() time.Time) {
+	return c.opts.clock, c.opts.now
+}
+
+// DiffStreamHandler streams the keys added, removed and changed by every
+// reload of c as Server-Sent Events, e.g. on an admin endpoint such as
+// /configz/stream, so that dashboards and sidecars follow the configs
+// without polling:
+//
+//	event: diff
+//	data: {"added":[],"removed":[],"changed":[{"key":"batch_size","old":10,"new":100}],"time":"..."}
+//
+// The values of sensitive configs are redacted. A stream is ended when
+// its receiver falls behind, EventSource clients reconnect on their own.
+func DiffStreamHandler(c Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		clk, now := clocksOf(c)
+		diffs := make(chan streamedDiff, diffStreamBuffer)
+		overflow := make(chan struct{})
+		var once sync.Once
+		defer c.SubscribeDiff(func(d model.Diff) {
+			select {
+			case diffs <- newStreamedDiff(d, now()):
+			default:
+				once.Do(func() { close(overflow) })
+			}
+		})()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		keepalive := clk.NewTicker(diffStreamKeepalive)
+		defer keepalive.Stop()
+		for {
+			select {
+			case d := <-diffs:
+				data, err := json.Marshal(d)
+				if err != nil {
+					return
+				}
+				if _, err := fmt.Fprintf(w, "event: diff\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			case <-keepalive.C():
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case <-overflow:
+				return
+			case <-r.Context().Done():
+				return
+			case <-c.Done():
+				return
+			}
+			flusher.Flush()
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package configmanager
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffStreamHandler(t *testing.T) {
+	c := NewTestClient()
+	c.SetInt64("batch_size", 10)
+	srv := httptest.NewServer(DiffStreamHandler(c))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	lines := bufio.NewScanner(resp.Body)
+	require.True(t, lines.Scan())
+	assert.Equal(t, ": connected", lines.Text())
+
+	next := func() streamedDiff {
+		for lines.Scan() {
+			if line := lines.Text(); strings.HasPrefix(line, "data: ") {
+				var d streamedDiff
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &d))
+				return d
+			}
+		}
+		require.FailNow(t, "stream ended")
+		return streamedDiff{}
+	}
+
+	c.SetInt64("batch_size", 100)
+	d := next()
+	assert.Empty(t, d.Added)
+	assert.Equal(t, []streamedChange{{Key: "batch_size", Old: []byte("10"), New: []byte("100")}}, d.Changed)
+
+	c.dm.SetConfig(&model.Config{Key: "password", RawValue: []byte(`"hunter2"`), Sensitive: true})
+	d = next()
+	require.Len(t, d.Added, 1)
+	var redacted string
+	require.NoError(t, json.Unmarshal(d.Added[0].New, &redacted))
+	assert.Equal(t, "<redacted>", redacted)
+}
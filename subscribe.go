@@ -0,0 +1,58 @@
+package configmanager
+
+// The typed Subscribe methods parse the old and new raw values
+// and only call fn when the new value parses and differs from
+// the old one. old is the zero value if the key was missing or
+// did not parse.
+
+func (c *client) SubscribeInt64(key string, fn func(old, new int64)) func() {
+	return c.Subscribe(key, func(oldRaw, newRaw []byte) {
+		var old, new int64
+		if newRaw == nil || c.decode(key, newRaw, &new) != nil {
+			return
+		}
+		if oldRaw != nil && c.decode(key, oldRaw, &old) == nil && old == new {
+			return
+		}
+		fn(old, new)
+	})
+}
+
+func (c *client) SubscribeBool(key string, fn func(old, new bool)) func() {
+	return c.Subscribe(key, func(oldRaw, newRaw []byte) {
+		var old, new bool
+		if newRaw == nil || c.decode(key, newRaw, &new) != nil {
+			return
+		}
+		if oldRaw != nil && c.decode(key, oldRaw, &old) == nil && old == new {
+			return
+		}
+		fn(old, new)
+	})
+}
+
+func (c *client) SubscribeFloat64(key string, fn func(old, new float64)) func() {
+	return c.Subscribe(key, func(oldRaw, newRaw []byte) {
+		var old, new float64
+		if newRaw == nil || c.decode(key, newRaw, &new) != nil {
+			return
+		}
+		if oldRaw != nil && c.decode(key, oldRaw, &old) == nil && old == new {
+			return
+		}
+		fn(old, new)
+	})
+}
+
+func (c *client) SubscribeString(key string, fn func(old, new string)) func() {
+	return c.Subscribe(key, func(oldRaw, newRaw []byte) {
+		var old, new string
+		if newRaw == nil || c.decode(key, newRaw, &new) != nil {
+			return
+		}
+		if oldRaw != nil && c.decode(key, oldRaw, &old) == nil && old == new {
+			return
+		}
+		fn(old, new)
+	})
+}
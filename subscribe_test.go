@@ -0,0 +1,30 @@
+package configmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeTyped(t *testing.T) {
+	c := NewTestClient().SetRaw("foo", []byte("1"))
+
+	var changes [][2]int64
+	defer c.SubscribeInt64("foo", func(old, new int64) {
+		changes = append(changes, [2]int64{old, new})
+	})()
+	var flags []bool
+	defer c.SubscribeBool("flag", func(old, new bool) {
+		flags = append(flags, new)
+	})()
+
+	c.SetRaw("foo", []byte(" 1")).
+		SetRaw("foo", []byte("2")).
+		SetString("foo", "bar").
+		SetRaw("foo", []byte("3")).
+		SetBoolean("flag", true).
+		SetRaw("flag", []byte(" true"))
+
+	assert.Equal(t, [][2]int64{{1, 2}, {0, 3}}, changes)
+	assert.Equal(t, []bool{true}, flags)
+}
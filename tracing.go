@@ -0,0 +1,50 @@
+package configmanager
+
+import (
+	"context"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+// Tracer traces the loads of the configs and the decodes of their
+// values, e.g. as OpenTelemetry spans with otelhook.New, so that the
+// time spent parsing large values, like whitelists on their first read
+// after a reload, shows up in the traces of the requests reading them.
+type Tracer interface {
+	// StartLoad is called before every load of the configs from
+	// source, a path or a url, and returns the func called with the
+	// error of the load once it finished
+	StartLoad(source string) (end func(err error))
+	// StartDecode is called before the sampled decodes of the value
+	// of key by the getters, with the context of the Ctx getters or
+	// the background context, and returns the func called with the
+	// error of the decode once it finished
+	StartDecode(ctx context.Context, key string) (end func(err error))
+}
+
+// WithTracer traces every load of the configs and the given fraction
+// of the decodes of their values, chosen at random, with t. The typed
+// getters only decode a value on its first read after a reload.
+func WithTracer(t Tracer, decodeSampleRate float64) Option {
+	return func(o *options) {
+		o.tracer = t
+		o.decodeSampleRate = decodeSampleRate
+		o.smOpts = append(o.smOpts, model.WithLoadTrace(t.StartLoad))
+	}
+}
+
+// traceDecode returns the func ending the trace of a decode
+// of key, or nil if the decode is not traced
+func (c *client) traceDecode(key string) func(err error) {
+	if c.opts.tracer == nil {
+		return nil
+	}
+	if rate := c.opts.decodeSampleRate; rate < 1 && c.rng.Float64() >= rate {
+		return nil
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return c.opts.tracer.StartDecode(ctx, c.prefix+key)
+}
@@ -0,0 +1,79 @@
+package configmanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/mixpanel/configmanager/model"
+	"github.com/mixpanel/configmanager/testutil"
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ctxKey struct{}
+
+type testTracer struct {
+	mu      sync.Mutex
+	loads   []string
+	decodes []string
+	ctxs    []interface{}
+	errs    int
+}
+
+func (t *testTracer) StartLoad(source string) func(err error) {
+	return func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.loads = append(t.loads, source)
+		if err != nil {
+			t.errs++
+		}
+	}
+}
+
+func (t *testTracer) StartDecode(ctx context.Context, key string) func(err error) {
+	return func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.decodes = append(t.decodes, key)
+		t.ctxs = append(t.ctxs, ctx.Value(ctxKey{}))
+	}
+}
+
+func TestTracer(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{Configs: []*model.Config{cfg(t, "foo", 1), cfg(t, "bar", "x")}}, dir, ns)
+	tracer := &testTracer{}
+	c, err := NewClient(dir, ns, obs.NullFR, WithTracer(tracer, 1))
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.Reload())
+
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+	// the parsed value is cached
+	assert.EqualValues(t, 1, c.GetInt64("foo", 0))
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	assert.Equal(t, "x", c.WithPrefix("b").GetStringCtx(ctx, "ar", ""))
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	require.Len(t, tracer.loads, 2)
+	assert.Contains(t, tracer.loads[0], ns)
+	assert.Equal(t, 0, tracer.errs)
+	assert.Equal(t, []string{"foo", "bar"}, tracer.decodes)
+	assert.Equal(t, []interface{}{nil, "request"}, tracer.ctxs)
+}
+
+func TestTracerSampling(t *testing.T) {
+	tracer := &testTracer{}
+	c := NewTestClient(WithTracer(tracer, 0))
+	c.SetString("foo", "x")
+	assert.Equal(t, "x", c.GetString("foo", ""))
+	assert.Empty(t, tracer.decodes)
+}
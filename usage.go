@@ -0,0 +1,75 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+// UsageReport tells which keys were read since the client was
+// created, e.g. to remove the keys no service reads anymore
+type UsageReport struct {
+	// Read are the keys read that are loaded
+	Read []string `json:"read"`
+	// Unread are the keys loaded that were never read
+	Unread []string `json:"unread"`
+	// Missing are the keys read that are not loaded, e.g.
+	// read by callers expecting a key never added
+	Missing []string `json:"missing"`
+}
+
+// usageTracker records the keys read by a client and its views
+type usageTracker struct {
+	// read maps the keys read to whether they were found
+	read sync.Map
+}
+
+// onGet records a read, the map is only
+// written the first time a key is read
+func (u *usageTracker) onGet(key string, cfg *model.Config, err error) {
+	found := err == nil
+	if prev, ok := u.read.Load(key); ok && prev.(bool) == found {
+		return
+	}
+	u.read.Store(key, found)
+}
+
+func (u *usageTracker) report(loaded []string) UsageReport {
+	r := UsageReport{Read: []string{}, Unread: []string{}, Missing: []string{}}
+	isLoaded := make(map[string]bool, len(loaded))
+	for _, key := range loaded {
+		isLoaded[key] = true
+		if _, ok := u.read.Load(key); ok {
+			r.Read = append(r.Read, key)
+		} else {
+			r.Unread = append(r.Unread, key)
+		}
+	}
+	u.read.Range(func(k, _ interface{}) bool {
+		if key := k.(string); !isLoaded[key] {
+			r.Missing = append(r.Missing, key)
+		}
+		return true
+	})
+	sort.Strings(r.Missing)
+	return r
+}
+
+// UsageReport returns the keys read and not read since the client was
+// created, and the keys read that are not loaded. The reads of the views
+// of the client, such as WithPrefix, are included.
+func (c *client) UsageReport() UsageReport {
+	return c.usage.report(c.sm.Keys())
+}
+
+// UsageHandler serves the UsageReport of c as JSON,
+// e.g. on an admin endpoint such as /configz/usage
+func UsageHandler(c Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.UsageReport())
+	})
+}
@@ -0,0 +1,58 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageReport(t *testing.T) {
+	c := NewTestClient()
+	c.SetInt64("foo", 1)
+	c.SetInt64("bar", 2)
+	c.SetInt64("kafka.batch_size", 3)
+
+	c.GetInt64("foo", 0)
+	c.GetInt64("foo", 0)
+	c.GetInt64("missing", 0)
+	c.WithPrefix("kafka.").GetInt64("batch_size", 0)
+
+	assert.Equal(t, UsageReport{
+		Read:    []string{"foo", "kafka.batch_size"},
+		Unread:  []string{"bar"},
+		Missing: []string{"missing"},
+	}, c.UsageReport())
+
+	rec := httptest.NewRecorder()
+	UsageHandler(c).ServeHTTP(rec, httptest.NewRequest("GET", "/configz/usage", nil))
+	var report UsageReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, []string{"bar"}, report.Unread)
+}
+
+func TestUsageReportInternalLookups(t *testing.T) {
+	dm := model.NewDummyStateManager()
+	dm.SetConfig(&model.Config{Key: "required", RawValue: []byte("1")})
+	dm.SetConfig(&model.Config{Key: "secret", RawValue: []byte(`"x"`), Sensitive: true})
+	c, err := NewClientFromStateManager(dm, obs.NullFR, WithRequiredKeys("required"))
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.True(t, c.HasKey("required"))
+	assert.False(t, c.HasKey("missing"))
+	// the getter reads the key, the lookup of the fallback does not
+	c.WithPrefix("sec").GetInt64("ret", 0)
+
+	assert.Equal(t, UsageReport{
+		Read:    []string{"secret"},
+		Unread:  []string{"required"},
+		Missing: []string{},
+	}, c.UsageReport())
+}
@@ -0,0 +1,13 @@
+package configmanager
+
+// RegisterValidator validates every new value of key with fn when the
+// configs are loaded, e.g. to check that a shard count is a power of
+// two. Keys whose new value fails validation keep their previous value,
+// or are not loaded if they had none, and the failure is logged and
+// counted in the invalid_value metric. Validators must be registered
+// before the configs with the invalid values are loaded. Clients
+// reading from a MemoryStateManager do not run validators: validate
+// the configs before pushing them.
+func (c *client) RegisterValidator(key string, fn func(raw []byte) error) {
+	c.opts.validators.Register(c.prefix+key, fn)
+}
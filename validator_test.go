@@ -0,0 +1,79 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/mixpanel/obs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mixpanel/configmanager/model"
+	"github.com/mixpanel/configmanager/testutil"
+)
+
+func powerOfTwo(raw []byte) error {
+	var n int64
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return err
+	}
+	if n <= 0 || n&(n-1) != 0 {
+		return errors.New("not a power of two")
+	}
+	return nil
+}
+
+func TestRegisterValidator(t *testing.T) {
+	dir, done := testutil.MkTempDir(t)
+	defer done()
+
+	ns := getNs()
+	writePersistToFile(t, &model.State{
+		Configs: []*model.Config{
+			cfg(t, "kafka.shards", 4),
+			cfg(t, "timeout", 1),
+		},
+	}, dir, ns)
+
+	reloaded := make(chan ReloadSummary, 10)
+	c, err := NewClient(dir, ns, obs.NullFR, WithOnReload(func(s ReloadSummary) {
+		reloaded <- s
+	}))
+	require.NoError(t, err)
+	defer c.Close()
+	c.WithPrefix("kafka.").RegisterValidator("shards", powerOfTwo)
+	c.RegisterValidator("replicas", powerOfTwo)
+
+	rewrite := func(configs ...*model.Config) {
+		data, err := json.Marshal(configs)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(path.Join(dir, ns, "configs.json"), data, 0777))
+	}
+
+	rewrite(
+		cfg(t, "kafka.shards", 3),
+		cfg(t, "timeout", 2),
+		cfg(t, "replicas", 3),
+	)
+	for c.GetInt64("timeout", 0) != 2 {
+		<-reloaded
+	}
+	// the invalid values are not loaded
+	assert.EqualValues(t, 4, c.GetInt64("kafka.shards", 0))
+	assert.False(t, c.HasKey("replicas"))
+
+	rewrite(
+		cfg(t, "kafka.shards", 8),
+		cfg(t, "timeout", 3),
+		cfg(t, "replicas", 2),
+	)
+	for c.GetInt64("timeout", 0) != 3 {
+		<-reloaded
+	}
+	assert.EqualValues(t, 8, c.GetInt64("kafka.shards", 0))
+	assert.EqualValues(t, 2, c.GetInt64("replicas", 0))
+}
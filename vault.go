@@ -0,0 +1,26 @@
+package configmanager
+
+import (
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/mixpanel/obs"
+	"github.com/mixpanel/obs/obserr"
+)
+
+// NewClientFromVault returns a client reading the configs from the
+// fields of the secret at path in the KV version 2 secrets engine of
+// Vault, so that code reading secrets does not need to know they are
+// secrets. See model.NewVaultStateManager.
+func NewClientFromVault(cfg *model.VaultConfig, path, scope string, fr obs.FlightRecorder, opts ...Option) (Client, error) {
+	o := newOptions(opts)
+	fr = fr.ScopeName("config_manager")
+	sm, err := model.NewVaultStateManager(cfg, path, scope, fr, o.smOpts...)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating vault config manager client").Set("path", path)
+	}
+	c, err := newCheckedClient(o.withOverrides(sm, scope), fr, o)
+	if err != nil {
+		return nil, obserr.Annotate(err, "Error creating vault config manager client").Set("path", path)
+	}
+	return c, nil
+}
@@ -0,0 +1,84 @@
+package configmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+)
+
+// versionTracker counts the generations of the configs
+// served by a client and hashes their content
+type versionTracker struct {
+	sm  model.StateManager
+	now func() time.Time
+
+	mu       sync.RWMutex
+	gen      uint64
+	hash     string
+	loadedAt time.Time
+
+	// events is the stream of Events, nil until requested
+	events *changeEvents
+}
+
+// newVersionTracker returns the tracker of the configs of sm,
+// at the first generation, and the func that stops tracking
+func newVersionTracker(sm model.StateManager, now func() time.Time) (*versionTracker, func()) {
+	v := &versionTracker{sm: sm, now: now}
+	unregister := sm.OnReload(v.reloaded)
+	v.reloaded()
+	return v, func() {
+		unregister()
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if v.events == nil {
+			// Events returns a closed channel after Close
+			v.events = &changeEvents{ch: make(chan ChangeEvent)}
+		}
+		v.events.close()
+	}
+}
+
+func (v *versionTracker) reloaded() {
+	snapshot := v.sm.Snapshot()
+	hash := hashConfigs(snapshot)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.gen++
+	v.hash = hash
+	v.loadedAt = v.now()
+}
+
+func (v *versionTracker) version() (uint64, string, time.Time) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.gen, v.hash, v.loadedAt
+}
+
+// hashConfigs returns the hex SHA-256 of the keys and
+// values of sm, the same for the same configs
+func hashConfigs(sm model.StateManager) string {
+	h := sha256.New()
+	for _, key := range sm.Keys() {
+		cfg, err := sm.GetKey(key)
+		if err != nil {
+			continue
+		}
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write(cfg.RawValue)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Version returns the generation of the configs served, incremented
+// on every reload of any source, the SHA-256 of their keys and values,
+// the same on every process serving the same configs, and the time
+// they were loaded at
+func (c *client) Version() (gen uint64, hash string, loadedAt time.Time) {
+	return c.version.version()
+}
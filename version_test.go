@@ -0,0 +1,39 @@
+package configmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mixpanel/configmanager/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersion(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewTestClient(WithNow(func() time.Time { return now }))
+	sm := c.dm
+	sm.SetConfig(&model.Config{Key: "foo", RawValue: []byte("1")})
+
+	gen, hash, loadedAt := c.Version()
+	assert.EqualValues(t, 2, gen)
+	assert.Len(t, hash, 64)
+	assert.Equal(t, now, loadedAt)
+
+	now = now.Add(time.Minute)
+	sm.SetConfig(&model.Config{Key: "foo", RawValue: []byte("2")})
+	gen2, hash2, loadedAt := c.Version()
+	assert.EqualValues(t, 3, gen2)
+	assert.NotEqual(t, hash, hash2)
+	assert.Equal(t, now, loadedAt)
+
+	// the hash only depends on the configs
+	sm.SetConfig(&model.Config{Key: "foo", RawValue: []byte("1")})
+	gen, hash3, _ := c.Version()
+	assert.EqualValues(t, 4, gen)
+	assert.Equal(t, hash, hash3)
+
+	// views share the version
+	gen, _, _ = c.WithPrefix("f").Version()
+	assert.EqualValues(t, 4, gen)
+}
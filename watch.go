@@ -0,0 +1,136 @@
+package configmanager
+
+import (
+	"sync"
+)
+
+// keyWatch hands the latest raw value of a key to a goroutine
+// delivering it to the watcher. Intermediate values are dropped
+// if the watcher is slower than the reloads.
+type keyWatch struct {
+	mu      sync.Mutex
+	latest  []byte
+	pending bool
+	notify  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (w *keyWatch) set(raw []byte) {
+	w.mu.Lock()
+	w.latest = raw
+	w.pending = true
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *keyWatch) take() ([]byte, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	raw, ok := w.latest, w.pending
+	w.latest, w.pending = nil, false
+	return raw, ok
+}
+
+// watch calls deliver with the current value of key, if any, and then
+// with every new value until cancel is called. deliver must return
+// early when done is closed. onExit is called once delivery stopped.
+func (c *client) watch(key string, deliver func(raw []byte, done <-chan struct{}), onExit func()) func() {
+	w := &keyWatch{
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	unsubscribe := c.sm.Subscribe(key, func(_, new []byte) {
+		w.set(new)
+	})
+	if raw, err := c.GetRaw(key); err == nil {
+		w.mu.Lock()
+		if !w.pending {
+			w.latest, w.pending = raw, true
+			w.notify <- struct{}{}
+		}
+		w.mu.Unlock()
+	}
+	cancel := func() {
+		w.once.Do(func() {
+			unsubscribe()
+			close(w.done)
+		})
+	}
+	id, ok := c.life.track(cancel)
+	if !ok {
+		// the client is closed
+		cancel()
+		onExit()
+		return cancel
+	}
+	go func() {
+		defer c.life.running.Done()
+		defer onExit()
+		for {
+			select {
+			case <-w.notify:
+				if raw, ok := w.take(); ok {
+					deliver(raw, w.done)
+				}
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		c.life.untrack(id)
+	}
+}
+
+// WatchRaw returns a channel that receives the current raw value of key
+// and then every new value after a reload changes it. A removed key is
+// sent as nil. The channel is closed after cancel is called.
+func (c *client) WatchRaw(key string) (<-chan []byte, func()) {
+	ch := make(chan []byte)
+	cancel := c.watch(key, func(raw []byte, done <-chan struct{}) {
+		select {
+		case ch <- raw:
+		case <-done:
+		}
+	}, func() { close(ch) })
+	return ch, cancel
+}
+
+// WatchString is WatchRaw for string values. Values that are
+// missing or are not strings are not sent.
+func (c *client) WatchString(key string) (<-chan string, func()) {
+	ch := make(chan string)
+	cancel := c.watch(key, func(raw []byte, done <-chan struct{}) {
+		var val string
+		if raw == nil || c.decode(key, raw, &val) != nil {
+			return
+		}
+		select {
+		case ch <- val:
+		case <-done:
+		}
+	}, func() { close(ch) })
+	return ch, cancel
+}
+
+// WatchInt64 is WatchRaw for int64 values. Values that are
+// missing or are not integers are not sent.
+func (c *client) WatchInt64(key string) (<-chan int64, func()) {
+	ch := make(chan int64)
+	cancel := c.watch(key, func(raw []byte, done <-chan struct{}) {
+		var val int64
+		if raw == nil || c.decode(key, raw, &val) != nil {
+			return
+		}
+		select {
+		case ch <- val:
+		case <-done:
+		}
+	}, func() { close(ch) })
+	return ch, cancel
+}
@@ -0,0 +1,38 @@
+package configmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchInt64(t *testing.T) {
+	c := NewTestClient().SetInt64("foo", 1)
+
+	ch, cancel := c.WatchInt64("foo")
+	assert.EqualValues(t, 1, <-ch)
+
+	c.SetInt64("foo", 2)
+	assert.EqualValues(t, 2, <-ch)
+
+	// values that do not parse are skipped
+	c.SetString("foo", "bar").SetInt64("foo", 3)
+	assert.EqualValues(t, 3, <-ch)
+
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestWatchRaw(t *testing.T) {
+	c := NewTestClient()
+
+	ch, cancel := c.WatchRaw("foo")
+	defer cancel()
+	c.SetString("foo", "bar")
+	assert.Equal(t, `"bar"`, string(<-ch))
+
+	str, cancelStr := c.WatchString("foo")
+	defer cancelStr()
+	assert.Equal(t, "bar", <-str)
+}
@@ -0,0 +1,323 @@
+package configmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// projectRange is an inclusive range of project ids
+type projectRange struct {
+	lo, hi int64
+}
+
+// largeListSize is the number of ids above which the ids of a
+// project list are kept in a sorted slice instead of a map. The
+// slice takes 8 bytes per id, the map several times more.
+const largeListSize = 4096
+
+// idSet is a set of project ids, a map for small
+// sets and a sorted slice for large ones
+type idSet struct {
+	small  map[int64]struct{}
+	sorted []int64
+}
+
+// newIDSet returns the set of ids, which may be modified
+func newIDSet(ids []int64) idSet {
+	if len(ids) <= largeListSize {
+		return idSet{small: projectSet(ids)}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	sorted := ids[:0]
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			sorted = append(sorted, id)
+		}
+	}
+	// do not hold on to the capacity of the duplicates
+	return idSet{sorted: append([]int64(nil), sorted...)}
+}
+
+func (s idSet) has(id int64) bool {
+	if s.sorted == nil {
+		_, ok := s.small[id]
+		return ok
+	}
+	i := sort.Search(len(s.sorted), func(i int) bool { return s.sorted[i] >= id })
+	return i < len(s.sorted) && s.sorted[i] == id
+}
+
+// projectList is the parsed value of a list of projects, either a
+// map keyed by project id or an object with ranges of ids and ids:
+//
+//	{"ranges": [[1000, 1999], [5000, 5999]], "ids": [42]}
+//
+// The entries of the map may expire:
+//
+//	{"123": {"expires": "2025-10-01T00:00:00Z"}}
+type projectList struct {
+	ids idSet
+	// expires has the ids of the map that expire
+	expires map[int64]time.Time
+	// ranges are sorted and do not overlap
+	ranges []projectRange
+}
+
+// projectEntry is the value of an id in the map form
+type projectEntry struct {
+	Expires *time.Time `json:"expires"`
+}
+
+// contains returns true if projectID is one of the ids not
+// expired at now or falls in one of the ranges of the list
+func (l *projectList) contains(projectID int64, now time.Time) bool {
+	if l.ids.has(projectID) {
+		expires, ok := l.expires[projectID]
+		if !ok || now.Before(expires) {
+			return true
+		}
+	}
+	i := sort.Search(len(l.ranges), func(i int) bool {
+		return l.ranges[i].hi >= projectID
+	})
+	return i < len(l.ranges) && l.ranges[i].lo <= projectID
+}
+
+// ProjectWhitelist is a read-only view of the cached ids of a
+// whitelist, without the ids expired when it was returned
+type ProjectWhitelist struct {
+	list *projectList
+	now  time.Time
+}
+
+// Contains returns true if projectID is in the whitelist
+func (w ProjectWhitelist) Contains(projectID int64) bool {
+	return w.list.ids.has(projectID) && !w.expired(projectID)
+}
+
+// Len returns the number of projects in the whitelist
+func (w ProjectWhitelist) Len() int {
+	n := len(w.list.ids.small) + len(w.list.ids.sorted)
+	for id := range w.list.expires {
+		if w.expired(id) {
+			n--
+		}
+	}
+	return n
+}
+
+// Range calls fn with every project of the whitelist, in no
+// particular order, until fn returns false
+func (w ProjectWhitelist) Range(fn func(projectID int64) bool) {
+	if w.list.ids.sorted == nil {
+		for id := range w.list.ids.small {
+			if !w.expired(id) && !fn(id) {
+				return
+			}
+		}
+		return
+	}
+	for _, id := range w.list.ids.sorted {
+		if !w.expired(id) && !fn(id) {
+			return
+		}
+	}
+}
+
+func (w ProjectWhitelist) expired(projectID int64) bool {
+	expires, ok := w.list.expires[projectID]
+	return ok && !w.now.Before(expires)
+}
+
+// whitelist returns the view of the ids of the list at now. It
+// fails for lists with ranges, which may be too large to list.
+func (l *projectList) whitelist(now time.Time) (ProjectWhitelist, error) {
+	if len(l.ranges) > 0 {
+		return ProjectWhitelist{}, fmt.Errorf("Project list with ranges can not be listed")
+	}
+	return ProjectWhitelist{list: l, now: now}, nil
+}
+
+// UnmarshalJSON streams the object so that large lists
+// are not first unmarshalled into a map
+func (l *projectList) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		*l = projectList{}
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("Invalid project list, expected an object")
+	}
+	var list projectList
+	var ids []int64
+	var ranges []projectRange
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		field := tok.(string)
+		switch field {
+		case "ranges":
+			var pairs [][2]int64
+			if err := dec.Decode(&pairs); err != nil {
+				return err
+			}
+			for _, r := range pairs {
+				if r[0] > r[1] {
+					return fmt.Errorf("Invalid project range [%d, %d]", r[0], r[1])
+				}
+				ranges = append(ranges, projectRange{lo: r[0], hi: r[1]})
+			}
+		case "ids":
+			var more []int64
+			if err := dec.Decode(&more); err != nil {
+				return err
+			}
+			ids = append(ids, more...)
+		default:
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return fmt.Errorf("Invalid project id %q", field)
+			}
+			var entry projectEntry
+			if err := dec.Decode(&entry); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+			if entry.Expires == nil {
+				continue
+			}
+			if list.expires == nil {
+				list.expires = make(map[int64]time.Time)
+			}
+			list.expires[id] = *entry.Expires
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	list.ids = newIDSet(ids)
+	list.ranges = mergeRanges(ranges)
+	*l = list
+	return nil
+}
+
+// mergeRanges sorts ranges and merges the ones that overlap
+func mergeRanges(ranges []projectRange) []projectRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].lo < ranges[j].lo
+	})
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.lo <= merged[n-1].hi {
+			if r.hi > merged[n-1].hi {
+				merged[n-1].hi = r.hi
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// memberList is the parsed value of a list of string members,
+// a map keyed by member. Keys containing * or ? are globs and keys
+// between slashes, e.g. "/^internal-[0-9]+$/", are regular expressions.
+type memberList struct {
+	members map[string]struct{}
+	// patterns are only matched when members misses
+	patterns []*regexp.Regexp
+}
+
+// contains returns true if member is one of the members
+// or matches one of the patterns of the list
+func (l *memberList) contains(member string) bool {
+	if _, ok := l.members[member]; ok {
+		return true
+	}
+	for _, re := range l.patterns {
+		if re.MatchString(member) {
+			return true
+		}
+	}
+	return false
+}
+
+// set returns a copy of the members of the list. It fails for
+// lists with patterns, whose matches can not be listed.
+func (l *memberList) set() (map[string]struct{}, error) {
+	if len(l.patterns) > 0 {
+		return nil, fmt.Errorf("Member list with patterns can not be listed")
+	}
+	set := make(map[string]struct{}, len(l.members))
+	for member := range l.members {
+		set[member] = struct{}{}
+	}
+	return set, nil
+}
+
+func (l *memberList) UnmarshalJSON(data []byte) error {
+	var entries map[string]struct{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	list := memberList{members: make(map[string]struct{}, len(entries))}
+	for entry := range entries {
+		re, err := compilePattern(entry)
+		if err != nil {
+			return err
+		}
+		if re == nil {
+			list.members[entry] = struct{}{}
+			continue
+		}
+		list.patterns = append(list.patterns, re)
+	}
+	// map iteration is random, keep the matching order stable
+	sort.Slice(list.patterns, func(i, j int) bool {
+		return list.patterns[i].String() < list.patterns[j].String()
+	})
+	*l = list
+	return nil
+}
+
+// compilePattern returns the regexp matching entry if it is a glob
+// or a regular expression, and nil if entry is a plain member
+func compilePattern(entry string) (*regexp.Regexp, error) {
+	if len(entry) > 1 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		re, err := regexp.Compile(entry[1 : len(entry)-1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid whitelist pattern %q: %v", entry, err)
+		}
+		return re, nil
+	}
+	if !strings.ContainsAny(entry, "*?") {
+		return nil, nil
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range entry {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String()), nil
+}
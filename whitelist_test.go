@@ -0,0 +1,113 @@
+package configmanager
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLargeProjectList(t *testing.T) {
+	entries := make(map[int64]projectEntry)
+	for id := int64(0); id < 3*largeListSize; id += 3 {
+		entries[id] = projectEntry{}
+	}
+	expires := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	entries[1] = projectEntry{Expires: &expires}
+	data, err := json.Marshal(entries)
+	require.NoError(t, err)
+
+	var list projectList
+	require.NoError(t, json.Unmarshal(data, &list))
+	assert.Nil(t, list.ids.small)
+	assert.Len(t, list.ids.sorted, largeListSize+1)
+
+	now := expires.Add(-time.Hour)
+	assert.True(t, list.contains(0, now))
+	assert.True(t, list.contains(3*largeListSize-3, now))
+	assert.True(t, list.contains(1, now))
+	assert.False(t, list.contains(1, expires))
+	assert.False(t, list.contains(2, now))
+	assert.False(t, list.contains(-3, now))
+	assert.False(t, list.contains(3*largeListSize, now))
+}
+
+func TestProjectListDuplicates(t *testing.T) {
+	ids := make([]int64, 0, 2*largeListSize+2)
+	for id := int64(largeListSize); id >= 0; id-- {
+		ids = append(ids, id, id)
+	}
+	data, err := json.Marshal(map[string]interface{}{"ids": ids})
+	require.NoError(t, err)
+
+	var list projectList
+	require.NoError(t, json.Unmarshal(data, &list))
+	assert.Len(t, list.ids.sorted, largeListSize+1)
+	assert.True(t, list.contains(largeListSize, time.Now()))
+	assert.False(t, list.contains(largeListSize+1, time.Now()))
+}
+
+func TestGetWhitelist(t *testing.T) {
+	now := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	cu := &countUnmarshal{}
+	c := NewTestClient(WithNow(func() time.Time { return now }), WithUnmarshal(cu.unmarshal)).
+		SetProjectsWhitelist("projects", 1, 2).
+		SetRaw("expiring", []byte(`{"1": {}, "2": {"expires": "2025-08-01T00:00:00Z"}}`)).
+		SetRaw("ranges", []byte(`{"ranges": [[1, 10]]}`)).
+		SetMembersWhitelist("tokens", "abc", "def").
+		SetMembersWhitelist("patterns", "abc", "internal-*")
+
+	ids := func(w ProjectWhitelist) map[int64]struct{} {
+		set := make(map[int64]struct{})
+		w.Range(func(id int64) bool {
+			set[id] = struct{}{}
+			return true
+		})
+		return set
+	}
+	projects, err := c.GetProjectWhitelist("projects")
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]struct{}{1: {}, 2: {}}, ids(projects))
+	assert.Equal(t, 2, projects.Len())
+	assert.True(t, projects.Contains(1))
+	assert.False(t, projects.Contains(3))
+	// the view shares the cached list
+	assert.True(t, c.IsProjectWhitelisted("projects", 1, false))
+	assert.EqualValues(t, 1, cu.count())
+
+	projects, err = c.GetProjectWhitelist("expiring")
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]struct{}{1: {}}, ids(projects))
+	assert.Equal(t, 1, projects.Len())
+	assert.False(t, projects.Contains(2))
+
+	large := make([]int, largeListSize+1)
+	for i := range large {
+		large[i] = i
+	}
+	c.SetProjectsWhitelist("large", large...)
+	projects, err = c.GetProjectWhitelist("large")
+	require.NoError(t, err)
+	assert.Equal(t, largeListSize+1, projects.Len())
+	assert.True(t, projects.Contains(largeListSize))
+	n := 0
+	projects.Range(func(int64) bool {
+		n++
+		return n < 10
+	})
+	assert.Equal(t, 10, n)
+
+	_, err = c.GetProjectWhitelist("ranges")
+	assert.Error(t, err)
+	_, err = c.GetProjectWhitelist("missing")
+	assert.True(t, IsNotFound(err))
+
+	tokens, err := c.GetTokenWhitelist("tokens")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"abc": {}, "def": {}}, tokens)
+
+	_, err = c.GetTokenWhitelist("patterns")
+	assert.Error(t, err)
+}